@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/maildir"
+	"github.com/gozeloglu/gop-3/pop3/mbox"
+)
+
+// withClient connects to the server, runs fn and quits. The
+// deletions are committed by QUIT, so its error is returned
+// too.
+func (a *app) withClient(fn func(ctx context.Context, c *pop3.Client) error) error {
+	ctx := context.Background()
+	c, err := a.connect(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(ctx, c)
+	if _, qerr := c.QuitContext(ctx); err == nil && qerr != nil {
+		err = fmt.Errorf("quit: %w", qerr)
+	}
+	return err
+}
+
+// output prints v as JSON in JSON mode, otherwise it calls
+// text.
+func (a *app) output(v interface{}, text func(w io.Writer)) error {
+	if a.json {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	text(a.stdout)
+	return nil
+}
+
+// parseNum parses the message number argument.
+func parseNum(arg string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		return 0, usageError(fmt.Sprintf("invalid message number %q", arg))
+	}
+	return n, nil
+}
+
+// parseNums parses the message number arguments.
+func parseNums(args []string) ([]int, error) {
+	nums := make([]int, 0, len(args))
+	for _, arg := range args {
+		n, err := parseNum(arg)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, n)
+	}
+	return nums, nil
+}
+
+// messageJSON is a message in JSON output.
+type messageJSON struct {
+	Num     int    `json:"num"`
+	Size    int    `json:"size,omitempty"`
+	UID     string `json:"uid,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// stat prints the number and the total size of the messages.
+func (a *app) stat(args []string) error {
+	if len(args) != 0 {
+		return usageError("stat takes no arguments")
+	}
+	return a.withClient(func(ctx context.Context, c *pop3.Client) error {
+		st, err := c.StatInfoContext(ctx)
+		if err != nil {
+			return err
+		}
+		return a.output(map[string]int{"count": st.Count, "size": st.Size}, func(w io.Writer) {
+			fmt.Fprintf(w, "%d messages (%d octets)\n", st.Count, st.Size)
+		})
+	})
+}
+
+// list prints the sizes of the messages.
+func (a *app) list(args []string) error {
+	if len(args) > 1 {
+		return usageError("list takes at most one message number")
+	}
+	nums, err := parseNums(args)
+	if err != nil {
+		return err
+	}
+	return a.withClient(func(ctx context.Context, c *pop3.Client) error {
+		var infos []pop3.MessageInfo
+		if len(nums) == 1 {
+			info, err := c.ListOneContext(ctx, nums[0])
+			if err != nil {
+				return err
+			}
+			infos = append(infos, info)
+		} else if infos, err = c.ListAllContext(ctx); err != nil {
+			return err
+		}
+
+		msgs := make([]messageJSON, len(infos))
+		for i, info := range infos {
+			msgs[i] = messageJSON{Num: info.Num, Size: info.Size}
+		}
+		return a.output(msgs, func(w io.Writer) {
+			for _, info := range infos {
+				fmt.Fprintf(w, "%d %d\n", info.Num, info.Size)
+			}
+		})
+	})
+}
+
+// uidl prints the unique-ids of the messages.
+func (a *app) uidl(args []string) error {
+	if len(args) > 1 {
+		return usageError("uidl takes at most one message number")
+	}
+	nums, err := parseNums(args)
+	if err != nil {
+		return err
+	}
+	return a.withClient(func(ctx context.Context, c *pop3.Client) error {
+		var ids []pop3.UniqueID
+		if len(nums) == 1 {
+			id, err := c.UidlOneContext(ctx, nums[0])
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		} else if ids, err = c.UidlContext(ctx); err != nil {
+			return err
+		}
+
+		msgs := make([]messageJSON, len(ids))
+		for i, id := range ids {
+			msgs[i] = messageJSON{Num: id.Num, UID: id.UID}
+		}
+		return a.output(msgs, func(w io.Writer) {
+			for _, id := range ids {
+				fmt.Fprintf(w, "%d %s\n", id.Num, id.UID)
+			}
+		})
+	})
+}
+
+// top prints the headers and the first lines of the body.
+func (a *app) top(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageError("top takes a message number and an optional number of lines")
+	}
+	num, err := parseNum(args[0])
+	if err != nil {
+		return err
+	}
+	n := 0
+	if len(args) == 2 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+			return usageError(fmt.Sprintf("invalid number of lines %q", args[1]))
+		}
+	}
+	return a.withClient(func(ctx context.Context, c *pop3.Client) error {
+		lines, err := c.TopContext(ctx, num, n)
+		if err != nil {
+			return err
+		}
+		// The first line is the status line.
+		lines = lines[1:]
+		data := strings.Join(lines, "\n") + "\n"
+		return a.output(messageJSON{Num: num, Data: data}, func(w io.Writer) {
+			io.WriteString(w, data)
+		})
+	})
+}
+
+// fetch retrieves the messages to the standard output, .eml
+// files, a Maildir or an mbox file.
+func (a *app) fetch(args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	emlDir := fs.String("eml", "", "save every message into `dir` as <uid>.eml")
+	maildirDir := fs.String("maildir", "", "deliver the messages into the Maildir `dir`")
+	mboxFile := fs.String("mbox", "", "append the messages to the mbox `file` in mboxrd format")
+	del := fs.Bool("delete", false, "delete the messages after they are saved")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	dests := 0
+	for _, d := range []string{*emlDir, *maildirDir, *mboxFile} {
+		if d != "" {
+			dests++
+		}
+	}
+	if dests > 1 {
+		return usageError("only one of -eml, -maildir and -mbox can be used")
+	}
+	nums, err := parseNums(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var save saver
+	switch {
+	case *emlDir != "":
+		save, err = emlSaver(*emlDir)
+	case *maildirDir != "":
+		save, err = maildirSaver(*maildirDir)
+	case *mboxFile != "":
+		var f *os.File
+		f, save, err = mboxSaver(*mboxFile)
+		if f != nil {
+			defer f.Close()
+		}
+	default:
+		save = a.stdoutSaver()
+	}
+	if err != nil {
+		return err
+	}
+
+	return a.withClient(func(ctx context.Context, c *pop3.Client) error {
+		if len(nums) == 0 {
+			infos, err := c.ListAllContext(ctx)
+			if err != nil {
+				return err
+			}
+			for _, info := range infos {
+				nums = append(nums, info.Num)
+			}
+		}
+		uids := make(map[int]string)
+		if *emlDir != "" {
+			// The unique-ids are the file names. The message
+			// numbers are used if UIDL is not supported.
+			ids, err := c.UidlContext(ctx)
+			var se *pop3.ServerError
+			if err != nil && !errors.As(err, &se) {
+				return err
+			}
+			for _, id := range ids {
+				uids[id.Num] = id.UID
+			}
+		}
+
+		var results []messageJSON
+		for _, num := range nums {
+			m := messageJSON{Num: num, UID: uids[num]}
+			if err := save(ctx, c, &m); err != nil {
+				return fmt.Errorf("message %d: %w", num, err)
+			}
+			if *del {
+				if _, err := c.DeleContext(ctx, strconv.Itoa(num)); err != nil {
+					return fmt.Errorf("message %d: %w", num, err)
+				}
+				m.Deleted = true
+			}
+			results = append(results, m)
+		}
+		if dests == 0 && !a.json {
+			return nil
+		}
+		return a.output(results, func(w io.Writer) {
+			for _, m := range results {
+				fmt.Fprintf(w, "%d %s", m.Num, m.Path)
+				if m.Deleted {
+					fmt.Fprint(w, " (deleted)")
+				}
+				fmt.Fprintln(w)
+			}
+		})
+	})
+}
+
+// saver saves the message and fills the fields of the output.
+type saver func(ctx context.Context, c *pop3.Client, m *messageJSON) error
+
+// retrAll retrieves the message into memory.
+func retrAll(ctx context.Context, c *pop3.Client, num int) ([]byte, error) {
+	r, err := c.RetrReaderContext(ctx, num)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	return data, err
+}
+
+// stdoutSaver writes the messages to the standard output. In
+// JSON mode, the messages are kept in the output.
+func (a *app) stdoutSaver() saver {
+	return func(ctx context.Context, c *pop3.Client, m *messageJSON) error {
+		if a.json {
+			data, err := retrAll(ctx, c, m.Num)
+			m.Data = string(data)
+			return err
+		}
+		r, err := c.RetrReaderContext(ctx, m.Num)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(a.stdout, r)
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
+
+// emlSaver writes every message into a new file in the
+// directory. The existing files are not replaced; if the name
+// is taken, a number is appended to it. The file is synced
+// before the message can be deleted.
+func emlSaver(dir string) (saver, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, c *pop3.Client, m *messageJSON) error {
+		data, err := retrAll(ctx, c, m.Num)
+		if err != nil {
+			return err
+		}
+		name := strconv.Itoa(m.Num)
+		if m.UID != "" {
+			name = safeName(m.UID)
+		}
+		m.Size = len(data)
+		m.Path, err = writeNewFile(dir, name, ".eml", data)
+		return err
+	}, nil
+}
+
+// writeNewFile writes the data into a new file and syncs the
+// file and the directory. If name+ext exists, "-2", "-3" and
+// so on are appended to the name.
+//
+// dir string - directory of the file.
+// name string - file name without the extension.
+// ext string - extension, e.g. ".eml"
+// data []byte - content of the file.
+func writeNewFile(dir, name, ext string, data []byte) (string, error) {
+	var f *os.File
+	var path string
+	for i := 1; ; i++ {
+		path = filepath.Join(dir, name+ext)
+		if i > 1 {
+			path = filepath.Join(dir, name+"-"+strconv.Itoa(i)+ext)
+		}
+		var err error
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+	}
+	_, err := f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, syncDir(dir)
+}
+
+// syncDir syncs the directory, so the new files in it are
+// durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// safeName replaces the characters of the unique-id which are
+// not safe in file names.
+func safeName(uid string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, uid)
+}
+
+// maildirSaver delivers the messages into the Maildir.
+func maildirSaver(dir string) (saver, error) {
+	d := maildir.Dir(dir)
+	if err := d.Init(); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, c *pop3.Client, m *messageJSON) error {
+		r, err := c.RetrReaderContext(ctx, m.Num)
+		if err != nil {
+			return err
+		}
+		key, err := d.Deliver(r)
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+		m.Path = filepath.Join(dir, "new", key)
+		return err
+	}, nil
+}
+
+// mboxSaver appends the messages to the mbox file. The file
+// is synced after each message, before it can be deleted. The
+// file must be closed by the caller.
+func mboxSaver(path string) (*os.File, saver, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := mbox.NewWriter(f, mbox.Mboxrd)
+	return f, func(ctx context.Context, c *pop3.Client, m *messageJSON) error {
+		m.Path = path
+		if err := w.WriteRetrContext(ctx, c, m.Num); err != nil {
+			return err
+		}
+		return f.Sync()
+	}, nil
+}
+
+// delete deletes the messages.
+func (a *app) delete(args []string) error {
+	if len(args) == 0 {
+		return usageError("delete takes at least one message number")
+	}
+	nums, err := parseNums(args)
+	if err != nil {
+		return err
+	}
+	return a.withClient(func(ctx context.Context, c *pop3.Client) error {
+		for _, num := range nums {
+			if _, err := c.DeleContext(ctx, strconv.Itoa(num)); err != nil {
+				return fmt.Errorf("message %d: %w", num, err)
+			}
+		}
+		return a.output(map[string][]int{"deleted": nums}, func(w io.Writer) {
+			for _, num := range nums {
+				fmt.Fprintf(w, "message %d deleted\n", num)
+			}
+		})
+	})
+}
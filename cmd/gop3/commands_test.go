@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3/maildir"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+// newServer starts a fake POP3 server with two messages.
+func newServer(t *testing.T) *pop3test.Server {
+	srv := pop3test.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddMailbox("john", "secret",
+		pop3test.Message{UID: "uid/1", Data: "Subject: one\r\n\r\nfirst\r\nsecond\r\n"},
+		pop3test.Message{UID: "uid-2", Data: "Subject: two\r\n\r\nFrom here\r\n"},
+	)
+	return srv
+}
+
+// gop3 runs the command against the server and returns the
+// exit code, the output and the errors.
+func gop3(t *testing.T, srv *pop3test.Server, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	vars := map[string]string{"POP3_ADDR": srv.Addr, "POP3_USER": "john", "POP3_PASSWORD": "secret"}
+	code := run(args, &stdout, &stderr, env(vars))
+	return code, stdout.String(), stderr.String()
+}
+
+func TestStat(t *testing.T) {
+	srv := newServer(t)
+	code, out, errOut := gop3(t, srv, "stat")
+	if code != exitOK || out != "2 messages (58 octets)\n" {
+		t.Errorf("unexpected output: %d %q %q", code, out, errOut)
+	}
+
+	_, out, _ = gop3(t, srv, "-json", "stat")
+	var st map[string]int
+	if err := json.Unmarshal([]byte(out), &st); err != nil || st["count"] != 2 || st["size"] != 58 {
+		t.Errorf("unexpected JSON: %s", out)
+	}
+}
+
+func TestList(t *testing.T) {
+	srv := newServer(t)
+	if _, out, _ := gop3(t, srv, "list"); out != "1 31\n2 27\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if _, out, _ := gop3(t, srv, "list", "2"); out != "2 27\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+	_, out, _ := gop3(t, srv, "-json", "uidl")
+	var msgs []messageJSON
+	if err := json.Unmarshal([]byte(out), &msgs); err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []messageJSON{{Num: 1, UID: "uid/1"}, {Num: 2, UID: "uid-2"}}
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, msgs)
+	}
+}
+
+func TestTop(t *testing.T) {
+	srv := newServer(t)
+	if _, out, _ := gop3(t, srv, "top", "1", "1"); out != "Subject: one\n\nfirst\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := newServer(t)
+	code, out, errOut := gop3(t, srv, "fetch", "2")
+	if code != exitOK || out != "Subject: two\r\n\r\nFrom here\r\n" {
+		t.Errorf("unexpected output: %d %q %q", code, out, errOut)
+	}
+
+	dir := t.TempDir()
+	if code, _, errOut = gop3(t, srv, "fetch", "-eml", dir); code != exitOK {
+		t.Fatalf("unexpected error: %s", errOut)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "uid_1.eml")); err != nil || !strings.HasPrefix(string(b), "Subject: one") {
+		t.Errorf("unexpected eml file: %q %v", b, err)
+	}
+
+	md := maildir.Dir(filepath.Join(dir, "inbox"))
+	if code, _, errOut = gop3(t, srv, "fetch", "-maildir", string(md)); code != exitOK {
+		t.Fatalf("unexpected error: %s", errOut)
+	}
+	if msgs, err := md.List(); err != nil || len(msgs) != 2 {
+		t.Errorf("expected 2 messages in Maildir, got: %v %v", msgs, err)
+	}
+
+	mboxFile := filepath.Join(dir, "archive.mbox")
+	if code, _, errOut = gop3(t, srv, "fetch", "-mbox", mboxFile, "-delete", "2"); code != exitOK {
+		t.Fatalf("unexpected error: %s", errOut)
+	}
+	if b, _ := os.ReadFile(mboxFile); !strings.Contains(string(b), "\n>From here\n") {
+		t.Errorf("unexpected mbox: %q", b)
+	}
+	if msgs := srv.Messages("john"); len(msgs) != 1 {
+		t.Errorf("fetched message must be deleted, got: %d messages", len(msgs))
+	}
+}
+
+func TestFetchEmlCollision(t *testing.T) {
+	srv := pop3test.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddMailbox("john", "secret",
+		pop3test.Message{UID: "a+b", Data: "Subject: one\r\n\r\nfirst\r\n"},
+		pop3test.Message{UID: "a=b", Data: "Subject: two\r\n\r\nsecond\r\n"},
+	)
+	dir := t.TempDir()
+	if code, _, errOut := gop3(t, srv, "fetch", "-eml", dir, "-delete"); code != exitOK {
+		t.Fatalf("unexpected error: %s", errOut)
+	}
+	one, _ := os.ReadFile(filepath.Join(dir, "a_b.eml"))
+	two, _ := os.ReadFile(filepath.Join(dir, "a_b-2.eml"))
+	if !strings.HasPrefix(string(one), "Subject: one") || !strings.HasPrefix(string(two), "Subject: two") {
+		t.Errorf("messages must not be overwritten: %q %q", one, two)
+	}
+}
+
+func TestFetchUidlError(t *testing.T) {
+	srv := newServer(t)
+	srv.Fail("UIDL", pop3test.Failure{Close: true})
+	if code, _, _ := gop3(t, srv, "fetch", "-eml", t.TempDir(), "-delete"); code == exitOK {
+		t.Errorf("expected UIDL error")
+	}
+	if msgs := srv.Messages("john"); len(msgs) != 2 {
+		t.Errorf("messages must not be deleted, got: %d messages", len(msgs))
+	}
+
+	srv.Fail("UIDL", pop3test.Failure{Resp: "-ERR unknown command"})
+	dir := t.TempDir()
+	if code, _, errOut := gop3(t, srv, "fetch", "-eml", dir, "1"); code != exitOK {
+		t.Fatalf("unexpected error: %s", errOut)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1.eml")); err != nil {
+		t.Errorf("message number must be the name: %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	srv := newServer(t)
+	code, out, _ := gop3(t, srv, "-json", "delete", "1", "2")
+	if code != exitOK || strings.Join(strings.Fields(out), "") != `{"deleted":[1,2]}` {
+		t.Errorf("unexpected output: %d %q", code, out)
+	}
+	if msgs := srv.Messages("john"); len(msgs) != 0 {
+		t.Errorf("expected empty mailbox, got: %d messages", len(msgs))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := newServer(t)
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{nil, exitUsage},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"delete"}, exitUsage},
+		{[]string{"top", "x"}, exitUsage},
+		{[]string{"fetch", "-eml", "a", "-mbox", "b"}, exitUsage},
+		{[]string{"-auth", "digest-md5", "stat"}, exitUsage},
+		{[]string{"list", "9"}, exitError},
+	}
+	for _, tt := range tests {
+		if code, _, _ := gop3(t, srv, tt.args...); code != tt.code {
+			t.Errorf("%v: expected exit code %d, got: %d", tt.args, tt.code, code)
+		}
+	}
+
+	var stderr bytes.Buffer
+	vars := map[string]string{"POP3_ADDR": srv.Addr, "POP3_USER": "john", "POP3_PASSWORD": "wrong"}
+	if code := run([]string{"-netrc", os.DevNull, "stat"}, &bytes.Buffer{}, &stderr, env(vars)); code != exitError {
+		t.Errorf("expected exit code %d, got: %d", exitError, code)
+	}
+	if !strings.Contains(stderr.String(), "login") {
+		t.Errorf("unexpected error: %s", stderr.String())
+	}
+}
+
+func TestAuthMechanisms(t *testing.T) {
+	srv := pop3test.NewTLSServer()
+	defer srv.Close()
+	srv.AddMailbox("john", "secret")
+	for _, mech := range []string{"user", "plain", "login"} {
+		var stdout, stderr bytes.Buffer
+		vars := map[string]string{"POP3_USER": "john", "POP3_PASSWORD": "secret"}
+		code := run([]string{"-addr", srv.Addr, "-tls", "-insecure", "-auth", mech, "stat"}, &stdout, &stderr, env(vars))
+		if code != exitOK {
+			t.Errorf("%s: unexpected error: %s", mech, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/sasl"
+)
+
+// netrcEntry is a machine entry of a netrc file.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// parseNetrc parses the machine and default entries of a
+// netrc file. The macro definitions are skipped. The default
+// entry has an empty machine name.
+//
+// data string - content of the netrc file.
+func parseNetrc(data string) []netrcEntry {
+	var entries []netrcEntry
+	var cur *netrcEntry
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			value := ""
+			if j+1 < len(fields) {
+				value = fields[j+1]
+			}
+			switch fields[j] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: value})
+				cur = &entries[len(entries)-1]
+				j++
+			case "default":
+				entries = append(entries, netrcEntry{})
+				cur = &entries[len(entries)-1]
+			case "login", "password", "account":
+				if cur != nil && fields[j] == "login" {
+					cur.login = value
+				} else if cur != nil && fields[j] == "password" {
+					cur.password = value
+				}
+				j++
+			case "macdef":
+				// The macro lasts until an empty line.
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	return entries
+}
+
+// lookupNetrc returns the entry of the host. The first
+// matching machine entry wins, then the default entry. If
+// user is not empty, the login of the entry must match it.
+//
+// entries []netrcEntry - parsed netrc file.
+// host string - server host name.
+// user string - username, or "" for any.
+func lookupNetrc(entries []netrcEntry, host, user string) (netrcEntry, bool) {
+	var def *netrcEntry
+	for i, e := range entries {
+		if user != "" && e.login != "" && e.login != user {
+			continue
+		}
+		if e.machine == host {
+			return e, true
+		}
+		if e.machine == "" && def == nil {
+			def = &entries[i]
+		}
+	}
+	if def != nil {
+		return *def, true
+	}
+	return netrcEntry{}, false
+}
+
+// netrcPath returns the path of the netrc file. NETRC
+// environment variable overrides the default path.
+func (a *app) netrcPath() string {
+	if a.netrc != "" {
+		return a.netrc
+	}
+	if p := a.getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(home, name)
+}
+
+// credentials returns the username and the password or the
+// token of the user.
+//
+// host string - server host name for the netrc lookup.
+func (a *app) credentials(host string) (string, string, error) {
+	user := a.user
+	if user == "" {
+		user = a.getenv("POP3_USER")
+	}
+	password := a.getenv("POP3_PASSWORD")
+
+	if password == "" && a.passwordCmd != "" {
+		out, err := passwordCommand(a.passwordCmd)
+		if err != nil {
+			return "", "", err
+		}
+		password = out
+	}
+
+	if password == "" || user == "" {
+		if data, err := os.ReadFile(a.netrcPath()); err == nil {
+			if e, ok := lookupNetrc(parseNetrc(string(data)), host, user); ok {
+				if user == "" {
+					user = e.login
+				}
+				if password == "" {
+					password = e.password
+				}
+			}
+		} else if a.netrc != "" {
+			return "", "", err
+		}
+	}
+
+	if user == "" {
+		return "", "", errors.New("no username: use -user, POP3_USER or netrc")
+	}
+	if password == "" {
+		return "", "", errors.New("no password: use POP3_PASSWORD, -password-cmd or netrc")
+	}
+	return user, password, nil
+}
+
+// passwordCommand runs the shell command and returns the
+// first line of its output.
+//
+// cmdline string - shell command, e.g. "pass show mail"
+func passwordCommand(cmdline string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", cmdline)
+	} else {
+		cmd = exec.Command("sh", "-c", cmdline)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(strings.SplitN(string(out), "\n", 2)[0], "\r"), nil
+}
+
+// hostPort returns the address with the default port of the
+// security mode.
+func (a *app) hostPort() (string, string, error) {
+	if a.addr == "" {
+		return "", "", usageError("no server address: use -addr or POP3_ADDR")
+	}
+	host, port, err := net.SplitHostPort(a.addr)
+	if err != nil {
+		host, port = a.addr, "110"
+		if a.implicitTLS {
+			port = "995"
+		}
+	}
+	return host, port, nil
+}
+
+// connect dials the server and logs in.
+func (a *app) connect(ctx context.Context) (*pop3.Client, error) {
+	if a.implicitTLS && a.startTLS {
+		return nil, usageError("-tls and -starttls cannot be used together")
+	}
+	host, port, err := a.hostPort()
+	if err != nil {
+		return nil, err
+	}
+	user, password, err := a.credentials(host)
+	if err != nil {
+		return nil, err
+	}
+	mech, err := a.mechanism(user, password, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &pop3.Dialer{
+		Mode:         pop3.ModePlain,
+		Timeout:      a.timeout,
+		ReadTimeout:  a.timeout,
+		WriteTimeout: a.timeout,
+	}
+	if a.implicitTLS {
+		d.Mode = pop3.ModeTLS
+	} else if a.startTLS {
+		d.Mode = pop3.ModeStartTLS
+	}
+	if a.insecure {
+		d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	c, err := d.DialContext(ctx, net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case mech != nil:
+		// The capabilities tell whether the initial response
+		// can be sent with AUTH command.
+		c.CapaContext(ctx)
+		_, err = c.AuthContext(ctx, mech)
+	case strings.EqualFold(a.auth, "apop"):
+		_, err = c.ApopContext(ctx, user, password)
+	default:
+		if _, err = c.UserContext(ctx, user); err == nil {
+			_, err = c.PassContext(ctx, password)
+		}
+	}
+	if err != nil {
+		c.Quit()
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	return c, nil
+}
+
+// mechanism returns the SASL mechanism of -auth flag. It
+// returns <nil> for USER/PASS and APOP.
+func (a *app) mechanism(user, password, host, port string) (sasl.Mechanism, error) {
+	switch strings.ToLower(a.auth) {
+	case "user", "apop":
+		return nil, nil
+	case "plain":
+		return sasl.NewPlainClient("", user, password), nil
+	case "login":
+		return sasl.NewLoginClient(user, password), nil
+	case "cram-md5":
+		return sasl.NewCramMD5Client(user, password), nil
+	case "scram-sha-1":
+		return sasl.NewScramSHA1Client(user, password), nil
+	case "scram-sha-256":
+		return sasl.NewScramSHA256Client(user, password), nil
+	case "xoauth2":
+		return sasl.NewXOAuth2Client(user, sasl.StaticToken(password)), nil
+	case "oauthbearer":
+		p, _ := strconv.Atoi(port)
+		return sasl.NewOAuthBearerClient(user, host, p, sasl.StaticToken(password)), nil
+	}
+	return nil, usageError(fmt.Sprintf("unknown authentication mechanism %q", a.auth))
+}
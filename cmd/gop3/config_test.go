@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+const testNetrc = `machine pop.example.com login john password secret
+macdef init
+machine evil.example.com login x password y
+
+machine other.example.com
+	login jane
+	password hunter2
+default login anonymous password guest
+`
+
+func TestParseNetrc(t *testing.T) {
+	expected := []netrcEntry{
+		{machine: "pop.example.com", login: "john", password: "secret"},
+		{machine: "other.example.com", login: "jane", password: "hunter2"},
+		{login: "anonymous", password: "guest"},
+	}
+	entries := parseNetrc(testNetrc)
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, entries)
+	}
+}
+
+func TestLookupNetrc(t *testing.T) {
+	entries := parseNetrc(testNetrc)
+	tests := []struct {
+		host, user, login string
+	}{
+		{"other.example.com", "", "jane"},
+		{"pop.example.com", "", "john"},
+		{"pop.example.com", "anonymous", "anonymous"},
+		{"unknown.example.com", "", "anonymous"},
+	}
+	for _, tt := range tests {
+		e, ok := lookupNetrc(entries, tt.host, tt.user)
+		if !ok || e.login != tt.login {
+			t.Errorf("%s %s: expected: %s, got: %+v", tt.host, tt.user, tt.login, e)
+		}
+	}
+	if e, ok := lookupNetrc(entries, "pop.example.com", "jane"); ok {
+		t.Errorf("expected no entry for another user, got: %+v", e)
+	}
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(netrc, []byte(testNetrc), 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	a := &app{netrc: netrc, getenv: env(nil)}
+	user, password, err := a.credentials("pop.example.com")
+	if err != nil || user != "john" || password != "secret" {
+		t.Errorf("unexpected netrc credentials: %s %s %v", user, password, err)
+	}
+
+	a = &app{netrc: netrc, getenv: env(map[string]string{"POP3_USER": "jane", "POP3_PASSWORD": "env"})}
+	user, password, err = a.credentials("pop.example.com")
+	if err != nil || user != "jane" || password != "env" {
+		t.Errorf("environment must win: %s %s %v", user, password, err)
+	}
+
+	a = &app{netrc: filepath.Join(t.TempDir(), "none"), user: "john", getenv: env(nil)}
+	if _, _, err = a.credentials("pop.example.com"); err == nil {
+		t.Errorf("expected error for missing netrc file")
+	}
+}
+
+func TestPasswordCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh is not available")
+	}
+	a := &app{user: "john", passwordCmd: "printf 'from-cmd\\nsecond line\\n'", netrc: os.DevNull, getenv: env(nil)}
+	_, password, err := a.credentials("pop.example.com")
+	if err != nil || password != "from-cmd" {
+		t.Errorf("unexpected password: %q %v", password, err)
+	}
+
+	if _, err = passwordCommand("echo failure >&2; exit 3"); err == nil {
+		t.Errorf("expected error for failing command")
+	}
+}
@@ -0,0 +1,147 @@
+// Command gop3 inspects and fetches the messages of a POP3
+// mailbox from the terminal.
+//
+// Usage:
+// 		gop3 [flags] <command> [arguments]
+//
+// Commands:
+// 		stat                     number and total size of the messages
+// 		list [msg]               sizes of the messages
+// 		uidl [msg]               unique-ids of the messages
+// 		top <msg> [lines]        headers and the first lines of the body
+// 		fetch [flags] [msg...]   retrieve the messages, all by default
+// 		delete <msg...>          delete the messages
+//
+// The password is taken from POP3_PASSWORD environment
+// variable, the output of -password-cmd, or the netrc file,
+// in that order. The username is taken from -user flag,
+// POP3_USER environment variable or the netrc file.
+//
+// Example:
+// 		POP3_USER=john POP3_PASSWORD=secret gop3 -addr pop.example.com -tls list
+// 		gop3 -addr pop.example.com -tls -auth plain fetch -maildir ~/Mail/inbox -delete
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Exit codes of the command.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// app keeps the global flags and the output of a run.
+type app struct {
+	addr        string
+	implicitTLS bool
+	startTLS    bool
+	insecure    bool
+	user        string
+	auth        string
+	passwordCmd string
+	netrc       string
+	json        bool
+	timeout     time.Duration
+
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+}
+
+// command is a subcommand of the tool.
+type command struct {
+	usage string
+	run   func(a *app, args []string) error
+}
+
+// commands keeps the subcommands by name.
+var commands = map[string]command{
+	"stat":   {"stat", (*app).stat},
+	"list":   {"list [msg]", (*app).list},
+	"uidl":   {"uidl [msg]", (*app).uidl},
+	"top":    {"top <msg> [lines]", (*app).top},
+	"fetch":  {"fetch [-eml dir | -maildir dir | -mbox file] [-delete] [msg...]", (*app).fetch},
+	"delete": {"delete <msg...>", (*app).delete},
+}
+
+// commandOrder is the order of the commands in the usage.
+var commandOrder = []string{"stat", "list", "uidl", "top", "fetch", "delete"}
+
+// usageError is returned for the wrong arguments. The usage
+// is printed with it.
+type usageError string
+
+// Error returns the message of the error.
+func (u usageError) Error() string {
+	return string(u)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr, os.Getenv))
+}
+
+// run parses the arguments and runs the command. It returns
+// the exit code.
+//
+// args []string - arguments without the program name.
+// stdout io.Writer - output of the command.
+// stderr io.Writer - output of the errors and the usage.
+// getenv func(string) string - environment lookup.
+func run(args []string, stdout, stderr io.Writer, getenv func(string) string) int {
+	a := &app{stdout: stdout, stderr: stderr, getenv: getenv}
+	fs := flag.NewFlagSet("gop3", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&a.addr, "addr", getenv("POP3_ADDR"), "server `host[:port]`; default port is 995 with -tls, 110 otherwise (env POP3_ADDR)")
+	fs.BoolVar(&a.implicitTLS, "tls", false, "connect with implicit TLS")
+	fs.BoolVar(&a.startTLS, "starttls", false, "upgrade the connection with STLS")
+	fs.BoolVar(&a.insecure, "insecure", false, "do not verify the certificate of the server")
+	fs.StringVar(&a.user, "user", "", "username (env POP3_USER)")
+	fs.StringVar(&a.auth, "auth", "user", "authentication `mechanism`: user, apop, plain, login, cram-md5, scram-sha-1, scram-sha-256, xoauth2, oauthbearer")
+	fs.StringVar(&a.passwordCmd, "password-cmd", "", "shell `command` which prints the password or the token")
+	fs.StringVar(&a.netrc, "netrc", "", "netrc `file` (default ~/.netrc)")
+	fs.BoolVar(&a.json, "json", false, "print the output as JSON")
+	fs.DurationVar(&a.timeout, "timeout", time.Minute, "timeout of dialing and every command")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: gop3 [flags] <command> [arguments]")
+		fmt.Fprintln(stderr, "\nCommands:")
+		for _, name := range commandOrder {
+			fmt.Fprintln(stderr, "  "+commands[name].usage)
+		}
+		fmt.Fprintln(stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "gop3: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err := cmd.run(a, fs.Args()[1:]); err != nil {
+		fmt.Fprintln(stderr, "gop3: "+err.Error())
+		if _, ok := err.(usageError); ok {
+			fmt.Fprintln(stderr, "Usage: gop3 [flags] "+cmd.usage)
+			return exitUsage
+		}
+		return exitError
+	}
+	return exitOK
+}
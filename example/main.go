@@ -17,8 +17,9 @@ func main() {
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
-	fmt.Print(pop.GreetingMsg())    // Message starts with "+OK"
-	fmt.Println(pop.IsAuthorized()) // true
+	fmt.Println(pop.GreetingMsg())  // Message starts with "+OK"
+	fmt.Println(pop.State())        // AUTHORIZATION
+	fmt.Println(pop.IsAuthorized()) // false, the user is not logged in yet
 	fmt.Println(pop.IsEncrypted())  // true
 
 	username := os.Getenv(userKey)
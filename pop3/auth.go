@@ -1,31 +1,120 @@
 package pop3
 
 import (
+	"bufio"
+	"context"
+	"crypto/md5"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3/sasl"
 )
 
 // Client is POP3 client. Keeps the net.Conn, Addr of the POP3
 // server's address, GreetingMsg of the POP3 server when connection
-// established, and IsAuthorized boolean value when AUTHORIZATION
-// state completed.
+// established, and the State of the session. Client is safe for
+// concurrent use by multiple goroutines. Every command and its
+// response are sent and read while holding the lock, so commands
+// of different goroutines do not interleave on the wire. The
+// exported fields must not be changed while commands are running.
 type Client struct {
+	// mu serializes the commands. It is held from sending the
+	// command until reading the whole response.
+	mu sync.Mutex
+
 	// Conn is connection for POP3 clients.
 	Conn net.Conn
 
+	// r is the buffered reader of Conn. All responses
+	// are read through it.
+	r *bufio.Reader
+
+	// dc wraps Conn to apply the timeouts and the context
+	// deadlines of the commands.
+	dc *deadlineConn
+
+	// ReadTimeout is the default timeout of every read from
+	// the server. Zero means no timeout.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the default timeout of every write to
+	// the server. Zero means no timeout.
+	WriteTimeout time.Duration
+
 	// Addr is POP3 address.
 	Addr string
 
 	// greetingMsg keeps server response in AUTHORIZATION state.
 	greetingMsg string
 
-	// isAuthorized keeps status of AUTHORIZATION state.
-	isAuthorized bool
+	// state keeps the state of the session.
+	state State
 
 	// isEncrypted stands for whether mail server encrypted with TLS.
 	isEncrypted bool
+
+	// caps keeps the capabilities returned by the last
+	// CAPA command.
+	caps *Capabilities
+
+	// activeReader is true while the message reader
+	// returned by RetrReader is not closed.
+	activeReader bool
+
+	// readerDone is closed when the message reader is
+	// closed, so the waiting commands can go on.
+	readerDone chan struct{}
+
+	// Trace records every line which is sent or received. The
+	// secrets are redacted. If it is <nil>, nothing is traced.
+	Trace Tracer
+
+	// inAuth is true during the SASL exchange, so its lines
+	// are redacted in the trace.
+	inAuth bool
+
+	// traceBody counts the traced body lines of the current
+	// multi-line response.
+	traceBody int
+
+	// Logger receives the connection events, the results of
+	// the logins and the commands with their latency. Commands
+	// are logged at debug level. If it is <nil>, nothing is
+	// logged.
+	Logger *slog.Logger
+
+	// username is the username of the last USER or APOP
+	// command, for the logs.
+	username string
+
+	// Observer receives the name, duration, sizes and outcome
+	// of every command. If it is <nil>, nothing is observed.
+	Observer Observer
+
+	// PipelineWindow is the number of the commands which the
+	// batch commands, such as DeleMany, send before reading
+	// their responses when the server supports PIPELINING.
+	// Zero means DefaultPipelineWindow.
+	PipelineWindow int
+
+	// logCtx, cmdAddr, cmd, status, respBytes, sentBytes and
+	// cmdStart describe the running command for the logs and
+	// the Observer. cmdAddr is kept because QUIT clears Addr.
+	logCtx    context.Context
+	cmdAddr   string
+	cmd       string
+	status    string
+	respBytes int64
+	sentBytes int64
+	cmdStart  time.Time
 }
 
 const (
@@ -36,9 +125,15 @@ const (
 	e = "-ERR"
 )
 
+// ErrNoTimestamp is returned by Apop when the server's greeting
+// message does not contain a timestamp. Such servers do not
+// support APOP command.
+var ErrNoTimestamp = errors.New("greeting message has no APOP timestamp")
+
 // Connect create and make a connection with POP3
 // server. Takes only address of the POP3 server and
-// returns Client and error.
+// returns Client and error. It is a shortcut of
+// Dialer without timeout.
 //
 // addr string - POP3 mail server address. It contains
 // host and port number.
@@ -49,58 +144,120 @@ const (
 // isEncryptedTLS bool - Indicates that POP3 server whether
 // is encrypted. You can pass false the server is not
 // encrypted.
-func Connect(addr string, tlsConf *tls.Config, isEncryptedTLS bool) (Client, error) {
+func Connect(addr string, tlsConf *tls.Config, isEncryptedTLS bool) (*Client, error) {
+	d := &Dialer{TLSConfig: tlsConf}
 	if isEncryptedTLS {
-		return connectPOP3TLS(addr, tlsConf)
+		d.Mode = ModeTLS
 	}
-	return connectPOP3(addr)
+	return d.Dial(addr)
 }
 
-// connectPOP3TLS connects to given address and returns
-// a POP3 (encrypted with TLS) Client. This function is specialized
-// for TLS encrypted POP3 servers (995 port).
+// ConnectStartTLS connects to the POP3 server over plain
+// TCP and immediately upgrades the connection to TLS with
+// STLS command (RFC 2595). If the server refuses STLS or the
+// TLS handshake fails, the connection is closed and an error
+// is returned, so the session never continues in plaintext.
 //
-// addr string - POP3 server address.
-// config *tls.Config -  TLS configuration for POP3 server.
-func connectPOP3TLS(addr string, config *tls.Config) (Client, error) {
-	c := &Client{
-		isEncrypted: true,
-	}
+// addr string - POP3 mail server address. POP3 default
+// port: 110
+// tlsConf *tls.Config - TLS configuration. You can pass
+// <nil> if there is no configuration.
+func ConnectStartTLS(addr string, tlsConf *tls.Config) (*Client, error) {
+	d := &Dialer{TLSConfig: tlsConf, Mode: ModeStartTLS}
+	return d.Dial(addr)
+}
 
-	tlsConn, err := tls.Dial("tcp", addr, config)
-	if err != nil {
-		return *c, err
-	}
-	c.Conn = tlsConn
-	c.Addr = addr
+// StartTLS upgrades the plaintext connection to TLS with
+// STLS command. It can be used only in AUTHORIZATION state
+// before login. If the server response starts with "+OK",
+// TLS handshake is done and Conn is replaced with the TLS
+// connection. Cached capabilities are dropped because the
+// server may announce different capabilities after the
+// upgrade.
+// Example:
+// 		C: STLS
+// 		S: +OK Begin TLS negotiation
+// 		<TLS negotiation>
+//
+// config *tls.Config - TLS configuration. If it is <nil>
+// or ServerName is empty, the host of Addr is used as
+// ServerName.
+func (c *Client) StartTLS(config *tls.Config) error {
+	return c.StartTLSContext(context.Background(), config)
+}
 
-	err = c.readGreetingMsg()
+// StartTLSContext is the context-aware version of StartTLS.
+func (c *Client) StartTLSContext(ctx context.Context, config *tls.Config) error {
+	end, err := c.begin(ctx)
 	if err != nil {
-		return Client{}, err
+		return err
 	}
-	return *c, nil
+	return end(c.startTLS(ctx, config))
 }
 
-// connectPOP3 connects to given address and returns
-// a POP3 Client. This function is implementation of
-// Connect() function. Reads server's response sending
-// after connecting POP3 server.
-func connectPOP3(addr string) (Client, error) {
-	c := &Client{}
+// startTLS is the implementation of the StartTLS function.
+func (c *Client) startTLS(ctx context.Context, config *tls.Config) error {
+	if err := c.checkState("STLS", StateAuthorization); err != nil {
+		return err
+	}
+	if c.isEncrypted {
+		return fmt.Errorf("connection is already encrypted")
+	}
+
+	err := c.sendCmd("STLS")
+	if err != nil {
+		return err
+	}
 
-	conn, err := net.Dial("tcp", addr)
+	resp, err := c.readResp()
 	if err != nil {
-		return *c, err
+		return err
+	}
+	if err = respErr("STLS", resp); err != nil {
+		return err
+	}
+	// The data which is sent after the response in plaintext
+	// would be read as if it came over TLS (RFC 2595, section
+	// 8), so the connection is closed.
+	if c.reader().Buffered() > 0 {
+		c.abort()
+		return ProtocolError("unexpected data after STLS response")
 	}
-	c.Conn = conn
-	c.Addr = addr
 
-	err = c.readGreetingMsg()
+	tlsConn := tls.Client(c.Conn, tlsConfigFor(c.Addr, config))
+	err = tlsConn.HandshakeContext(ctx)
+	logTLS(ctx, c.Logger, tlsConn, err)
 	if err != nil {
-		return Client{}, err
+		return err
+	}
+
+	c.setConn(tlsConn)
+	c.isEncrypted = true
+	c.caps = nil
+	return nil
+}
+
+// tlsConfigFor returns a TLS configuration which has
+// ServerName. If config does not set ServerName, it is
+// copied and the host part of addr is used.
+//
+// addr string - POP3 server address.
+// config *tls.Config - TLS configuration, may be <nil>.
+func tlsConfigFor(addr string, config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName != "" || config.InsecureSkipVerify {
+		return config
 	}
 
-	return *c, nil
+	config = config.Clone()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	config.ServerName = host
+	return config
 }
 
 // readGreetingMsg reads the server response
@@ -110,26 +267,21 @@ func connectPOP3(addr string) (Client, error) {
 // Returns error if reading or response message
 // fails.
 func (c *Client) readGreetingMsg() error {
-	// buffer for reading server's response
-	// message in AUTHORIZATION state.
-	// Response message length may be up to
-	// 512 characters.
-	var buf [512]byte
-
-	r, err := c.Conn.Read(buf[:])
+	resp, err := c.readResp()
 	if err != nil {
 		return err
 	}
-	resp := string(buf[:r])
 
 	// If AUTHORIZATION state fails wrt greeting
 	// message, returns an error.
 	if !c.isAuth(resp) {
+		c.log(slog.LevelWarn, "pop3: greeting failed", slog.String(LogKeyMsg, resp))
 		e := "not authorized to POP3 server"
 		return fmt.Errorf(e)
 	}
+	c.log(slog.LevelInfo, "pop3: greeting", slog.String(LogKeyMsg, resp))
 	c.greetingMsg = resp
-	c.isAuthorized = true
+	c.state = StateAuthorization
 
 	return nil
 }
@@ -150,9 +302,20 @@ func (c *Client) isAuth(greeting string) bool {
 // server. It just sends "QUIT" command and get
 // response from the server. The Quit function
 // returns server response and error. Server
-// response may start with "+OK" or "-ERR".
+// response may start with "+OK" or "-ERR". If it
+// starts with "-ERR", *ServerError is returned too.
 func (c *Client) Quit() (string, error) {
-	return c.quit()
+	return c.QuitContext(context.Background())
+}
+
+// QuitContext is the context-aware version of Quit.
+func (c *Client) QuitContext(ctx context.Context) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.quit()
+	return resp, end(err)
 }
 
 // quit is implementation of the Quit()
@@ -160,7 +323,12 @@ func (c *Client) Quit() (string, error) {
 // server. Closes Conn if server response
 // contains "+OK".
 func (c *Client) quit() (string, error) {
-	err := c.sendQuitCmd()
+	err := c.checkState("QUIT", StateAuthorization, StateTransaction)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.sendQuitCmd()
 	if err != nil {
 		return "", err
 	}
@@ -173,9 +341,10 @@ func (c *Client) quit() (string, error) {
 	if isQuit(qResp) {
 		c.Conn.Close()
 		c.changeClientState()
+		c.log(slog.LevelInfo, "pop3: quit", slog.String(LogKeyMsg, qResp))
 	}
 
-	return qResp, nil
+	return qResp, respErr("QUIT", qResp)
 }
 
 // isQuit checks the server response after
@@ -194,10 +363,8 @@ func isQuit(resp string) bool {
 // It indicates that command is terminated.
 // The function returns error if occurs while
 // sending command.
-func (c Client) sendQuitCmd() error {
-	buf := []byte("QUIT\r\n")
-	_, err := c.Conn.Write(buf)
-	return err
+func (c *Client) sendQuitCmd() error {
+	return c.writeLine("QUIT")
 }
 
 // readQuitResp reads the response message that comes
@@ -206,41 +373,333 @@ func (c Client) sendQuitCmd() error {
 // which starts with "+OK". Returns the response msg and
 // error if occurs.
 func (c *Client) readQuitResp() (string, error) {
-	var buf [512]byte
-	r, err := c.Conn.Read(buf[:])
-	if err != nil {
-		return "", err
-	}
-	resp := string(buf[:r])
-	return resp, nil
+	return c.readResp()
 }
 
 // changeClientState changes the client's state
 // after Quit command. If the Quit command is
-// successful, Conn, Addr, GreetingMsg, IsAuthorized
-// variables changed to nil/empty strings.
+// successful, Conn, Addr, GreetingMsg variables
+// changed to nil/empty strings. The session enters
+// UPDATE state if the user was logged in, otherwise
+// it is disconnected.
 func (c *Client) changeClientState() {
+	if c.state == StateTransaction {
+		c.state = StateUpdate
+	} else {
+		c.state = StateDisconnected
+	}
 	c.Conn = nil
+	c.dc = nil
+	c.r = nil
 	c.Addr = ""
 	c.greetingMsg = ""
-	c.isAuthorized = false
+	c.caps = nil
+}
+
+// Apop authenticates the user with APOP command which is an
+// alternative of USER and PASS commands. The password is never
+// sent over the network. Instead, the client sends MD5 digest of
+// the timestamp in the greeting message concatenated with the
+// shared secret. If the greeting message contains no timestamp,
+// ErrNoTimestamp is returned. The function returns server response
+// and error like Pass function. If the server response starts with
+// "+OK", the session enters TRANSACTION state.
+// Example:
+// 		S: +OK POP3 server ready <1896.697170952@dbc.mtview.ca.us>
+// 		C: APOP mrose c4c9334bac560ecc979e58001b3e22fb
+// 		S: +OK maildrop has 1 message (369 octets)
+//
+// name string - username of the mailbox
+// secret string - shared secret between client and server
+func (c *Client) Apop(name, secret string) (string, error) {
+	return c.ApopContext(context.Background(), name, secret)
+}
+
+// ApopContext is the context-aware version of Apop.
+func (c *Client) ApopContext(ctx context.Context, name, secret string) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.apop(name, secret)
+	c.logAuth("APOP", "", err)
+	return resp, end(err)
+}
+
+// apop is the implementation of the Apop function. It extracts
+// the timestamp from the greeting message, computes the digest,
+// sends the APOP command and reads the server response.
+func (c *Client) apop(name, secret string) (string, error) {
+	err := c.checkState("APOP", StateAuthorization)
+	if err != nil {
+		return "", err
+	}
+
+	ts, err := apopTimestamp(c.greetingMsg)
+	if err != nil {
+		return "", err
+	}
+
+	c.username = name
+	arg := name + " " + apopDigest(ts, secret)
+	err = c.sendCmdWithArg("APOP", arg)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.readResp()
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(resp, ok) {
+		c.state = StateTransaction
+		c.caps = nil
+	}
+	return resp, respErr("APOP", resp)
+}
+
+// apopTimestamp extracts the timestamp from the greeting
+// message. Timestamp is a msg-id which is enclosed with
+// angle brackets, e.g. <1896.697170952@dbc.mtview.ca.us>.
+// It returns ErrNoTimestamp if the greeting message does
+// not contain a timestamp.
+//
+// greeting string - greeting message of the server.
+func apopTimestamp(greeting string) (string, error) {
+	start := strings.Index(greeting, "<")
+	if start < 0 {
+		return "", ErrNoTimestamp
+	}
+	end := strings.Index(greeting[start:], ">")
+	if end < 0 {
+		return "", ErrNoTimestamp
+	}
+	ts := greeting[start : start+end+1]
+	if !strings.Contains(ts, "@") {
+		return "", ErrNoTimestamp
+	}
+	return ts, nil
+}
+
+// apopDigest returns the MD5 digest of the timestamp
+// followed by the shared secret as 32 lowercase hex
+// characters.
+func apopDigest(timestamp, secret string) string {
+	sum := md5.Sum([]byte(timestamp + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// maxAuthLine is the maximum length of AUTH command with
+// initial response. Longer initial responses are sent after
+// the first server challenge (RFC 5034).
+const maxAuthLine = 255
+
+// Auth authenticates the user with AUTH command which is
+// defined in RFC 5034. The SASL exchange is driven by the
+// given mechanism. Challenges and responses are base64
+// encoded lines. If the mechanism fails while answering a
+// challenge, the exchange is canceled with "*". The initial
+// response is sent with AUTH command when the cached
+// capabilities (see Capa) announce SASL-IR or the SASL
+// mechanism itself, otherwise it is sent after the first
+// empty challenge. If the connection is encrypted with TLS,
+// mechanisms implementing sasl.ChannelBinder receive the TLS
+// connection state for channel binding (e.g. SCRAM-SHA-256-PLUS).
+// If the server response starts with "+OK", the session enters
+// TRANSACTION state unless a sasl.Completer mechanism could not
+// verify the server. In that case the server may be an impostor
+// which has already accepted the session, so the connection is
+// closed and the session is disconnected. Negative responses are
+// returned as error. If a sasl.Failer mechanism decodes the
+// reason from the last challenge, e.g. *sasl.OAuthError, the
+// error wraps it together with *ServerError.
+// Example:
+// 		C: AUTH PLAIN dGVzdAB0ZXN0AHRlc3Q=
+// 		S: +OK Maildrop locked and ready
+//
+// mech sasl.Mechanism - SASL mechanism, e.g. sasl.NewPlainClient
+func (c *Client) Auth(mech sasl.Mechanism) (string, error) {
+	return c.AuthContext(context.Background(), mech)
+}
+
+// AuthContext is the context-aware version of Auth.
+func (c *Client) AuthContext(ctx context.Context, mech sasl.Mechanism) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.auth(mech)
+	return resp, end(err)
+}
+
+// auth is the implementation of the Auth function.
+func (c *Client) auth(mech sasl.Mechanism) (resp string, err error) {
+	if err := c.checkState("AUTH", StateAuthorization); err != nil {
+		return "", err
+	}
+
+	if b, ok := mech.(sasl.ChannelBinder); ok {
+		if tlsConn, ok := c.Conn.(*tls.Conn); ok {
+			b.BindTLS(tlsConn.ConnectionState())
+		}
+	}
+
+	name, ir, err := mech.Start()
+	if err != nil {
+		return "", err
+	}
+	defer func() { c.logAuth("AUTH", name, err) }()
+
+	c.inAuth = true
+	defer func() { c.inAuth = false }()
+
+	cmd := "AUTH " + name
+	if ir != nil && c.canSendIR(name) {
+		line := cmd + " " + encodeSASL(ir)
+		if len(line) <= maxAuthLine {
+			cmd = line
+			ir = nil
+		}
+	}
+	err = c.sendCmd(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		resp, err := c.readResp()
+		if err != nil {
+			return "", err
+		}
+
+		if strings.HasPrefix(resp, ok) {
+			if v, ok := mech.(sasl.Completer); ok {
+				if err = v.Complete(); err != nil {
+					// The server has entered TRANSACTION state but
+					// it is not verified, so the session is not used.
+					c.abort()
+					return resp, err
+				}
+			}
+			c.state = StateTransaction
+			c.caps = nil
+			return resp, nil
+		}
+		if !strings.HasPrefix(resp, "+") {
+			if f, ok := mech.(sasl.Failer); ok && f.Failure() != nil {
+				return resp, &authFailure{resp: respErr("AUTH", resp), cause: f.Failure()}
+			}
+			return resp, respErr("AUTH", resp)
+		}
+
+		// Pending initial response is sent as the answer of
+		// the first challenge.
+		if ir != nil {
+			err = c.sendCmd(base64.StdEncoding.EncodeToString(ir))
+			ir = nil
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(resp[1:]))
+		if err != nil {
+			return c.cancelAuth(name, fmt.Errorf("malformed challenge: %w", err))
+		}
+		answer, err := mech.Next(challenge)
+		if err != nil {
+			return c.cancelAuth(name, err)
+		}
+		err = c.sendCmd(base64.StdEncoding.EncodeToString(answer))
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// authFailure is returned by Auth when the server rejects the
+// authentication after a sasl.Failer mechanism decoded the
+// reason from the last challenge. It wraps both errors, so
+// errors.Is(err, ErrAuth) and errors.As with *ServerError or
+// *sasl.OAuthError match it.
+type authFailure struct {
+	// resp is the error of the negative response, usually
+	// *ServerError.
+	resp error
+
+	// cause is the error of the mechanism, e.g. *sasl.OAuthError.
+	cause error
+}
+
+// Error returns the server response and the decoded reason.
+func (a *authFailure) Error() string {
+	return a.resp.Error() + ": " + a.cause.Error()
+}
+
+// Unwrap returns the error of the response and the error of
+// the mechanism.
+func (a *authFailure) Unwrap() []error {
+	return []error{a.resp, a.cause}
+}
+
+// cancelAuth cancels the ongoing SASL exchange by sending
+// "*" and reads the server response. The returned error
+// wraps the cause of the cancellation.
+func (c *Client) cancelAuth(mech string, cause error) (string, error) {
+	err := c.sendCmd("*")
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.readResp()
+	if err != nil {
+		return "", err
+	}
+	return resp, fmt.Errorf("AUTH %s canceled: %w", mech, cause)
+}
+
+// canSendIR reports whether the initial response can be
+// sent with AUTH command, according to cached capabilities.
+func (c *Client) canSendIR(mech string) bool {
+	if c.caps == nil {
+		return false
+	}
+	return c.caps.Has("SASL-IR") || c.caps.HasSASL(mech)
+}
+
+// encodeSASL encodes the initial response with base64.
+// Empty response is encoded as "=".
+func encodeSASL(ir []byte) string {
+	if len(ir) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(ir)
 }
 
 // GreetingMsg returns the greeting message which
 // server response when connected to mail server.
 // The message is returned in AUTHORIZATION state.
 func (c *Client) GreetingMsg() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.greetingMsg
 }
 
-// IsAuthorized returns the information that
-// keeps the status of AUTHORIZATION state.
+// IsAuthorized reports whether the user logged in
+// successfully, i.e. the session is in TRANSACTION
+// state.
 func (c *Client) IsAuthorized() bool {
-	return c.isAuthorized
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state == StateTransaction
 }
 
 // IsEncrypted returns the information whether
 // the server is encrypted with TLS.
 func (c *Client) IsEncrypted() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.isEncrypted
 }
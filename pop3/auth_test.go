@@ -1,15 +1,21 @@
-package pop3
+package pop3_test
 
 import (
+	"crypto/tls"
+	"errors"
 	"strings"
 	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+	"github.com/gozeloglu/gop-3/pop3/sasl"
 )
 
-var c = Client{}
+var c = pop3.Client{}
 
 func TestIsAuth(t *testing.T) {
 	resp := "+OK Hello POP3 Server"
-	auth := c.isAuth(resp)
+	auth := c.IsAuth(resp)
 
 	if !auth {
 		t.Errorf("Expected: %v, got: %v.", true, auth)
@@ -18,7 +24,7 @@ func TestIsAuth(t *testing.T) {
 
 func TestIsAuthFalse(t *testing.T) {
 	resp := "-ERR Some problem"
-	auth := c.isAuth(resp)
+	auth := c.IsAuth(resp)
 
 	if auth {
 		t.Errorf("Expected: %v, got: %v.", false, auth)
@@ -26,8 +32,11 @@ func TestIsAuthFalse(t *testing.T) {
 }
 
 func TestConnect(t *testing.T) {
-	addr := "mail.btopenworld.com:110"
-	pop, err := Connect(addr, nil, false)
+	addr := newTestServer(t, false).Addr
+	pop, err := pop3.Connect(addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
 
 	if pop.Conn == nil {
 		t.Errorf("c.Conn is nil.")
@@ -35,8 +44,11 @@ func TestConnect(t *testing.T) {
 	if err != nil {
 		t.Errorf(err.Error())
 	}
-	if !pop.IsAuthorized() {
-		t.Errorf("Expected: %v, got: %v", true, pop.isAuthorized)
+	if pop.IsAuthorized() {
+		t.Errorf("Expected: %v, got: %v", false, pop.IsAuthorized())
+	}
+	if pop.State() != pop3.StateAuthorization {
+		t.Errorf("Expected: %v, got: %v", pop3.StateAuthorization, pop.State())
 	}
 	if pop.Addr != addr {
 		t.Errorf("Expected: %s, got: %s", addr, pop.Addr)
@@ -44,8 +56,12 @@ func TestConnect(t *testing.T) {
 }
 
 func TestConnectTLS(t *testing.T) {
-	addr := "mail.btopenworld.com:995"
-	pop, err := Connect(addr, nil, true)
+	srv := newTestServer(t, true)
+	addr := srv.Addr
+	pop, err := pop3.Connect(addr, srv.ClientTLSConfig(), true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
 
 	if pop.Conn == nil {
 		t.Errorf("c.Conn is nil.")
@@ -53,8 +69,11 @@ func TestConnectTLS(t *testing.T) {
 	if err != nil {
 		t.Errorf(err.Error())
 	}
-	if !pop.IsAuthorized() {
-		t.Errorf("Expected: %v, got: %v", true, pop.IsAuthorized())
+	if pop.IsAuthorized() {
+		t.Errorf("Expected: %v, got: %v", false, pop.IsAuthorized())
+	}
+	if pop.State() != pop3.StateAuthorization {
+		t.Errorf("Expected: %v, got: %v", pop3.StateAuthorization, pop.State())
 	}
 	if pop.Addr != addr {
 		t.Errorf("Expected: %s, got: %s", addr, pop.Addr)
@@ -62,8 +81,11 @@ func TestConnectTLS(t *testing.T) {
 }
 
 func TestClient_Quit(t *testing.T) {
-	addr := "mail.btopenworld.com:110"
-	pop, err := Connect(addr, nil, false)
+	addr := newTestServer(t, false).Addr
+	pop, err := pop3.Connect(addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
 
 	if pop.Conn == nil {
 		t.Errorf("c.Conn is nil.")
@@ -85,8 +107,11 @@ func TestClient_Quit(t *testing.T) {
 }
 
 func TestClientTLS_Quit(t *testing.T) {
-	addr := "mail.btopenworld.com:995"
-	popTLS, err := Connect(addr, nil, true)
+	srv := newTestServer(t, true)
+	popTLS, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
 
 	if popTLS.Conn == nil {
 		t.Errorf(err.Error())
@@ -105,9 +130,10 @@ func TestClientTLS_Quit(t *testing.T) {
 }
 
 func TestClient_IsEncrypted(t *testing.T) {
-	pop, err := Connect("pop.gmail.com:995", nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 	if !pop.IsEncrypted() {
 		t.Errorf("expected: %v, got: %v", true, pop.IsEncrypted())
@@ -115,9 +141,9 @@ func TestClient_IsEncrypted(t *testing.T) {
 }
 
 func TestClient_IsNotEncrypted(t *testing.T) {
-	pop, err := Connect("mail.pop3.com:110", nil, false)
+	pop, err := pop3.Connect(newTestServer(t, false).Addr, nil, false)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 	if pop.IsEncrypted() {
 		t.Errorf("expected: %v, got: %v", false, pop.IsEncrypted())
@@ -125,21 +151,308 @@ func TestClient_IsNotEncrypted(t *testing.T) {
 }
 
 func TestClient_IsAuthorized(t *testing.T) {
-	pop, err := Connect("mail.pop3.com:110", nil, false)
+	pop, err := pop3.Connect(newTestServer(t, false).Addr, nil, false)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
-	if !pop.IsAuthorized() {
-		t.Errorf("expected: %v, got: %v", true, pop.IsAuthorized())
+	if pop.IsAuthorized() {
+		t.Errorf("expected: %v, got: %v", false, pop.IsAuthorized())
 	}
 }
 
 func TestClient_GreetingMsg(t *testing.T) {
-	pop, err := Connect("mail.pop3.com:110", nil, false)
+	pop, err := pop3.Connect(newTestServer(t, false).Addr, nil, false)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 	if !strings.HasPrefix(pop.GreetingMsg(), ok) {
 		t.Errorf("expected: %s, got: %s", ok, pop.GreetingMsg())
 	}
 }
+
+func TestApopTimestamp(t *testing.T) {
+	greeting := "+OK POP3 server ready <1896.697170952@dbc.mtview.ca.us>\r\n"
+	ts, err := pop3.ApopTimestamp(greeting)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	exp := "<1896.697170952@dbc.mtview.ca.us>"
+	if ts != exp {
+		t.Errorf("expected: %s, got: %s", exp, ts)
+	}
+}
+
+func TestApopTimestampMissing(t *testing.T) {
+	for _, g := range []string{"+OK POP3 server ready", "+OK <no-at-sign>", "+OK <unterminated@host"} {
+		_, err := pop3.ApopTimestamp(g)
+		if err != pop3.ErrNoTimestamp {
+			t.Errorf("expected: %v, got: %v", pop3.ErrNoTimestamp, err)
+		}
+	}
+}
+
+func TestApopDigest(t *testing.T) {
+	// Example is taken from RFC 1939.
+	d := pop3.ApopDigest("<1896.697170952@dbc.mtview.ca.us>", "tanstaaf")
+	exp := "c4c9334bac560ecc979e58001b3e22fb"
+	if d != exp {
+		t.Errorf("expected: %s, got: %s", exp, d)
+	}
+}
+
+func TestClient_ApopNoTimestamp(t *testing.T) {
+	pop := pop3.NewTestClient(nil, pop3.StateAuthorization)
+	pop.SetGreeting("+OK POP3 server ready")
+	_, err := pop.Apop("mrose", "tanstaaf")
+	if err != pop3.ErrNoTimestamp {
+		t.Errorf("expected: %v, got: %v", pop3.ErrNoTimestamp, err)
+	}
+}
+
+func TestTLSConfigFor(t *testing.T) {
+	conf := pop3.TLSConfigFor("mail.btopenworld.com:110", nil)
+	if conf.ServerName != "mail.btopenworld.com" {
+		t.Errorf("expected: %s, got: %s", "mail.btopenworld.com", conf.ServerName)
+	}
+
+	orig := &tls.Config{MinVersion: tls.VersionTLS12}
+	conf = pop3.TLSConfigFor("pop.gmail.com:110", orig)
+	if conf == orig {
+		t.Errorf("expected a copy of the configuration")
+	}
+	if orig.ServerName != "" {
+		t.Errorf("original configuration is modified: %s", orig.ServerName)
+	}
+	if conf.ServerName != "pop.gmail.com" || conf.MinVersion != tls.VersionTLS12 {
+		t.Errorf("unexpected configuration: %+v", conf)
+	}
+
+	orig = &tls.Config{ServerName: "example.com"}
+	if conf = pop3.TLSConfigFor("pop.gmail.com:110", orig); conf != orig {
+		t.Errorf("expected the same configuration")
+	}
+}
+
+func TestClient_StartTLSAlreadyEncrypted(t *testing.T) {
+	pop := pop3.NewTestClient(nil, pop3.StateAuthorization)
+	pop.SetEncrypted(true)
+	if err := pop.StartTLS(nil); err == nil {
+		t.Errorf("expected error for encrypted connection")
+	}
+}
+
+func TestClient_StartTLSInjection(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "STLS", Send: "+OK Begin TLS negotiation\r\n+OK injected"},
+	)
+	var pe pop3.ProtocolError
+	if err := pop.StartTLS(nil); !errors.As(err, &pe) {
+		t.Fatalf("expected ProtocolError, got: %v", err)
+	}
+	if pop.State() != pop3.StateDisconnected || pop.Conn != nil {
+		t.Errorf("connection must be closed")
+	}
+}
+
+func TestClient_AuthPlain(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH PLAIN", Send: "+ "},
+		pop3test.Step{Expect: "AHVzZXIAc2VjcmV0", Send: "+OK Maildrop locked and ready"},
+	)
+
+	resp, err := pop.Auth(sasl.NewPlainClient("", "user", "secret"))
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if !strings.HasPrefix(resp, ok) {
+		t.Errorf("expected: %s, got: %s", ok, resp)
+	}
+	if pop.State() != pop3.StateTransaction {
+		t.Errorf("expected TRANSACTION state")
+	}
+}
+
+func TestClient_AuthPlainInitialResponse(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH PLAIN AHVzZXIAc2VjcmV0", Send: "+OK Maildrop locked and ready"},
+	)
+	pop.SetCaps(&pop3.Capabilities{SASL: []string{"PLAIN"}})
+
+	_, err := pop.Auth(sasl.NewPlainClient("", "user", "secret"))
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestClient_AuthLogin(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH LOGIN", Send: "+ VXNlcm5hbWU6"},
+		pop3test.Step{Expect: "dXNlcg==", Send: "+ UGFzc3dvcmQ6"},
+		pop3test.Step{Expect: "c2VjcmV0", Send: "-ERR [AUTH] Authentication failed"},
+	)
+
+	resp, err := pop.Auth(sasl.NewLoginClient("user", "secret"))
+	if err == nil {
+		t.Errorf("expected error, got: %s", resp)
+	}
+	if pop.State() != pop3.StateAuthorization {
+		t.Errorf("expected AUTHORIZATION state")
+	}
+}
+
+func TestClient_AuthCancel(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH PLAIN", Send: "+ bW9yZQ=="},
+		pop3test.Step{Expect: "AHVzZXIAc2VjcmV0", Send: "+ bW9yZQ=="},
+		pop3test.Step{Expect: "*", Send: "-ERR AUTH canceled"},
+	)
+
+	_, err := pop.Auth(sasl.NewPlainClient("", "user", "secret"))
+	if !errors.Is(err, sasl.ErrUnexpectedChallenge) {
+		t.Errorf("expected: %v, got: %v", sasl.ErrUnexpectedChallenge, err)
+	}
+}
+
+func TestClient_AuthXOAuth2Failure(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH XOAUTH2 dXNlcj11c2VyQGV4YW1wbGUuY29tAWF1dGg9QmVhcmVyIGV4cGlyZWQBAQ==", Send: "+ eyJzdGF0dXMiOiI0MDEifQ=="},
+		pop3test.Step{Expect: "", Send: "-ERR [AUTH] Invalid credentials"},
+	)
+	pop.SetCaps(&pop3.Capabilities{SASL: []string{"XOAUTH2"}})
+
+	_, err := pop.Auth(sasl.NewXOAuth2Client("user@example.com", sasl.StaticToken("expired")))
+	var oerr *sasl.OAuthError
+	if !errors.As(err, &oerr) {
+		t.Fatalf("expected *sasl.OAuthError, got: %v", err)
+	}
+	if oerr.Status != "401" {
+		t.Errorf("expected: %s, got: %s", "401", oerr.Status)
+	}
+	var se *pop3.ServerError
+	if !errors.As(err, &se) || se.Cmd != "AUTH" {
+		t.Errorf("expected *pop3.ServerError of AUTH, got: %v", err)
+	}
+	if !errors.Is(err, pop3.ErrAuth) {
+		t.Errorf("expected: %v, got: %v", pop3.ErrAuth, err)
+	}
+}
+
+func TestClient_AuthScramUnverifiedServer(t *testing.T) {
+	// The client nonce is random, so the client-first-message
+	// is not checked. The server skips server-final-message.
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH SCRAM-SHA-256", Send: "+ "},
+		pop3test.Step{Expect: pop3test.AnyLine, Send: "+OK"},
+	)
+
+	_, err := pop.Auth(sasl.NewScramSHA256Client("user", "pencil"))
+	if err == nil {
+		t.Errorf("expected error for unverified server")
+	}
+	if pop.State() != pop3.StateDisconnected {
+		t.Errorf("expected: %v, got: %v", pop3.StateDisconnected, pop.State())
+	}
+	if _, err = pop.Noop(); err == nil {
+		t.Errorf("expected error on the closed connection")
+	}
+}
+
+func TestClient_AuthCramMD5(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH CRAM-MD5", Send: "+ PDE4OTYuNjk3MTcwOTUyQHBvc3RvZmZpY2UucmVzdG9uLm1jaS5uZXQ+"},
+		pop3test.Step{Expect: "dGltIGI5MTNhNjAyYzdlZGE3YTQ5NWI0ZTZlNzMzNGQzODkw", Send: "+OK CRAM authentication successful"},
+	)
+
+	_, err := pop.Auth(sasl.NewCramMD5Client("tim", "tanstaaftanstaaf"))
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if pop.State() != pop3.StateTransaction {
+		t.Errorf("expected TRANSACTION state")
+	}
+}
+
+func TestClient_ApopServer(t *testing.T) {
+	srv := newTestServer(t, false)
+	pop, err := pop3.Connect(srv.Addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	_, err = pop.Apop(testUser, "wrong")
+	if !errors.Is(err, pop3.ErrAuth) {
+		t.Errorf("expected: %v, got: %v", pop3.ErrAuth, err)
+	}
+	resp, err := pop.Apop(testUser, testPassword)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.HasPrefix(resp, ok) || !pop.IsAuthorized() {
+		t.Errorf("expected successful login, got: %s", resp)
+	}
+}
+
+func TestClient_AuthServer(t *testing.T) {
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	_, err = pop.Auth(sasl.NewLoginClient(testUser, testPassword))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pop.State() != pop3.StateTransaction {
+		t.Errorf("expected: %v, got: %v", pop3.StateTransaction, pop.State())
+	}
+}
+
+func TestClient_PassInUse(t *testing.T) {
+	srv := newTestServer(t, false)
+	first, err := pop3.Connect(srv.Addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	first.User(testUser)
+	if _, err = first.Pass(testPassword); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	second, err := pop3.Connect(srv.Addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	second.User(testUser)
+	_, err = second.Pass(testPassword)
+	if !errors.Is(err, pop3.ErrInUse) {
+		t.Errorf("expected: %v, got: %v", pop3.ErrInUse, err)
+	}
+}
+
+func TestConnectStartTLS(t *testing.T) {
+	srv := pop3test.NewUnstartedServer()
+	srv.STLS = true
+	srv.Start()
+	defer srv.Close()
+
+	pop, err := pop3.ConnectStartTLS(srv.Addr, srv.ClientTLSConfig())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !pop.IsEncrypted() {
+		t.Errorf("expected: %v, got: %v", true, pop.IsEncrypted())
+	}
+	if _, err = pop.Quit(); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestConnectStartTLSRefused(t *testing.T) {
+	srv := newTestServer(t, false)
+	_, err := pop3.ConnectStartTLS(srv.Addr, srv.ClientTLSConfig())
+	var se *pop3.ServerError
+	if !errors.As(err, &se) || se.Cmd != "STLS" {
+		t.Errorf("expected STLS *ServerError, got: %v", err)
+	}
+}
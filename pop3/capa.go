@@ -0,0 +1,346 @@
+package pop3
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExpireNever is the value of Capabilities.Expire when
+// the server never deletes retrieved messages by itself.
+const ExpireNever = -1
+
+// Capabilities keeps the capabilities that the server
+// announced in response to CAPA command. It is defined
+// in RFC 2449. Well-known capabilities are parsed into
+// fields, and every capability can be checked with Has
+// function.
+type Capabilities struct {
+	// Top indicates that the server supports TOP command.
+	Top bool
+
+	// User indicates that the server supports USER and
+	// PASS commands.
+	User bool
+
+	// UIDL indicates that the server supports UIDL command.
+	UIDL bool
+
+	// SASL keeps the SASL mechanisms which can be used
+	// with AUTH command.
+	SASL []string
+
+	// STLS indicates that the server supports STLS command.
+	STLS bool
+
+	// Pipelining indicates that the server accepts
+	// multiple commands at a time.
+	Pipelining bool
+
+	// RespCodes indicates that the server sends extended
+	// response codes in square brackets.
+	RespCodes bool
+
+	// AuthRespCode indicates that the server sends [AUTH]
+	// response code (RFC 3206).
+	AuthRespCode bool
+
+	// Expire is the number of days that the server keeps
+	// retrieved messages. It is ExpireNever if the server
+	// never deletes them. It is meaningful only if HasExpire
+	// is true; zero means that the messages are deleted after
+	// the session.
+	Expire int
+
+	// HasExpire indicates that the server announces EXPIRE
+	// capability.
+	HasExpire bool
+
+	// ExpireUser indicates that Expire may be different
+	// after the login ("EXPIRE n USER").
+	ExpireUser bool
+
+	// LoginDelay is the minimum number of seconds between
+	// logins. It is meaningful only if HasLoginDelay is true.
+	LoginDelay int
+
+	// HasLoginDelay indicates that the server announces
+	// LOGIN-DELAY capability.
+	HasLoginDelay bool
+
+	// LoginDelayUser indicates that LoginDelay may be
+	// different after the login ("LOGIN-DELAY n USER").
+	LoginDelayUser bool
+
+	// UTF8 indicates that the server supports UTF8 command
+	// (RFC 6856).
+	UTF8 bool
+
+	// Lang indicates that the server supports LANG command
+	// (RFC 6856).
+	Lang bool
+
+	// Implementation is the server's implementation name.
+	Implementation string
+
+	// raw keeps every capability name with its arguments.
+	// Names are stored in upper case.
+	raw map[string][]string
+}
+
+// Has reports whether the server announces the given
+// capability. The name is case-insensitive.
+//
+// name string - capability name, e.g. "PIPELINING"
+func (caps *Capabilities) Has(name string) bool {
+	_, found := caps.raw[strings.ToUpper(name)]
+	return found
+}
+
+// Args returns the arguments of the given capability.
+// It returns nil if the capability is not announced or
+// takes no argument.
+//
+// name string - capability name, e.g. "SASL"
+func (caps *Capabilities) Args(name string) []string {
+	return caps.raw[strings.ToUpper(name)]
+}
+
+// HasSASL reports whether the server announces the given
+// SASL mechanism. The name is case-insensitive.
+//
+// mech string - SASL mechanism name, e.g. "PLAIN"
+func (caps *Capabilities) HasSASL(mech string) bool {
+	for _, m := range caps.SASL {
+		if strings.EqualFold(m, mech) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lines returns the capabilities as the lines of CAPA
+// response. The fields are formatted first. The other
+// capabilities which are parsed from a CAPA response follow
+// them in alphabetical order. EXPIRE is sent if HasExpire is
+// true or Expire is not zero, and LOGIN-DELAY if HasLoginDelay
+// is true or LoginDelay is positive, so the parsed lines are
+// returned as they are.
+func (caps *Capabilities) Lines() []string {
+	var lines []string
+	add := func(set bool, line string) {
+		if set {
+			lines = append(lines, line)
+		}
+	}
+	add(caps.Top, "TOP")
+	add(caps.User, "USER")
+	add(caps.UIDL, "UIDL")
+	add(len(caps.SASL) > 0, "SASL "+strings.Join(caps.SASL, " "))
+	add(caps.STLS, "STLS")
+	add(caps.Pipelining, "PIPELINING")
+	add(caps.RespCodes, "RESP-CODES")
+	add(caps.AuthRespCode, "AUTH-RESP-CODE")
+	expire := strconv.Itoa(caps.Expire)
+	if caps.Expire == ExpireNever {
+		expire = "NEVER"
+	}
+	add(caps.HasExpire || caps.Expire != 0, "EXPIRE "+expire+userSuffix(caps.ExpireUser))
+	add(caps.HasLoginDelay || caps.LoginDelay > 0,
+		"LOGIN-DELAY "+strconv.Itoa(caps.LoginDelay)+userSuffix(caps.LoginDelayUser))
+	add(caps.UTF8, "UTF8")
+	add(caps.Lang, "LANG")
+	add(caps.Implementation != "", "IMPLEMENTATION "+caps.Implementation)
+
+	var others []string
+	for name := range caps.raw {
+		if !knownCapa[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		lines = append(lines, strings.TrimSpace(name+" "+strings.Join(caps.raw[name], " ")))
+	}
+	return lines
+}
+
+// userSuffix returns the USER argument of EXPIRE and
+// LOGIN-DELAY capabilities.
+//
+// user bool - whether the value depends on the user.
+func userSuffix(user bool) string {
+	if user {
+		return " USER"
+	}
+	return ""
+}
+
+// knownCapa keeps the capabilities which are parsed into the
+// fields of Capabilities.
+var knownCapa = map[string]bool{
+	"TOP": true, "USER": true, "UIDL": true, "SASL": true,
+	"STLS": true, "PIPELINING": true, "RESP-CODES": true,
+	"AUTH-RESP-CODE": true, "EXPIRE": true, "LOGIN-DELAY": true,
+	"UTF8": true, "LANG": true, "IMPLEMENTATION": true,
+}
+
+// Capa sends CAPA command and returns the capabilities
+// of the server. Capabilities may change after the login,
+// so the command may be sent in both AUTHORIZATION and
+// TRANSACTION states. The result is cached in Client and
+// can be checked with HasCapa function. The cache is cleared
+// after STLS and a successful login.
+// Example:
+// 		C: CAPA
+// 		S: +OK Capability list follows
+// 		S: TOP
+// 		S: USER
+// 		S: SASL CRAM-MD5 KERBEROS_V4
+// 		S: RESP-CODES
+// 		S: LOGIN-DELAY 900
+// 		S: PIPELINING
+// 		S: EXPIRE 60
+// 		S: UIDL
+// 		S: IMPLEMENTATION Shlemazle-Plotz-v302
+// 		S: .
+func (c *Client) Capa() (*Capabilities, error) {
+	return c.CapaContext(context.Background())
+}
+
+// CapaContext is the context-aware version of Capa.
+func (c *Client) CapaContext(ctx context.Context) (*Capabilities, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.capa()
+	return resp, end(err)
+}
+
+// capa is the implementation of the Capa function. It sends
+// the CAPA command, parses the response and caches it.
+func (c *Client) capa() (*Capabilities, error) {
+	err := c.checkState("CAPA", StateAuthorization, StateTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.sendCmd("CAPA")
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := c.readRespMultiLines()
+	if err != nil {
+		return nil, err
+	}
+	if err = respErr("CAPA", lines[0]); err != nil {
+		return nil, err
+	}
+
+	caps := parseCapabilities(lines[1:])
+	c.caps = caps
+	return caps, nil
+}
+
+// HasCapa reports whether the server announced the given
+// capability in the last CAPA response. It does not send
+// any command, so it returns false if Capa has not been
+// called yet.
+//
+// name string - capability name, e.g. "UIDL"
+func (c *Client) HasCapa(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.caps == nil {
+		return false
+	}
+	return c.caps.Has(name)
+}
+
+// parseCapabilities parses the lines of the CAPA response
+// which follow the status line. Arguments of EXPIRE and
+// LOGIN-DELAY which are not valid numbers are ignored; the
+// capability is still reported by Has, but HasExpire or
+// HasLoginDelay is false.
+//
+// lines []string - capability lines.
+func parseCapabilities(lines []string) *Capabilities {
+	caps := &Capabilities{raw: make(map[string][]string)}
+	for _, l := range lines {
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToUpper(fields[0])
+		args := fields[1:]
+		caps.raw[name] = args
+
+		switch name {
+		case "TOP":
+			caps.Top = true
+		case "USER":
+			caps.User = true
+		case "UIDL":
+			caps.UIDL = true
+		case "SASL":
+			caps.SASL = args
+		case "STLS":
+			caps.STLS = true
+		case "PIPELINING":
+			caps.Pipelining = true
+		case "RESP-CODES":
+			caps.RespCodes = true
+		case "AUTH-RESP-CODE":
+			caps.AuthRespCode = true
+		case "UTF8":
+			caps.UTF8 = true
+		case "LANG":
+			caps.Lang = true
+		case "IMPLEMENTATION":
+			caps.Implementation = strings.Join(args, " ")
+		case "EXPIRE":
+			if len(args) == 0 {
+				break
+			}
+			days := ExpireNever
+			if !strings.EqualFold(args[0], "NEVER") {
+				n, ok := capaNumber(args[0])
+				if !ok {
+					break
+				}
+				days = n
+			}
+			caps.HasExpire = true
+			caps.ExpireUser = len(args) > 1 && strings.EqualFold(args[1], "USER")
+			caps.Expire = days
+		case "LOGIN-DELAY":
+			if len(args) == 0 {
+				break
+			}
+			secs, ok := capaNumber(args[0])
+			if !ok {
+				break
+			}
+			caps.HasLoginDelay = true
+			caps.LoginDelayUser = len(args) > 1 && strings.EqualFold(args[1], "USER")
+			caps.LoginDelay = secs
+		}
+	}
+	return caps
+}
+
+// capaNumber parses the non-negative number argument of a
+// capability. It reports false if the argument is not a
+// valid number.
+//
+// arg string - argument of the capability, e.g. "900"
+func capaNumber(arg string) (int, bool) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,145 @@
+package pop3_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	lines := []string{
+		"TOP",
+		"USER",
+		"SASL CRAM-MD5 PLAIN",
+		"RESP-CODES",
+		"LOGIN-DELAY 900",
+		"PIPELINING",
+		"EXPIRE 60",
+		"UIDL",
+		"STLS",
+		"UTF8 USER",
+		"IMPLEMENTATION Shlemazle Plotz v302",
+	}
+	caps := pop3.ParseCapabilities(lines)
+
+	if !caps.Top || !caps.User || !caps.UIDL || !caps.STLS || !caps.Pipelining || !caps.RespCodes || !caps.UTF8 {
+		t.Errorf("expected all announced capabilities to be set, got: %+v", caps)
+	}
+	if caps.Lang {
+		t.Errorf("expected: %v, got: %v", false, caps.Lang)
+	}
+	if !reflect.DeepEqual(caps.SASL, []string{"CRAM-MD5", "PLAIN"}) {
+		t.Errorf("unexpected SASL mechanisms: %v", caps.SASL)
+	}
+	if !caps.HasSASL("plain") {
+		t.Errorf("expected PLAIN mechanism")
+	}
+	if caps.LoginDelay != 900 {
+		t.Errorf("expected: %d, got: %d", 900, caps.LoginDelay)
+	}
+	if caps.Expire != 60 {
+		t.Errorf("expected: %d, got: %d", 60, caps.Expire)
+	}
+	if caps.Implementation != "Shlemazle Plotz v302" {
+		t.Errorf("unexpected implementation: %s", caps.Implementation)
+	}
+	if !caps.Has("pipelining") || caps.Has("LANG") {
+		t.Errorf("Has reports wrong capabilities")
+	}
+	if !reflect.DeepEqual(caps.Args("UTF8"), []string{"USER"}) {
+		t.Errorf("unexpected UTF8 arguments: %v", caps.Args("UTF8"))
+	}
+}
+
+func TestParseCapabilitiesExpireNever(t *testing.T) {
+	caps := pop3.ParseCapabilities([]string{"EXPIRE NEVER"})
+	if caps.Expire != pop3.ExpireNever {
+		t.Errorf("expected: %d, got: %d", pop3.ExpireNever, caps.Expire)
+	}
+}
+
+func TestParseCapabilitiesMalformed(t *testing.T) {
+	for _, l := range []string{"EXPIRE", "EXPIRE soon", "EXPIRE -5", "LOGIN-DELAY", "LOGIN-DELAY x", "LOGIN-DELAY -1 USER"} {
+		caps := pop3.ParseCapabilities([]string{"TOP", l, "PIPELINING"})
+		if !caps.Top || !caps.Pipelining {
+			t.Errorf("the other capabilities must be parsed for %q", l)
+		}
+		if caps.HasExpire || caps.Expire != 0 || caps.HasLoginDelay || caps.LoginDelay != 0 {
+			t.Errorf("unparsable arguments must be ignored for %q, got: %+v", l, caps)
+		}
+		if name := strings.Fields(l)[0]; !caps.Has(name) {
+			t.Errorf("expected %s capability", name)
+		}
+	}
+}
+
+func TestClient_HasCapaNotFetched(t *testing.T) {
+	pop := pop3.Client{}
+	if pop.HasCapa("TOP") {
+		t.Errorf("expected: %v, got: %v", false, true)
+	}
+}
+
+func TestClient_Capa(t *testing.T) {
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	caps, err := pop.Capa()
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if !caps.User {
+		t.Errorf("expected USER capability")
+	}
+	if !pop.HasCapa("USER") {
+		t.Errorf("expected cached USER capability")
+	}
+}
+
+func TestCapabilities_Lines(t *testing.T) {
+	lines := []string{
+		"TOP",
+		"USER",
+		"UIDL",
+		"SASL PLAIN LOGIN",
+		"STLS",
+		"PIPELINING",
+		"RESP-CODES",
+		"EXPIRE NEVER",
+		"LOGIN-DELAY 900",
+		"IMPLEMENTATION Shlemazle-Plotz-v302",
+		"X-CUSTOM a b",
+	}
+	caps := pop3.ParseCapabilities(lines)
+	if got := caps.Lines(); !reflect.DeepEqual(got, lines) {
+		t.Errorf("expected: %v, got: %v", lines, got)
+	}
+
+	caps = &pop3.Capabilities{UIDL: true, Expire: 30}
+	expected := []string{"UIDL", "EXPIRE 30"}
+	if got := caps.Lines(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
+
+func TestCapabilities_LinesRoundTrip(t *testing.T) {
+	for _, lines := range [][]string{
+		{"EXPIRE 0", "LOGIN-DELAY 0"},
+		{"EXPIRE 60 USER", "LOGIN-DELAY 900 USER"},
+		{"EXPIRE NEVER USER"},
+	} {
+		caps := pop3.ParseCapabilities(lines)
+		again := pop3.ParseCapabilities(caps.Lines())
+		if !reflect.DeepEqual(again, caps) {
+			t.Errorf("expected: %+v, got: %+v", caps, again)
+		}
+		if got := again.Lines(); !reflect.DeepEqual(got, lines) {
+			t.Errorf("expected: %v, got: %v", lines, got)
+		}
+	}
+}
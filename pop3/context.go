@@ -0,0 +1,234 @@
+package pop3
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// aLongTimeAgo is a deadline in the past. It is set on the
+// connection to abort the blocked reads and writes.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// deadlineConn wraps the connection and sets the read or
+// write deadline before every read and write. The deadline
+// is the earliest of the default timeout and the deadline of
+// the command's context. Once the command is cancelled, all
+// reads and writes fail immediately.
+type deadlineConn struct {
+	net.Conn
+
+	mu           sync.Mutex
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	deadline     time.Time
+	canceled     bool
+}
+
+// Read sets the read deadline and reads from the connection.
+func (d *deadlineConn) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	err := d.Conn.SetReadDeadline(d.next(d.readTimeout))
+	d.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return d.Conn.Read(p)
+}
+
+// Write sets the write deadline and writes to the connection.
+func (d *deadlineConn) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	err := d.Conn.SetWriteDeadline(d.next(d.writeTimeout))
+	d.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return d.Conn.Write(p)
+}
+
+// next returns the deadline of the next read or write.
+// Zero time means no deadline. d.mu must be held.
+func (d *deadlineConn) next(timeout time.Duration) time.Time {
+	if d.canceled {
+		return aLongTimeAgo
+	}
+	var t time.Time
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	if !d.deadline.IsZero() && (t.IsZero() || d.deadline.Before(t)) {
+		t = d.deadline
+	}
+	return t
+}
+
+// start sets the timeouts and the context deadline of the
+// command.
+func (d *deadlineConn) start(deadline time.Time, readTimeout, writeTimeout time.Duration) {
+	d.mu.Lock()
+	d.deadline = deadline
+	d.readTimeout = readTimeout
+	d.writeTimeout = writeTimeout
+	d.canceled = false
+	d.mu.Unlock()
+}
+
+// cancel aborts the blocked reads and writes.
+func (d *deadlineConn) cancel() {
+	d.mu.Lock()
+	d.canceled = true
+	d.Conn.SetDeadline(aLongTimeAgo)
+	d.mu.Unlock()
+}
+
+// finish clears the context deadline of the command.
+func (d *deadlineConn) finish() {
+	d.mu.Lock()
+	d.deadline = time.Time{}
+	d.canceled = false
+	d.mu.Unlock()
+}
+
+// conn returns the deadline aware wrapper of Conn. It is
+// created again if Conn is replaced.
+func (c *Client) conn() *deadlineConn {
+	if c.dc == nil || c.dc.Conn != c.Conn {
+		c.dc = &deadlineConn{Conn: c.Conn}
+		c.r = nil
+	}
+	return c.dc
+}
+
+// begin locks the client and prepares the connection for a
+// command which is bound to ctx. The returned function must be
+// called with the result of the command. It unlocks the
+// client. See start for cancellation.
+//
+// ctx context.Context - context of the command.
+func (c *Client) begin(ctx context.Context) (func(error) error, error) {
+	c.mu.Lock()
+	end, err := c.start(ctx)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	return func(err error) error {
+		err = end(err)
+		c.mu.Unlock()
+		return err
+	}, nil
+}
+
+// start prepares the connection for a command which is bound
+// to ctx. The returned function must be called with the
+// result of the command. If the context is cancelled, the
+// blocked reads and writes are aborted, the connection is
+// closed because the response cannot be read anymore, and
+// the function returns the context's error. The same happens
+// if the read or write timeout expires. While the message
+// reader is open, it releases c.mu and waits until the reader
+// is closed or the context ends. c.mu must be held.
+//
+// ctx context.Context - context of the command.
+func (c *Client) start(ctx context.Context) (func(error) error, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	for c.activeReader {
+		done := c.readerDone
+		c.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			c.mu.Lock()
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+	if c.Conn == nil {
+		return func(err error) error { return err }, nil
+	}
+
+	dc := c.conn()
+	deadline, _ := ctx.Deadline()
+	dc.start(deadline, c.ReadTimeout, c.WriteTimeout)
+	c.startCmd(ctx)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			dc.cancel()
+		case <-stop:
+		}
+	}()
+
+	return func(err error) error {
+		close(stop)
+		<-done
+		dc.finish()
+		if err != nil && isTimeout(err) {
+			c.abort()
+			if cerr := ctxErr(ctx); cerr != nil {
+				err = cerr
+			}
+		}
+		c.observeCmd(err)
+		c.logCmd(err)
+		c.logCtx = nil
+		return err
+	}, nil
+}
+
+// abort closes the connection after a cancelled or timed out
+// command, or a response which is broken off. The session is
+// disconnected. It does nothing if the connection is already
+// closed.
+func (c *Client) abort() {
+	if c.Conn == nil {
+		return
+	}
+	c.Conn.Close()
+	c.Conn = nil
+	c.dc = nil
+	c.r = nil
+	c.state = StateDisconnected
+	c.releaseReader()
+}
+
+// releaseReader marks the message reader as closed and wakes
+// up the waiting commands. c.mu must be held.
+func (c *Client) releaseReader() {
+	if c.activeReader {
+		c.activeReader = false
+		close(c.readerDone)
+	}
+}
+
+// ctxErr returns the error of the context. The deadline of
+// the connection may expire slightly before the context, so
+// context.DeadlineExceeded is returned once the deadline has
+// passed.
+func ctxErr(ctx context.Context) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// isTimeout reports whether the error is caused by an expired
+// deadline.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,192 @@
+package pop3_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+func TestClient_NoopContextCancel(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.Fail("NOOP", pop3test.Failure{Hang: true})
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	_, err := pop.NoopContext(ctx)
+	if err != context.Canceled {
+		t.Errorf("expected: %v, got: %v", context.Canceled, err)
+	}
+	if pop.State() != pop3.StateDisconnected {
+		t.Errorf("expected: %v, got: %v", pop3.StateDisconnected, pop.State())
+	}
+}
+
+func TestClient_ContextAlreadyCancelled(t *testing.T) {
+	srv := newTestServer(t, false)
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pop.StatContext(ctx); err != context.Canceled {
+		t.Errorf("expected: %v, got: %v", context.Canceled, err)
+	}
+	if pop.State() != pop3.StateTransaction {
+		t.Errorf("the session must not be affected, got: %v", pop.State())
+	}
+}
+
+func TestClient_ReadTimeout(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.Fail("NOOP", pop3test.Failure{Hang: true})
+	pop := srv.Login(t, nil, testUser, testPassword)
+	pop.ReadTimeout = 50 * time.Millisecond
+
+	_, err := pop.Noop()
+	if !pop3.IsTimeout(err) {
+		t.Errorf("expected timeout, got: %v", err)
+	}
+	if pop.State() != pop3.StateDisconnected {
+		t.Errorf("expected: %v, got: %v", pop3.StateDisconnected, pop.State())
+	}
+}
+
+func TestClient_RetrReaderContextCancel(t *testing.T) {
+	srv := newTestServer(t, false)
+	// The rest of the message never arrives.
+	srv.Fail("RETR", pop3test.Failure{Resp: "+OK\r\nfirst line", Hang: true})
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := pop.RetrReaderContext(ctx, 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	buf := make([]byte, 64)
+	if _, err = r.Read(buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	cancel()
+	if _, err = r.Read(buf); err != context.Canceled {
+		t.Errorf("expected: %v, got: %v", context.Canceled, err)
+	}
+	r.Close()
+	if pop.State() != pop3.StateDisconnected {
+		t.Errorf("expected: %v, got: %v", pop3.StateDisconnected, pop.State())
+	}
+}
+
+func TestClient_ConcurrentCommands(t *testing.T) {
+	srv := newTestServer(t, false)
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if _, err := pop.Noop(); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			st, err := pop.StatInfo()
+			if err != nil {
+				errs <- err
+			} else if st.Count != 2 || st.Size != 116 {
+				errs <- fmt.Errorf("unexpected STAT result: %+v", st)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			ids, err := pop.Uidl()
+			if err != nil {
+				errs <- err
+			} else if len(ids) != 2 {
+				errs <- fmt.Errorf("unexpected UIDL result: %+v", ids)
+			}
+			_ = pop.State()
+			_ = pop.IsAuthorized()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestClient_ConcurrentRetrReader(t *testing.T) {
+	srv := newTestServer(t, false)
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	r, err := pop.RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	head := make([]byte, 8)
+	if _, err = io.ReadFull(r, head); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// A keepalive of another goroutine waits for the reader,
+	// so it does not corrupt the message.
+	errs := make(chan error)
+	go func() {
+		_, err := pop.Noop()
+		errs <- err
+	}()
+	select {
+	case err = <-errs:
+		t.Fatalf("NOOP must wait for the reader, got: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if body := string(head) + string(rest); body != srv.Messages(testUser)[0].Data {
+		t.Errorf("unexpected body: %q", body)
+	}
+	r.Close()
+	if err = <-errs; err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestClient_ConcurrentRetrReaderClose(t *testing.T) {
+	srv := newTestServer(t, false)
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	r, err := pop.RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	errs := make(chan error)
+	go func() {
+		_, err := pop.Noop()
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// Closing the reader early discards the rest of the
+	// message before the waiting command is sent.
+	if err = r.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = <-errs; err != nil {
+		t.Errorf(err.Error())
+	}
+}
@@ -0,0 +1,270 @@
+package pop3
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"time"
+)
+
+// ContextDialer dials the network connections. *net.Dialer
+// implements it, so source address and keepalive settings can
+// be given with a custom net.Dialer. Proxy dialers of other
+// packages, such as golang.org/x/net/proxy, can be used too.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Mode is the security mode of the connection.
+type Mode int
+
+const (
+	// ModePlain connects without encryption (default port 110).
+	ModePlain Mode = iota
+
+	// ModeTLS connects with implicit TLS (default port 995).
+	ModeTLS
+
+	// ModeStartTLS connects without encryption and upgrades
+	// the connection with STLS command right after the
+	// greeting (default port 110). Dialing fails if the upgrade
+	// cannot happen, so the session never continues in
+	// plaintext.
+	ModeStartTLS
+)
+
+// String returns the name of the mode.
+func (m Mode) String() string {
+	switch m {
+	case ModePlain:
+		return "plain"
+	case ModeTLS:
+		return "tls"
+	case ModeStartTLS:
+		return "starttls"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// Dialer keeps the settings of connecting to a POP3 server.
+// The zero value connects over plain TCP without timeout.
+// Example:
+// 		d := &pop3.Dialer{
+// 			NetDialer: &net.Dialer{KeepAlive: 30 * time.Second},
+// 			Proxy:     &url.URL{Scheme: "socks5", Host: "proxy.corp:1080"},
+// 			Mode:      pop3.ModeTLS,
+// 			Timeout:   30 * time.Second,
+// 		}
+// 		pop, err := d.Dial("pop.gmail.com:995")
+type Dialer struct {
+	// NetDialer dials the TCP connection to the server or the
+	// proxy. If it is <nil>, net.Dialer is used.
+	NetDialer ContextDialer
+
+	// Proxy is the URL of the proxy server. The connection to
+	// the POP3 server is tunneled through it. "socks5" and
+	// "socks5h" schemes are for SOCKS5 (RFC 1928), and "http"
+	// scheme is for HTTP CONNECT. The user info of the URL is
+	// used for the proxy authentication. The host names are
+	// always resolved by the proxy. If it is <nil>, the server
+	// is dialed directly.
+	Proxy *url.URL
+
+	// TLSConfig is TLS configuration for ModeTLS and
+	// ModeStartTLS. If it is <nil> or ServerName is empty, the
+	// host of the address is used as ServerName.
+	TLSConfig *tls.Config
+
+	// Mode is the security mode of the connection.
+	Mode Mode
+
+	// Timeout bounds the whole connecting: dialing, proxy
+	// handshake, TLS handshake, greeting and STLS upgrade.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	// ReadTimeout is the default timeout of every read from
+	// the server. It is set to the returned Client.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the default timeout of every write to
+	// the server. It is set to the returned Client.
+	WriteTimeout time.Duration
+
+	// Trace records the protocol lines from the greeting on.
+	// It is set to the returned Client.
+	Trace Tracer
+
+	// Logger receives the dialing and TLS handshake events. It
+	// is set to the returned Client.
+	Logger *slog.Logger
+
+	// Observer receives the events of the commands. It is set
+	// to the returned Client.
+	Observer Observer
+}
+
+// Dial connects to the POP3 server and reads the greeting
+// message.
+//
+// addr string - POP3 mail server address.
+func (d *Dialer) Dial(addr string) (*Client, error) {
+	return d.DialContext(context.Background(), addr)
+}
+
+// DialContext connects to the POP3 server and reads the
+// greeting message. The context bounds the whole connecting.
+// Once the Client is returned, cancelling the context has no
+// effect on the connection.
+//
+// ctx context.Context - context of connecting.
+// addr string - POP3 mail server address.
+func (d *Dialer) DialContext(ctx context.Context, addr string) (*Client, error) {
+	if d.Mode < ModePlain || d.Mode > ModeStartTLS {
+		return nil, fmt.Errorf("unknown connection mode: %v", d.Mode)
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	conn, err := d.dial(ctx, addr)
+	if err != nil {
+		logAttrs(ctx, d.Logger, slog.LevelError, "pop3: dial failed",
+			slog.String(LogKeyAddr, addr), slog.String(LogKeyErr, err.Error()))
+		return nil, err
+	}
+	logAttrs(ctx, d.Logger, slog.LevelInfo, "pop3: dial",
+		slog.String(LogKeyAddr, addr), slog.Duration(LogKeyDuration, time.Since(start)))
+	return d.newClient(ctx, conn, addr)
+}
+
+// dial returns the TCP connection to the server. It is
+// tunneled through the proxy if one is set.
+func (d *Dialer) dial(ctx context.Context, addr string) (net.Conn, error) {
+	var nd ContextDialer = &net.Dialer{}
+	if d.NetDialer != nil {
+		nd = d.NetDialer
+	}
+	if d.Proxy == nil {
+		return nd.DialContext(ctx, "tcp", addr)
+	}
+
+	switch d.Proxy.Scheme {
+	case "socks5", "socks5h":
+		return dialSOCKS5(ctx, nd, d.Proxy, addr)
+	case "http":
+		return dialHTTPConnect(ctx, nd, d.Proxy, addr)
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme: %q", d.Proxy.Scheme)
+}
+
+// newClient creates a Client on the established connection.
+// It does the TLS handshake for implicit TLS, reads the
+// greeting message and upgrades the connection with STLS
+// if it is requested. The connection is closed on failure.
+func (d *Dialer) newClient(ctx context.Context, conn net.Conn, addr string) (*Client, error) {
+	c := &Client{
+		Addr:         addr,
+		ReadTimeout:  d.ReadTimeout,
+		WriteTimeout: d.WriteTimeout,
+		Trace:        d.Trace,
+		Logger:       d.Logger,
+		Observer:     d.Observer,
+	}
+
+	if d.Mode == ModeTLS {
+		tlsConn := tls.Client(conn, tlsConfigFor(addr, d.TLSConfig))
+		err := tlsConn.HandshakeContext(ctx)
+		logTLS(ctx, d.Logger, tlsConn, err)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+		c.isEncrypted = true
+	}
+	c.setConn(conn)
+
+	end, err := c.begin(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	err = end(c.readGreetingMsg())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if d.Mode == ModeStartTLS {
+		err = c.StartTLSContext(ctx, d.TLSConfig)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Options keeps the connection options of DialContext. Dialer
+// provides more settings, such as proxy and custom net.Dialer.
+type Options struct {
+	// TLSConfig is TLS configuration for implicit TLS and STLS.
+	// If it is <nil> or ServerName is empty, the host of the
+	// address is used as ServerName.
+	TLSConfig *tls.Config
+
+	// TLS indicates that the server is encrypted with TLS
+	// (implicit TLS, default port 995).
+	TLS bool
+
+	// StartTLS upgrades the plaintext connection with STLS
+	// command right after the greeting. Dialing fails if the
+	// upgrade cannot happen.
+	StartTLS bool
+
+	// ReadTimeout is the default timeout of every read from
+	// the server. Zero means no timeout.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the default timeout of every write to
+	// the server. Zero means no timeout.
+	WriteTimeout time.Duration
+}
+
+// DialContext connects to the POP3 server with the given
+// options and reads the greeting message. The context bounds
+// dialing, TLS handshake, greeting and STLS upgrade. Once the
+// Client is returned, cancelling the context has no effect
+// on the connection.
+//
+// ctx context.Context - context of connecting.
+// addr string - POP3 mail server address.
+// opts *Options - connection options. It can be <nil>.
+func DialContext(ctx context.Context, addr string, opts *Options) (*Client, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.TLS && opts.StartTLS {
+		return nil, fmt.Errorf("implicit TLS and STLS cannot be used together")
+	}
+
+	d := &Dialer{
+		TLSConfig:    opts.TLSConfig,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+	}
+	switch {
+	case opts.TLS:
+		d.Mode = ModeTLS
+	case opts.StartTLS:
+		d.Mode = ModeStartTLS
+	}
+	return d.DialContext(ctx, addr)
+}
@@ -0,0 +1,138 @@
+package pop3_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+)
+
+// recordDialer records the addresses it dials.
+type recordDialer struct {
+	addrs []string
+}
+
+func (r *recordDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	r.addrs = append(r.addrs, addr)
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+func TestDialContext(t *testing.T) {
+	addr := newTestServer(t, false).Addr
+
+	opts := &pop3.Options{ReadTimeout: time.Second, WriteTimeout: time.Second}
+	pop, err := pop3.DialContext(context.Background(), addr, opts)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pop.State() != pop3.StateAuthorization {
+		t.Errorf("expected: %v, got: %v", pop3.StateAuthorization, pop.State())
+	}
+	if !strings.HasPrefix(pop.GreetingMsg(), ok) {
+		t.Errorf("expected: %s, got: %s", ok, pop.GreetingMsg())
+	}
+	if pop.ReadTimeout != time.Second || pop.WriteTimeout != time.Second {
+		t.Errorf("timeouts are not set: %v %v", pop.ReadTimeout, pop.WriteTimeout)
+	}
+	if _, err = pop.Quit(); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestDialContextGreetingTimeout(t *testing.T) {
+	// The listener never accepts, so the greeting never
+	// arrives.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer l.Close()
+	addr := l.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = pop3.DialContext(ctx, addr, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestDialContextTLSAndStartTLS(t *testing.T) {
+	_, err := pop3.DialContext(context.Background(), "127.0.0.1:0", &pop3.Options{TLS: true, StartTLS: true})
+	if err == nil {
+		t.Errorf("expected error for conflicting options")
+	}
+}
+
+func TestDialer_NetDialer(t *testing.T) {
+	addr := newTestServer(t, false).Addr
+
+	rd := &recordDialer{}
+	d := &pop3.Dialer{NetDialer: rd, ReadTimeout: time.Second}
+	pop, err := d.Dial(addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(rd.addrs) != 1 || rd.addrs[0] != addr {
+		t.Errorf("expected: [%s], got: %v", addr, rd.addrs)
+	}
+	if pop.ReadTimeout != time.Second {
+		t.Errorf("expected: %v, got: %v", time.Second, pop.ReadTimeout)
+	}
+	if _, err = pop.Quit(); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestDialer_Timeout(t *testing.T) {
+	// The listener never accepts, so the greeting never
+	// arrives.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer l.Close()
+	addr := l.Addr().String()
+
+	d := &pop3.Dialer{Timeout: 50 * time.Millisecond}
+	_, err = d.Dial(addr)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected: %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestDialer_UnknownMode(t *testing.T) {
+	d := &pop3.Dialer{Mode: pop3.Mode(42)}
+	_, err := d.Dial("127.0.0.1:0")
+	if err == nil {
+		t.Errorf("expected error for unknown mode")
+	}
+}
+
+func TestDialer_UnsupportedProxy(t *testing.T) {
+	d := &pop3.Dialer{Proxy: &url.URL{Scheme: "ftp", Host: "127.0.0.1:21"}}
+	_, err := d.Dial("127.0.0.1:110")
+	if err == nil || !strings.Contains(err.Error(), "ftp") {
+		t.Errorf("expected unsupported proxy error, got: %v", err)
+	}
+}
+
+func TestMode_String(t *testing.T) {
+	modes := map[pop3.Mode]string{
+		pop3.ModePlain:    "plain",
+		pop3.ModeTLS:      "tls",
+		pop3.ModeStartTLS: "starttls",
+		pop3.Mode(7):      "Mode(7)",
+	}
+	for m, s := range modes {
+		if m.String() != s {
+			t.Errorf("expected: %s, got: %s", s, m.String())
+		}
+	}
+}
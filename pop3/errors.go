@@ -0,0 +1,117 @@
+package pop3
+
+import "strings"
+
+// ResponseCode is an extended response code which the server
+// sends in square brackets after "-ERR" (RFC 2449, RFC 3206).
+// The predefined codes can be used with errors.Is to check
+// the reason of a ServerError.
+type ResponseCode string
+
+// Error returns the response code in square brackets.
+func (rc ResponseCode) Error() string {
+	return "[" + string(rc) + "]"
+}
+
+const (
+	// ErrInUse indicates that the maildrop is locked by another
+	// session. Retrying later may succeed.
+	ErrInUse ResponseCode = "IN-USE"
+
+	// ErrLoginDelay indicates that the user logged in too
+	// recently. See Capabilities.LoginDelay.
+	ErrLoginDelay ResponseCode = "LOGIN-DELAY"
+
+	// ErrSysTemp indicates a temporary system failure. Retrying
+	// later may succeed.
+	ErrSysTemp ResponseCode = "SYS/TEMP"
+
+	// ErrSysPerm indicates a permanent system failure which needs
+	// human intervention.
+	ErrSysPerm ResponseCode = "SYS/PERM"
+
+	// ErrAuth indicates that the credentials are wrong. Retrying
+	// with the same credentials will not succeed.
+	ErrAuth ResponseCode = "AUTH"
+)
+
+// ServerError is returned when the server responds with "-ERR".
+// It keeps the command, the response text and the extended
+// response code if the server sends one. The functions which
+// return the raw response, such as Stat, Dele and User, return
+// the response together with ServerError.
+// Example:
+// 		C: PASS secret
+// 		S: -ERR [IN-USE] Do you have another POP session running?
+//
+// The response above is returned as the following error, and
+// errors.Is(err, ErrInUse) reports true.
+// 		&ServerError{Cmd: "PASS", Code: "IN-USE", Text: "Do you have another POP session running?"}
+type ServerError struct {
+	// Cmd is the command which is rejected, e.g. "PASS".
+	Cmd string
+
+	// Code is the extended response code without brackets, e.g.
+	// "SYS/TEMP". It is empty if the server sends no code.
+	Code string
+
+	// Text is the human readable text of the response without
+	// the status indicator and the response code.
+	Text string
+
+	// Resp is the raw response line.
+	Resp string
+}
+
+// Error returns the command and the raw response.
+func (se *ServerError) Error() string {
+	return se.Cmd + ": " + se.Resp
+}
+
+// Is reports whether the response code of the error matches
+// the target ResponseCode. Response codes are hierarchical, so
+// "SYS/TEMP/DISK" matches ErrSysTemp.
+func (se *ServerError) Is(target error) bool {
+	rc, ok := target.(ResponseCode)
+	if !ok || se.Code == "" {
+		return false
+	}
+	code := strings.ToUpper(se.Code)
+	return code == string(rc) || strings.HasPrefix(code, string(rc)+"/")
+}
+
+// newServerError parses the negative response and returns
+// ServerError.
+//
+// cmd string - command name, e.g. "DELE"
+// resp string - response line starting with "-ERR"
+func newServerError(cmd, resp string) *ServerError {
+	se := &ServerError{Cmd: cmd, Resp: resp}
+	text := strings.TrimSpace(strings.TrimPrefix(resp, e))
+	if strings.HasPrefix(text, "[") {
+		if end := strings.Index(text, "]"); end > 0 {
+			se.Code = text[1:end]
+			text = strings.TrimSpace(text[end+1:])
+		}
+	}
+	se.Text = text
+	return se
+}
+
+// respErr checks the status indicator of the server
+// response. It returns nil if the response starts with
+// "+OK". If it starts with "-ERR", ServerError is returned.
+// Otherwise, the response violates the protocol and
+// ProtocolError is returned.
+//
+// cmd string - command name, e.g. "DELE"
+// resp string - server response.
+func respErr(cmd, resp string) error {
+	if strings.HasPrefix(resp, ok) {
+		return nil
+	}
+	if strings.HasPrefix(resp, e) {
+		return newServerError(cmd, resp)
+	}
+	return ProtocolError("unexpected response to " + cmd + ": " + resp)
+}
@@ -0,0 +1,84 @@
+package pop3_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+func TestNewServerError(t *testing.T) {
+	se := pop3.NewServerError("PASS", "-ERR [IN-USE] Do you have another POP session running?")
+	if se.Cmd != "PASS" {
+		t.Errorf("expected: %s, got: %s", "PASS", se.Cmd)
+	}
+	if se.Code != "IN-USE" {
+		t.Errorf("expected: %s, got: %s", "IN-USE", se.Code)
+	}
+	if se.Text != "Do you have another POP session running?" {
+		t.Errorf("unexpected text: %s", se.Text)
+	}
+	if !errors.Is(se, pop3.ErrInUse) {
+		t.Errorf("expected errors.Is(%v, ErrInUse)", se)
+	}
+	if errors.Is(se, pop3.ErrAuth) {
+		t.Errorf("unexpected errors.Is(%v, ErrAuth)", se)
+	}
+}
+
+func TestNewServerErrorNoCode(t *testing.T) {
+	se := pop3.NewServerError("DELE", "-ERR no such message")
+	if se.Code != "" || se.Text != "no such message" {
+		t.Errorf("unexpected error: %+v", se)
+	}
+	for _, rc := range []pop3.ResponseCode{pop3.ErrInUse, pop3.ErrLoginDelay, pop3.ErrSysTemp, pop3.ErrSysPerm, pop3.ErrAuth} {
+		if errors.Is(se, rc) {
+			t.Errorf("unexpected errors.Is(%v, %v)", se, rc)
+		}
+	}
+}
+
+func TestServerErrorHierarchicalCode(t *testing.T) {
+	se := pop3.NewServerError("RETR", "-ERR [SYS/TEMP/DISK] disk is full")
+	if !errors.Is(se, pop3.ErrSysTemp) {
+		t.Errorf("expected errors.Is(%v, ErrSysTemp)", se)
+	}
+	if errors.Is(se, pop3.ErrSysPerm) {
+		t.Errorf("unexpected errors.Is(%v, ErrSysPerm)", se)
+	}
+}
+
+func TestRespErr(t *testing.T) {
+	if err := pop3.RespErr("NOOP", "+OK"); err != nil {
+		t.Errorf("expected: <nil>, got: %v", err)
+	}
+
+	var se *pop3.ServerError
+	if err := pop3.RespErr("PASS", "-ERR [AUTH] invalid password"); !errors.As(err, &se) || !errors.Is(err, pop3.ErrAuth) {
+		t.Errorf("expected *ServerError with [AUTH], got: %v", err)
+	}
+
+	if _, ok := pop3.RespErr("NOOP", "* garbage").(pop3.ProtocolError); !ok {
+		t.Errorf("expected ProtocolError")
+	}
+}
+
+func TestClient_DeleServerError(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "DELE 1", Send: "-ERR [SYS/PERM] message 1 already deleted"},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	resp, err := pop.Dele("1")
+	if resp != "-ERR [SYS/PERM] message 1 already deleted" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	if !errors.Is(err, pop3.ErrSysPerm) {
+		t.Errorf("expected ErrSysPerm, got: %v", err)
+	}
+	var se *pop3.ServerError
+	if !errors.As(err, &se) || se.Cmd != "DELE" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
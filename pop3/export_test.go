@@ -0,0 +1,82 @@
+package pop3
+
+import "net"
+
+// The tests of the package are in package pop3_test, so they
+// can use pop3test which imports pop3/server and this package.
+// The unexported identifiers which they need are exported
+// here, only for the tests.
+
+const (
+	Socks5Version  = socks5Version
+	Socks5NoAuth   = socks5NoAuth
+	Socks5UserPass = socks5UserPass
+	Socks5Connect  = socks5Connect
+	Socks5IPv4     = socks5IPv4
+)
+
+var (
+	ErrMsgNum    = errMsgNum
+	ErrLineCount = errLineCount
+
+	ApopTimestamp     = apopTimestamp
+	ApopDigest        = apopDigest
+	TLSConfigFor      = tlsConfigFor
+	ParseCapabilities = parseCapabilities
+	IsTimeout         = isTimeout
+	NewServerError    = newServerError
+	RespErr           = respErr
+	ProxyAddr         = proxyAddr
+	Socks5Handshake   = socks5Handshake
+	ParseMessageInfo  = parseMessageInfo
+	ParseUniqueID     = parseUniqueID
+)
+
+// NewTestClient returns a Client on the connection in the
+// given state without reading the greeting.
+func NewTestClient(conn net.Conn, state State) *Client {
+	c := &Client{state: state}
+	if conn != nil {
+		c.setConn(conn)
+	}
+	return c
+}
+
+// SetState sets the state of the session.
+func (c *Client) SetState(state State) {
+	c.state = state
+}
+
+// SetGreeting sets the greeting message.
+func (c *Client) SetGreeting(greeting string) {
+	c.greetingMsg = greeting
+}
+
+// SetEncrypted marks the connection as encrypted.
+func (c *Client) SetEncrypted(encrypted bool) {
+	c.isEncrypted = encrypted
+}
+
+// SetCaps sets the cached capabilities.
+func (c *Client) SetCaps(caps *Capabilities) {
+	c.caps = caps
+}
+
+// SetInAuth marks the client as in the middle of an AUTH
+// exchange.
+func (c *Client) SetInAuth(inAuth bool) {
+	c.inAuth = inAuth
+}
+
+// ReaderOpen reports whether a RetrReader holds the client.
+func (c *Client) ReaderOpen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.activeReader
+}
+
+func (c *Client) IsAuth(greeting string) bool           { return c.isAuth(greeting) }
+func (c *Client) ReadResp() (string, error)             { return c.readResp() }
+func (c *Client) ReadRespMultiLines() ([]string, error) { return c.readRespMultiLines() }
+func (c *Client) WriteLine(line string) error           { return c.writeLine(line) }
+func (c *Client) RedactCmd(line string) string          { return c.redactCmd(line) }
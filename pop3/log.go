@@ -0,0 +1,186 @@
+package pop3
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Attribute keys of the log records. They are the same in
+// every record, so the records can be filtered and indexed.
+const (
+	// LogKeyAddr is the address of the server.
+	LogKeyAddr = "pop3.addr"
+
+	// LogKeyCmd is the name of the command, e.g. "RETR".
+	LogKeyCmd = "pop3.cmd"
+
+	// LogKeyMsg is the status line of the server response or
+	// the greeting.
+	LogKeyMsg = "pop3.msg"
+
+	// LogKeyBytes is the size of the server response in
+	// octets, including the line endings.
+	LogKeyBytes = "pop3.bytes"
+
+	// LogKeyDuration is the time of dialing or of the whole
+	// command.
+	LogKeyDuration = "pop3.duration"
+
+	// LogKeyTLSVersion is the negotiated TLS version, e.g.
+	// "TLS 1.3".
+	LogKeyTLSVersion = "pop3.tls.version"
+
+	// LogKeyTLSCipher is the negotiated cipher suite.
+	LogKeyTLSCipher = "pop3.tls.cipher"
+
+	// LogKeyMech is the SASL mechanism of AUTH command.
+	LogKeyMech = "pop3.mech"
+
+	// LogKeyUser is the username of USER and APOP commands.
+	LogKeyUser = "pop3.user"
+
+	// LogKeyErr is the error of the failed event.
+	LogKeyErr = "pop3.err"
+)
+
+// logAttrs writes the record if the logger is set.
+func logAttrs(ctx context.Context, l *slog.Logger, level slog.Level, msg string, attrs ...slog.Attr) {
+	if l == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	l.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// log writes the record with the context of the running
+// command.
+func (c *Client) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	logAttrs(c.logCtx, c.Logger, level, msg, attrs...)
+}
+
+// logTLS logs the result of the TLS handshake.
+//
+// ctx context.Context - context of the handshake.
+// l *slog.Logger - logger, it can be <nil>.
+// conn *tls.Conn - TLS connection.
+// err error - error of the handshake.
+func logTLS(ctx context.Context, l *slog.Logger, conn *tls.Conn, err error) {
+	if err != nil {
+		logAttrs(ctx, l, slog.LevelError, "pop3: tls handshake failed", slog.String(LogKeyErr, err.Error()))
+		return
+	}
+	state := conn.ConnectionState()
+	logAttrs(ctx, l, slog.LevelInfo, "pop3: tls handshake",
+		slog.String(LogKeyTLSVersion, tls.VersionName(state.Version)),
+		slog.String(LogKeyTLSCipher, tls.CipherSuiteName(state.CipherSuite)))
+}
+
+// logAuth logs the result of the login command.
+//
+// cmd string - login command, e.g. "PASS"
+// mech string - SASL mechanism, or "" for the other commands.
+// err error - error of the command.
+func (c *Client) logAuth(cmd, mech string, err error) {
+	attrs := []slog.Attr{slog.String(LogKeyCmd, cmd)}
+	if mech != "" {
+		attrs = append(attrs, slog.String(LogKeyMech, mech))
+	}
+	if c.username != "" {
+		attrs = append(attrs, slog.String(LogKeyUser, c.username))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String(LogKeyErr, err.Error()))
+		c.log(slog.LevelWarn, "pop3: auth failed", attrs...)
+		return
+	}
+	c.log(slog.LevelInfo, "pop3: auth", attrs...)
+}
+
+// logCmd logs the command which is finished. The greeting has
+// no command, so it is not logged here.
+//
+// err error - error of the command.
+func (c *Client) logCmd(err error) {
+	if c.Logger == nil || c.cmd == "" {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String(LogKeyCmd, c.cmd),
+		slog.Duration(LogKeyDuration, time.Since(c.cmdStart)),
+		slog.Int64(LogKeyBytes, c.respBytes),
+	}
+	if c.status != "" {
+		attrs = append(attrs, slog.String(LogKeyMsg, c.status))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String(LogKeyErr, err.Error()))
+		c.log(slog.LevelWarn, "pop3: command failed", attrs...)
+		return
+	}
+	c.log(slog.LevelDebug, "pop3: command", attrs...)
+}
+
+// startCmd resets the command state of the logs and the
+// Observer.
+//
+// ctx context.Context - context of the command.
+func (c *Client) startCmd(ctx context.Context) {
+	c.logCtx = ctx
+	c.cmdAddr = c.Addr
+	c.cmd = ""
+	c.status = ""
+	c.respBytes = 0
+	c.sentBytes = 0
+	c.cmdStart = time.Now()
+}
+
+// nextCmd resets the command state for the next command of a
+// pipelined batch, so each command is logged and observed by
+// itself.
+//
+// line string - command line.
+// sentAt time.Time - time when the line is sent.
+func (c *Client) nextCmd(line string, sentAt time.Time) {
+	c.cmd = ""
+	c.recordSent(line)
+	c.status = ""
+	c.respBytes = 0
+	c.sentBytes = int64(len(line) + len("\r\n"))
+	c.cmdStart = sentAt
+}
+
+// endCmd logs and observes the finished command of a pipelined
+// batch. The command is cleared, so the end of the batch does
+// not report it again.
+//
+// err error - error of the command.
+func (c *Client) endCmd(err error) {
+	c.observeCmd(err)
+	c.logCmd(err)
+	c.cmd = ""
+}
+
+// recordSent keeps the name of the first command line which is
+// sent in the command.
+//
+// line string - command line.
+func (c *Client) recordSent(line string) {
+	if c.cmd == "" {
+		c.cmd = strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+	}
+}
+
+// recordStatus keeps the status line of the response. The SASL
+// challenges are not status lines.
+//
+// line string - response line.
+func (c *Client) recordStatus(line string) {
+	if strings.HasPrefix(line, ok) || strings.HasPrefix(line, e) {
+		c.status = line
+	}
+}
@@ -0,0 +1,125 @@
+package pop3_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+	"github.com/gozeloglu/gop-3/pop3/sasl"
+)
+
+// logRecords decodes the JSON log records.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var rec map[string]interface{}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf(err.Error())
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+// jsonLogger returns a logger which writes every level into
+// buf as JSON.
+func jsonLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestClient_Logger(t *testing.T) {
+	srv := newTestServer(t, true)
+	var buf bytes.Buffer
+	d := &pop3.Dialer{Mode: pop3.ModeTLS, TLSConfig: srv.ClientTLSConfig(), Logger: jsonLogger(&buf)}
+	pop, err := d.Dial(srv.Addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pop.User(testUser)
+	if _, err = pop.Pass(testPassword); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = pop.Retr("1"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	pop.Dele("9")
+	if _, err = pop.Quit(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	records := logRecords(t, &buf)
+	expected := []string{
+		"pop3: dial",
+		"pop3: tls handshake",
+		"pop3: greeting",
+		"pop3: command",
+		"pop3: auth",
+		"pop3: command",
+		"pop3: command",
+		"pop3: command failed",
+		"pop3: quit",
+		"pop3: command",
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got: %v", len(expected), records)
+	}
+	for i, msg := range expected {
+		if records[i]["msg"] != msg {
+			t.Errorf("record %d: expected: %q, got: %q", i, msg, records[i]["msg"])
+		}
+	}
+
+	if records[0][pop3.LogKeyAddr] != srv.Addr {
+		t.Errorf("unexpected dial record: %v", records[0])
+	}
+	if records[1][pop3.LogKeyTLSVersion] == nil || records[1][pop3.LogKeyTLSCipher] == nil {
+		t.Errorf("unexpected TLS record: %v", records[1])
+	}
+	if records[4][pop3.LogKeyCmd] != "PASS" || records[4][pop3.LogKeyUser] != testUser {
+		t.Errorf("unexpected auth record: %v", records[4])
+	}
+	retr := records[6]
+	if retr[pop3.LogKeyCmd] != "RETR" || retr[pop3.LogKeyMsg] == nil || retr[pop3.LogKeyDuration] == nil {
+		t.Errorf("unexpected command record: %v", retr)
+	}
+	// The message is 61 octets, the status and termination
+	// lines are counted too.
+	if n := retr[pop3.LogKeyBytes].(float64); n <= 61+3 {
+		t.Errorf("unexpected response size: %v", n)
+	}
+	if records[7][pop3.LogKeyErr] == nil || records[7]["level"] != "WARN" {
+		t.Errorf("unexpected failed command record: %v", records[7])
+	}
+	if bytes.Contains(buf.Bytes(), []byte(testPassword)) {
+		t.Errorf("password must not be logged")
+	}
+}
+
+func TestClient_LoggerAuthFailed(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH LOGIN", Send: "+ VXNlcm5hbWU6"},
+		pop3test.Step{Expect: "dXNlcg==", Send: "+ UGFzc3dvcmQ6"},
+		pop3test.Step{Expect: "c2VjcmV0", Send: "-ERR [AUTH] Authentication failed"},
+	)
+	var buf bytes.Buffer
+	pop.Logger = jsonLogger(&buf)
+	if _, err := pop.Auth(sasl.NewLoginClient("user", "secret")); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	records := logRecords(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got: %v", records)
+	}
+	rec := records[0]
+	if rec["msg"] != "pop3: auth failed" || rec[pop3.LogKeyMech] != "LOGIN" || rec[pop3.LogKeyErr] == nil {
+		t.Errorf("unexpected auth record: %v", rec)
+	}
+	if records[1][pop3.LogKeyMsg] != "-ERR [AUTH] Authentication failed" {
+		t.Errorf("challenge must not be the status: %v", records[1])
+	}
+}
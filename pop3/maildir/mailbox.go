@@ -0,0 +1,158 @@
+package maildir
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/server"
+)
+
+// maxUIDLength is the maximum length of a unique-id (RFC 1939).
+const maxUIDLength = 70
+
+// Backend serves the Maildirs under Root with the pop3
+// server. The Maildir of a user is Root/<username>, and it is
+// created on the first login.
+//
+// Example:
+// 		s := &server.Server{
+// 			Backend: &maildir.Backend{
+// 				Root:         "/var/mail",
+// 				Authenticate: checkPassword,
+// 			},
+// 		}
+type Backend struct {
+	// Root is the directory of the Maildirs.
+	Root string
+
+	// Authenticate checks the password of the user. It should
+	// return server.ErrAuthFailed for wrong credentials. If it
+	// is <nil>, every login fails.
+	Authenticate func(username, password string) error
+}
+
+// Login checks the credentials and opens the Maildir of the
+// user. The usernames which are not valid directory names are
+// refused.
+//
+// username string - name of the user.
+// password string - password of the user.
+func (b *Backend) Login(username, password string) (server.Mailbox, error) {
+	if b.Authenticate == nil || !validUsername(username) {
+		return nil, server.ErrAuthFailed
+	}
+	if err := b.Authenticate(username, password); err != nil {
+		return nil, err
+	}
+	d := Dir(filepath.Join(b.Root, username))
+	if err := d.Init(); err != nil {
+		return nil, err
+	}
+	return NewMailbox(d), nil
+}
+
+// validUsername reports whether the username can be used as a
+// directory name under Root.
+func validUsername(username string) bool {
+	return username != "" && username != "." && username != ".." &&
+		!strings.ContainsAny(username, "/\\\x00")
+}
+
+// Mailbox is the POP3 maildrop of a Maildir. It implements
+// server.Mailbox. The messages are listed once at the login,
+// so the numbers do not change during the session.
+type Mailbox struct {
+	dir  Dir
+	msgs []Message
+}
+
+// NewMailbox returns the maildrop of the Maildir.
+//
+// d Dir - Maildir of the user.
+func NewMailbox(d Dir) *Mailbox {
+	return &Mailbox{dir: d}
+}
+
+// List lists the messages of the Maildir. The sizes are
+// counted with CRLF line endings.
+func (m *Mailbox) List() ([]pop3.MessageInfo, error) {
+	msgs, err := m.dir.List()
+	if err != nil {
+		return nil, err
+	}
+	m.msgs = msgs
+	infos := make([]pop3.MessageInfo, len(msgs))
+	for i, msg := range msgs {
+		infos[i] = pop3.MessageInfo{Num: i + 1, Size: int(msg.RFC822Size)}
+	}
+	return infos, nil
+}
+
+// Uidl returns the keys of the messages as the unique-ids.
+// The keys which are not valid unique-ids are hashed with
+// MD5.
+func (m *Mailbox) Uidl() ([]pop3.UniqueID, error) {
+	ids := make([]pop3.UniqueID, len(m.msgs))
+	for i, msg := range m.msgs {
+		ids[i] = pop3.UniqueID{Num: i + 1, UID: uid(msg.Key)}
+	}
+	return ids, nil
+}
+
+// uid returns the unique-id of the key. The unique-id
+// consists of 1 to 70 characters in the range of 0x21 to
+// 0x7E.
+func uid(key string) string {
+	valid := len(key) <= maxUIDLength
+	for i := 0; valid && i < len(key); i++ {
+		valid = key[i] >= 0x21 && key[i] <= 0x7e
+	}
+	if valid {
+		return key
+	}
+	sum := md5.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Retr opens the message with the number.
+//
+// num int - message number.
+func (m *Mailbox) Retr(num int) (io.ReadCloser, error) {
+	if num < 1 || num > len(m.msgs) {
+		return nil, ErrNotFound
+	}
+	return m.dir.Open(m.msgs[num-1].Key)
+}
+
+// Delete removes the messages with the numbers. The messages
+// which are already removed by another process are skipped.
+//
+// nums []int - message numbers.
+func (m *Mailbox) Delete(nums []int) error {
+	var err error
+	for _, num := range nums {
+		if num < 1 || num > len(m.msgs) {
+			continue
+		}
+		rerr := m.dir.Remove(m.msgs[num-1].Key)
+		if errors.Is(rerr, ErrNotFound) || errors.Is(rerr, os.ErrNotExist) {
+			continue
+		}
+		if rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Close releases the mailbox.
+func (m *Mailbox) Close() error {
+	m.msgs = nil
+	return nil
+}
@@ -0,0 +1,105 @@
+package maildir
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+	"github.com/gozeloglu/gop-3/pop3/server"
+)
+
+const (
+	testUser     = "user"
+	testPassword = "secret"
+)
+
+func authenticate(username, password string) error {
+	if username != testUser || password != testPassword {
+		return server.ErrAuthFailed
+	}
+	return nil
+}
+
+func TestBackend_ServeAndExport(t *testing.T) {
+	root := t.TempDir()
+	inbox := Dir(root + "/" + testUser)
+	if err := inbox.Init(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	k1, _ := inbox.Deliver(strings.NewReader("Subject: one\n\n.first\n"))
+	inbox.Deliver(strings.NewReader("Subject: two\n\nsecond\n"))
+
+	srv := pop3test.NewUnstartedServer()
+	srv.Backend = &Backend{Root: root, Authenticate: authenticate}
+	defer srv.Close()
+	c := srv.Login(t, nil, testUser, testPassword)
+	list, err := c.ListAll()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(list) != 2 || list[0].Size != 24 {
+		t.Errorf("unexpected LIST: %v", list)
+	}
+	ids, err := c.Uidl()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(ids) != 2 || ids[0].UID != uid(k1) {
+		t.Errorf("unexpected UIDL: %v", ids)
+	}
+
+	// Export the first message into another Maildir.
+	export := Dir(t.TempDir())
+	if err = export.Init(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	r, err := c.RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	key, err := export.Deliver(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := readMessage(t, export, key); got != "Subject: one\n\n.first\n" {
+		t.Errorf("unexpected exported message: %q", got)
+	}
+
+	if _, err = c.Dele("1"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = c.Quit(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	msgs, _ := inbox.List()
+	if len(msgs) != 1 || msgs[0].Key == k1 {
+		t.Errorf("first message must be deleted: %+v", msgs)
+	}
+}
+
+func TestBackend_InvalidUser(t *testing.T) {
+	b := &Backend{Root: t.TempDir(), Authenticate: func(string, string) error { return nil }}
+	for _, name := range []string{"", "..", "a/b"} {
+		if _, err := b.Login(name, ""); !errors.Is(err, server.ErrAuthFailed) {
+			t.Errorf("expected ErrAuthFailed for %q, got: %v", name, err)
+		}
+	}
+	if _, err := (&Backend{Root: t.TempDir()}).Login(testUser, testPassword); !errors.Is(err, server.ErrAuthFailed) {
+		t.Errorf("expected ErrAuthFailed without Authenticate, got: %v", err)
+	}
+}
+
+func TestUid(t *testing.T) {
+	if got := uid("1600000000.M1P1.host"); got != "1600000000.M1P1.host" {
+		t.Errorf("unexpected uid: %s", got)
+	}
+	long := strings.Repeat("a", 71)
+	if got := uid(long); len(got) != 32 {
+		t.Errorf("long key must be hashed, got: %s", got)
+	}
+	if got := uid("a b"); got == "a b" {
+		t.Errorf("key with space must be hashed")
+	}
+}
@@ -0,0 +1,408 @@
+// Package maildir implements a Maildir mail store. The
+// messages are delivered atomically through tmp/ into new/,
+// and they are moved into cur/ when their flags are set, so
+// the store can be opened with mail readers like mutt. The
+// same store can be served over POP3 with Backend and
+// Mailbox.
+//
+// Example:
+// 		d := maildir.Dir("Mail/inbox")
+// 		if err := d.Init(); err != nil {
+// 			log.Fatal(err)
+// 		}
+// 		r, err := pop.RetrReader(1)
+// 		if err != nil {
+// 			log.Fatal(err)
+// 		}
+// 		key, err := d.Deliver(r)
+// 		r.Close()
+package maildir
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotFound is returned when there is no message with the
+// given key.
+var ErrNotFound = errors.New("maildir: message not found")
+
+// Flags of the messages which are defined in the Maildir
+// specification. Flags are kept in ASCII order in the
+// filename.
+const (
+	FlagPassed  = 'P'
+	FlagReplied = 'R'
+	FlagSeen    = 'S'
+	FlagTrashed = 'T'
+	FlagDraft   = 'D'
+	FlagFlagged = 'F'
+)
+
+// infoSep separates the key and the flags in the filenames
+// of cur/ directory.
+const infoSep = ":2,"
+
+// deliveries counts the deliveries of the process for the
+// unique filenames.
+var deliveries uint32
+
+// Dir is the path of a Maildir directory which contains tmp,
+// new and cur directories.
+type Dir string
+
+// Message is a message of the Maildir.
+type Message struct {
+	// Key is the unique name of the message. It does not
+	// change when the flags are changed.
+	Key string
+
+	// Flags keeps the flags of the message in ASCII order,
+	// e.g. "FS".
+	Flags string
+
+	// New is true if the message is in new/ directory, i.e.
+	// it has not been seen by a mail reader yet.
+	New bool
+
+	// Size is the size of the file in octets.
+	Size int64
+
+	// RFC822Size is the size of the message with CRLF line
+	// endings. It is the size which is reported by POP3.
+	RFC822Size int64
+}
+
+// Init creates tmp, new and cur directories if they do not
+// exist.
+func (d Dir) Init() error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(string(d), sub), 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deliver writes the message into tmp/ and moves it into
+// new/, so the readers never see a partial message. CRLF
+// line endings are converted to LF, which is the convention
+// of Maildir. The sizes are kept in the filename as S= and
+// W= fields. It returns the key of the message.
+//
+// r io.Reader - message, e.g. the reader of Client.RetrReader
+func (d Dir) Deliver(r io.Reader) (string, error) {
+	return d.deliver(r, "")
+}
+
+// DeliverID is like Deliver, but the hash of the id is kept in
+// the key as U= field. HasID can tell whether the message is
+// delivered, so an interrupted delivery can be detected
+// without delivering the message twice.
+//
+// id string - identity of the message, e.g. the unique-id.
+// r io.Reader - message.
+func (d Dir) DeliverID(id string, r io.Reader) (string, error) {
+	return d.deliver(r, ",U="+idHash(id))
+}
+
+// deliver is the implementation of the Deliver functions. The
+// message is synced to the disk before the rename, and new/ is
+// synced after it.
+func (d Dir) deliver(r io.Reader, fields string) (string, error) {
+	name := uniqueName()
+	tmp := filepath.Join(string(d), "tmp", name)
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	size, rfcSize, err := copyLF(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	key := fmt.Sprintf("%s%s,S=%d,W=%d", name, fields, size, rfcSize)
+	newDir := filepath.Join(string(d), "new")
+	if err = os.Rename(tmp, filepath.Join(newDir, key)); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	syncDir(newDir)
+	return key, nil
+}
+
+// syncDir flushes the directory entries to the disk. The
+// errors are ignored, because some platforms cannot sync the
+// directories.
+func syncDir(path string) {
+	if f, err := os.Open(path); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
+
+// idHash returns the hash of the id which is kept in the key.
+func idHash(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:12])
+}
+
+// HasID reports whether a message which is delivered with
+// DeliverID and the id is in the Maildir.
+//
+// id string - identity of the message.
+func (d Dir) HasID(id string) (bool, error) {
+	field := "U=" + idHash(id)
+	msgs, err := d.List()
+	if err != nil {
+		return false, err
+	}
+	for _, m := range msgs {
+		for _, f := range strings.Split(m.Key, ",")[1:] {
+			if f == field {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// uniqueName returns a unique filename in the form of
+// "<seconds>.M<microseconds>P<pid>Q<count>.<host>".
+func uniqueName() string {
+	now := time.Now()
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000,
+		os.Getpid(), atomic.AddUint32(&deliveries, 1), host)
+}
+
+// copyLF copies the message with LF line endings. It returns
+// the written size and the size with CRLF line endings.
+func copyLF(w io.Writer, r io.Reader) (int64, int64, error) {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	var size, rfcSize int64
+	for {
+		l, err := br.ReadString('\n')
+		if strings.HasSuffix(l, "\n") {
+			l = strings.TrimSuffix(strings.TrimSuffix(l, "\n"), "\r")
+			bw.WriteString(l + "\n")
+			size += int64(len(l)) + 1
+			rfcSize += int64(len(l)) + 2
+		} else if l != "" {
+			bw.WriteString(l)
+			size += int64(len(l))
+			rfcSize += int64(len(l))
+		}
+		if err == io.EOF {
+			return size, rfcSize, bw.Flush()
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// List returns the messages in new/ and cur/ directories in
+// the order of delivery. The files starting with "." are
+// skipped.
+func (d Dir) List() ([]Message, error) {
+	var msgs []Message
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := os.ReadDir(filepath.Join(string(d), sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			m, err := d.message(sub, e.Name())
+			if errors.Is(err, os.ErrNotExist) {
+				// It is moved or removed by another process.
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, m)
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return lessKey(msgs[i].Key, msgs[j].Key)
+	})
+	return msgs, nil
+}
+
+// message returns the message of the file. The sizes are read
+// from the filename if they exist.
+func (d Dir) message(sub, name string) (Message, error) {
+	key, flags := splitName(name)
+	m := Message{Key: key, Flags: flags, New: sub == "new"}
+	path := filepath.Join(string(d), sub, name)
+
+	var sizeOK, rfcOK bool
+	m.Size, sizeOK = keySize(key, "S")
+	m.RFC822Size, rfcOK = keySize(key, "W")
+	if !sizeOK {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return Message{}, err
+		}
+		m.Size = fi.Size()
+	}
+	if !rfcOK {
+		n, err := countBareLF(path)
+		if err != nil {
+			return Message{}, err
+		}
+		m.RFC822Size = m.Size + n
+	}
+	return m, nil
+}
+
+// splitName splits the filename into the key and the flags.
+func splitName(name string) (string, string) {
+	if i := strings.Index(name, infoSep); i >= 0 {
+		return name[:i], name[i+len(infoSep):]
+	}
+	return name, ""
+}
+
+// keySize returns the size field of the key, e.g. "S=1234".
+func keySize(key, field string) (int64, bool) {
+	fields := strings.Split(key, ",")
+	for _, f := range fields[1:] {
+		if strings.HasPrefix(f, field+"=") {
+			n, err := strconv.ParseInt(f[len(field)+1:], 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// countBareLF counts the line endings which are not CRLF.
+func countBareLF(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var n int64
+	prev := byte(0)
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if b == '\n' && prev != '\r' {
+			n++
+		}
+		prev = b
+	}
+}
+
+// lessKey orders the keys by the delivery time at the start
+// of the key.
+func lessKey(a, b string) bool {
+	ta, errA := strconv.ParseInt(strings.SplitN(a, ".", 2)[0], 10, 64)
+	tb, errB := strconv.ParseInt(strings.SplitN(b, ".", 2)[0], 10, 64)
+	if errA == nil && errB == nil && ta != tb {
+		return ta < tb
+	}
+	return a < b
+}
+
+// path returns the path of the message with the key.
+func (d Dir) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) {
+		return "", ErrNotFound
+	}
+	p := filepath.Join(string(d), "new", key)
+	if _, err := os.Stat(p); err == nil {
+		return p, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(string(d), "cur"))
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if k, _ := splitName(e.Name()); k == key {
+			return filepath.Join(string(d), "cur", e.Name()), nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Open opens the message with the key.
+//
+// key string - key of the message.
+func (d Dir) Open(key string) (io.ReadCloser, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Remove deletes the message with the key.
+//
+// key string - key of the message.
+func (d Dir) Remove(key string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// SetFlags replaces the flags of the message and moves it into
+// cur/ directory. Unknown flags are kept, duplicates are
+// removed.
+//
+// key string - key of the message.
+// flags string - new flags, e.g. "S" or "FS"
+func (d Dir) SetFlags(key, flags string) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	set := make(map[rune]bool)
+	var fs []string
+	for _, f := range flags {
+		if !set[f] {
+			set[f] = true
+			fs = append(fs, string(f))
+		}
+	}
+	sort.Strings(fs)
+	return os.Rename(p, filepath.Join(string(d), "cur", key+infoSep+strings.Join(fs, "")))
+}
@@ -0,0 +1,157 @@
+package maildir
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testDir(t *testing.T) Dir {
+	d := Dir(filepath.Join(t.TempDir(), "inbox"))
+	if err := d.Init(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return d
+}
+
+func readMessage(t *testing.T, d Dir, key string) string {
+	r, err := d.Open(key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return string(b)
+}
+
+func TestDir_Deliver(t *testing.T) {
+	d := testDir(t)
+	key, err := d.Deliver(strings.NewReader("Subject: Hello\r\n\r\nHi\r\nno newline"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = os.Stat(filepath.Join(string(d), "new", key)); err != nil {
+		t.Errorf("message must be in new/: %v", err)
+	}
+	if tmp, _ := os.ReadDir(filepath.Join(string(d), "tmp")); len(tmp) != 0 {
+		t.Errorf("tmp/ must be empty, got: %d files", len(tmp))
+	}
+
+	expected := "Subject: Hello\n\nHi\nno newline"
+	if got := readMessage(t, d, key); got != expected {
+		t.Errorf("expected: %q, got: %q", expected, got)
+	}
+	msgs, err := d.List()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got: %d", len(msgs))
+	}
+	m := msgs[0]
+	if m.Key != key || !m.New || m.Size != 29 || m.RFC822Size != 32 {
+		t.Errorf("unexpected message: %+v", m)
+	}
+}
+
+func TestDir_DeliverUnique(t *testing.T) {
+	d := testDir(t)
+	k1, _ := d.Deliver(strings.NewReader("one\n"))
+	k2, _ := d.Deliver(strings.NewReader("two\n"))
+	if k1 == k2 {
+		t.Errorf("keys must be unique: %s", k1)
+	}
+	msgs, _ := d.List()
+	if len(msgs) != 2 || msgs[0].Key != k1 || msgs[1].Key != k2 {
+		t.Errorf("messages must be in delivery order: %+v", msgs)
+	}
+}
+
+func TestDir_SetFlags(t *testing.T) {
+	d := testDir(t)
+	key, err := d.Deliver(strings.NewReader("Subject: Hello\n\nHi\n"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = d.SetFlags(key, "SFS"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = os.Stat(filepath.Join(string(d), "cur", key+":2,FS")); err != nil {
+		t.Errorf("message must be in cur/ with flags: %v", err)
+	}
+	msgs, _ := d.List()
+	if len(msgs) != 1 || msgs[0].Key != key || msgs[0].Flags != "FS" || msgs[0].New {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+	if got := readMessage(t, d, key); got != "Subject: Hello\n\nHi\n" {
+		t.Errorf("unexpected message: %q", got)
+	}
+}
+
+func TestDir_Remove(t *testing.T) {
+	d := testDir(t)
+	key, _ := d.Deliver(strings.NewReader("Hi\n"))
+	if err := d.Remove(key); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := d.Remove(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+	if _, err := d.Open("../" + key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for path, got: %v", err)
+	}
+}
+
+func TestDir_ListForeignFile(t *testing.T) {
+	d := testDir(t)
+	// A message which is delivered by another program without
+	// size fields.
+	name := "1600000000.M1P1.host:2,S"
+	data := "Subject: x\r\n\r\nbody\n"
+	if err := os.WriteFile(filepath.Join(string(d), "cur", name), []byte(data), 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	os.WriteFile(filepath.Join(string(d), "cur", ".hidden"), nil, 0600)
+
+	msgs, err := d.List()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got: %+v", msgs)
+	}
+	m := msgs[0]
+	if m.Key != "1600000000.M1P1.host" || m.Flags != "S" || m.Size != 19 || m.RFC822Size != 20 {
+		t.Errorf("unexpected message: %+v", m)
+	}
+}
+
+func TestDir_DeliverID(t *testing.T) {
+	d := testDir(t)
+	if ok, err := d.HasID("uid-1"); ok || err != nil {
+		t.Errorf("unexpected HasID: %v %v", ok, err)
+	}
+	key, err := d.DeliverID("uid-1", strings.NewReader("Hi\n"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = d.SetFlags(key, "S"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if ok, err := d.HasID("uid-1"); !ok || err != nil {
+		t.Errorf("expected delivered message, got: %v %v", ok, err)
+	}
+	if ok, _ := d.HasID("uid-2"); ok {
+		t.Errorf("unexpected message for another id")
+	}
+	msgs, _ := d.List()
+	if len(msgs) != 1 || msgs[0].Size != 3 || msgs[0].RFC822Size != 4 {
+		t.Errorf("sizes must be kept with U= field: %+v", msgs)
+	}
+}
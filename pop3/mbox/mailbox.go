@@ -0,0 +1,209 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/server"
+)
+
+// ErrReadOnly is returned by Mailbox.Delete because the mbox
+// file is not modified. DELE command is refused before, see
+// Mailbox.ReadOnly.
+var ErrReadOnly = fmt.Errorf("%w: mbox is read-only", pop3.ErrSysPerm)
+
+// maxUIDLength is the maximum length of a unique-id (RFC 1939).
+const maxUIDLength = 70
+
+// Backend serves the mbox files under Root with the pop3
+// server. The mbox of a user is Root/<username>, like
+// /var/mail/<username>. The mailboxes are read-only.
+//
+// Example:
+// 		s := &server.Server{
+// 			Backend: &mbox.Backend{
+// 				Root:         "/var/mail",
+// 				Authenticate: checkPassword,
+// 			},
+// 		}
+type Backend struct {
+	// Root is the directory of the mbox files.
+	Root string
+
+	// Format is the format of the mbox files.
+	Format Format
+
+	// Authenticate checks the password of the user. It should
+	// return server.ErrAuthFailed for wrong credentials. If it
+	// is <nil>, every login fails.
+	Authenticate func(username, password string) error
+}
+
+// Login checks the credentials and returns the mbox of the
+// user. The usernames which are not valid file names are
+// refused.
+//
+// username string - name of the user.
+// password string - password of the user.
+func (b *Backend) Login(username, password string) (server.Mailbox, error) {
+	if b.Authenticate == nil || username == "" || username == "." || username == ".." ||
+		strings.ContainsAny(username, "/\\\x00") {
+		return nil, server.ErrAuthFailed
+	}
+	if err := b.Authenticate(username, password); err != nil {
+		return nil, err
+	}
+	return NewMailbox(filepath.Join(b.Root, username), b.Format), nil
+}
+
+// Mailbox is the read-only POP3 maildrop of an mbox file. It
+// implements server.Mailbox. The messages are loaded into
+// memory when they are listed after the login. A missing file
+// is an empty mailbox.
+type Mailbox struct {
+	path   string
+	format Format
+	msgs   []*Message
+	uids   []string
+}
+
+// NewMailbox returns the maildrop of the mbox file.
+//
+// path string - path of the mbox file.
+// format Format - format of the file.
+func NewMailbox(path string, format Format) *Mailbox {
+	return &Mailbox{path: path, format: format}
+}
+
+// List reads the mbox file and lists the messages. The sizes
+// are counted with CRLF line endings. The unique-ids are
+// assigned here, see Uidl.
+func (m *Mailbox) List() ([]pop3.MessageInfo, error) {
+	f, err := os.Open(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m.msgs, m.uids = nil, nil
+	r := NewReader(f, m.format)
+	for {
+		msg, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.msgs = append(m.msgs, msg)
+	}
+
+	infos := make([]pop3.MessageInfo, len(m.msgs))
+	seen := make(map[string]bool, len(m.msgs))
+	for i, msg := range m.msgs {
+		size := len(msg.Data) + bytes.Count(msg.Data, []byte("\n"))
+		infos[i] = pop3.MessageInfo{Num: i + 1, Size: size}
+
+		id := headerUID(msg.Data)
+		if id == "" || seen[id] {
+			id = hashUID(i+1, msg.Data)
+		}
+		seen[id] = true
+		m.uids = append(m.uids, id)
+	}
+	return infos, nil
+}
+
+// Uidl returns X-UIDL header of the messages as the
+// unique-ids. The messages without a valid X-UIDL header, and
+// the ones which repeat an X-UIDL of a previous message, get
+// the MD5 of their number and content. So duplicate
+// deliveries get different unique-ids, which do not change
+// between the sessions as long as the messages are only
+// appended to the file.
+func (m *Mailbox) Uidl() ([]pop3.UniqueID, error) {
+	ids := make([]pop3.UniqueID, len(m.uids))
+	for i, id := range m.uids {
+		ids[i] = pop3.UniqueID{Num: i + 1, UID: id}
+	}
+	return ids, nil
+}
+
+// headerUID returns the valid X-UIDL header of the message,
+// or an empty string.
+func headerUID(data []byte) string {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	if h, err := r.ReadMIMEHeader(); err == nil || len(h) > 0 {
+		if id := h.Get("X-UIDL"); validUID(id) {
+			return id
+		}
+	}
+	return ""
+}
+
+// hashUID returns the MD5 of the message number and the
+// content as the unique-id.
+//
+// num int - message number.
+// data []byte - message.
+func hashUID(num int, data []byte) string {
+	h := md5.New()
+	fmt.Fprintf(h, "%d\n", num)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// validUID reports whether the unique-id consists of 1 to 70
+// characters in the range of 0x21 to 0x7E.
+func validUID(id string) bool {
+	if id == "" || len(id) > maxUIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Retr returns the message with the number.
+//
+// num int - message number.
+func (m *Mailbox) Retr(num int) (io.ReadCloser, error) {
+	if num < 1 || num > len(m.msgs) {
+		return nil, fmt.Errorf("mbox: no message %d", num)
+	}
+	return io.NopCloser(bytes.NewReader(m.msgs[num-1].Data)), nil
+}
+
+// ReadOnly returns true, so the server refuses DELE command.
+// It implements server.ReadOnlyMailbox.
+func (m *Mailbox) ReadOnly() bool {
+	return true
+}
+
+// Delete returns ErrReadOnly, because the mbox file is not
+// modified.
+func (m *Mailbox) Delete(nums []int) error {
+	return ErrReadOnly
+}
+
+// Close releases the messages.
+func (m *Mailbox) Close() error {
+	m.msgs, m.uids = nil, nil
+	return nil
+}
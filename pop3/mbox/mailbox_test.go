@@ -0,0 +1,112 @@
+package mbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+	"github.com/gozeloglu/gop-3/pop3/server"
+)
+
+func TestBackend_Serve(t *testing.T) {
+	root := t.TempDir()
+	data := "From a@b.c Sun Nov  7 09:05:03 2021\n" +
+		"Subject: one\nX-UIDL: uidl-one\n\n>From here\n\n" +
+		"From a@b.c Sun Nov  7 09:05:03 2021\n" +
+		"Subject: two\n\nsecond\n\n"
+	if err := os.WriteFile(filepath.Join(root, "user"), []byte(data), 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	srv := pop3test.NewUnstartedServer()
+	srv.Backend = &Backend{Root: root, Authenticate: func(u, p string) error {
+		if p != "secret" {
+			return server.ErrAuthFailed
+		}
+		return nil
+	}}
+	defer srv.Close()
+
+	c := srv.Login(t, nil, "user", "secret")
+	list, err := c.ListAll()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(list) != 2 || list[0].Size != 45 || list[1].Size != 24 {
+		t.Errorf("unexpected LIST: %v", list)
+	}
+	ids, err := c.Uidl()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if ids[0].UID != "uidl-one" || len(ids[1].UID) != 32 {
+		t.Errorf("unexpected UIDL: %v", ids)
+	}
+	msg, err := c.Retr("1")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if msg[len(msg)-1] != "From here" {
+		t.Errorf("message must be unquoted: %q", msg)
+	}
+
+	if _, err = c.Dele("1"); !errors.Is(err, pop3.ErrSysPerm) {
+		t.Errorf("expected ErrSysPerm, got: %v", err)
+	}
+	if _, err = c.Quit(); err != nil {
+		t.Errorf(err.Error())
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, "user")); string(b) != data {
+		t.Errorf("mbox must not be modified")
+	}
+}
+
+func TestMailbox_Missing(t *testing.T) {
+	m := NewMailbox(filepath.Join(t.TempDir(), "none"), Mboxrd)
+	list, err := m.List()
+	if err != nil || len(list) != 0 {
+		t.Errorf("expected empty mailbox, got: %v, %v", list, err)
+	}
+}
+
+func TestMailbox_DuplicateUIDs(t *testing.T) {
+	from := "From a@b.c Sun Nov  7 09:05:03 2021\n"
+	data := from + "Subject: dup\n\nsame\n\n" +
+		from + "Subject: dup\n\nsame\n\n" +
+		from + "X-UIDL: uidl-one\n\nfirst\n\n" +
+		from + "X-UIDL: uidl-one\n\nsecond\n\n"
+	path := filepath.Join(t.TempDir(), "user")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	m := NewMailbox(path, Mboxrd)
+	if _, err := m.List(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	ids, err := m.Uidl()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(ids) != 4 || ids[2].UID != "uidl-one" {
+		t.Fatalf("unexpected UIDL: %v", ids)
+	}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id.UID] {
+			t.Errorf("duplicate unique-id: %v", ids)
+		}
+		seen[id.UID] = true
+	}
+
+	// The unique-ids do not change between the sessions.
+	again := NewMailbox(path, Mboxrd)
+	again.List()
+	if ids2, _ := again.Uidl(); !reflect.DeepEqual(ids, ids2) {
+		t.Errorf("expected: %v, got: %v", ids, ids2)
+	}
+}
@@ -0,0 +1,131 @@
+// Package mbox reads and writes mbox files in mboxrd and
+// mboxcl2 formats. In mboxrd format, the lines which start
+// with "From " after any number of ">" are quoted with one
+// more ">", so the quoting can be reversed. In mboxcl2
+// format, the lines are not quoted and the length of the body
+// is kept in Content-Length header instead.
+//
+// Example:
+// 		f, err := os.OpenFile("archive.mbox", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+// 		if err != nil {
+// 			log.Fatal(err)
+// 		}
+// 		defer f.Close()
+// 		w := mbox.NewWriter(f, mbox.Mboxrd)
+// 		if err = w.WriteRetr(pop, 1); err != nil {
+// 			log.Fatal(err)
+// 		}
+package mbox
+
+import (
+	"bytes"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// ErrFormat is returned when the file is not a valid mbox.
+var ErrFormat = errors.New("mbox: invalid format")
+
+// defaultSender is the envelope sender of From line when the
+// message has no sender.
+const defaultSender = "MAILER-DAEMON"
+
+// Format is the variant of mbox format.
+type Format int
+
+const (
+	// Mboxrd quotes the From lines reversibly.
+	Mboxrd Format = iota
+
+	// Mboxcl2 keeps the length of the body in Content-Length
+	// header and does not quote the lines.
+	Mboxcl2
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case Mboxrd:
+		return "mboxrd"
+	case Mboxcl2:
+		return "mboxcl2"
+	}
+	return "unknown"
+}
+
+// Message is a message of an mbox file.
+type Message struct {
+	// From is the envelope sender in From line. If it is
+	// empty, Writer uses the address in Return-Path or From
+	// header.
+	From string
+
+	// Date is the delivery time in From line. If it is zero,
+	// Writer uses Date header, or the current time if the
+	// header is missing.
+	Date time.Time
+
+	// Data is the message with headers and body. The From line
+	// and the quoting are not included. The lines end with LF.
+	Data []byte
+}
+
+// envelope returns the sender and the date of From line. The
+// missing fields are taken from the headers of the message.
+func (m *Message) envelope() (string, time.Time) {
+	from, date := m.From, m.Date
+	if from != "" && !date.IsZero() {
+		return from, date
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Data))
+	if err == nil {
+		for _, h := range []string{"Return-Path", "From"} {
+			if from != "" {
+				break
+			}
+			if addr, err := mail.ParseAddress(msg.Header.Get(h)); err == nil {
+				from = addr.Address
+			}
+		}
+		if date.IsZero() {
+			date, _ = msg.Header.Date()
+		}
+	}
+	if from == "" || strings.ContainsAny(from, " \t") {
+		from = defaultSender
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+	return from, date
+}
+
+// toLF converts CRLF line endings to LF.
+func toLF(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+}
+
+// fromLine returns the From line of the message.
+func fromLine(sender string, date time.Time) string {
+	return "From " + sender + " " + date.UTC().Format(time.ANSIC) + "\n"
+}
+
+// parseFromLine parses the sender and the date of From line.
+// The date is zero if it cannot be parsed.
+func parseFromLine(line string) (string, time.Time) {
+	line = strings.TrimRight(strings.TrimPrefix(line, "From "), "\r\n")
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) < 2 {
+		return fields[0], time.Time{}
+	}
+	date, _ := time.Parse(time.ANSIC, strings.TrimSpace(fields[1]))
+	return fields[0], date
+}
+
+// isQuotedFrom reports whether the line matches ">*From ".
+func isQuotedFrom(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From "))
+}
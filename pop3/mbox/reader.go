@@ -0,0 +1,164 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// fromPrefix starts the From line of every message.
+var fromPrefix = []byte("From ")
+
+// Reader reads the messages of an mbox file one by one.
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+
+	// from keeps the From line of the next message which is
+	// read at the end of the previous message.
+	from []byte
+
+	// err keeps the read error, so it is returned again.
+	err error
+}
+
+// NewReader returns a reader of the mbox in the given format.
+// Mboxcl2 reader splits the messages without Content-Length
+// header at the From lines.
+//
+// r io.Reader - mbox file.
+// format Format - Mboxrd or Mboxcl2
+func NewReader(r io.Reader, format Format) *Reader {
+	return &Reader{r: bufio.NewReader(r), format: format}
+}
+
+// Next reads the next message. The quoting of Mboxrd format
+// is reversed and the line endings are converted to LF. It
+// returns io.EOF after the last message, and ErrFormat if the
+// file is not a valid mbox.
+// Example:
+// 		r := mbox.NewReader(f, mbox.Mboxrd)
+// 		for {
+// 			m, err := r.Next()
+// 			if err == io.EOF {
+// 				break
+// 			}
+// 			...
+// 		}
+func (r *Reader) Next() (*Message, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	m, err := r.next()
+	if err != nil {
+		r.err = err
+		return nil, err
+	}
+	return m, nil
+}
+
+// next is the implementation of the Next function.
+func (r *Reader) next() (*Message, error) {
+	line := r.from
+	r.from = nil
+	for line == nil {
+		l, err := r.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(l)) > 0 {
+			if !bytes.HasPrefix(l, fromPrefix) {
+				return nil, fmt.Errorf("%w: message does not start with From line", ErrFormat)
+			}
+			line = l
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Message{}
+	m.From, m.Date = parseFromLine(string(line))
+	var err error
+	if r.format == Mboxcl2 {
+		m.Data, err = r.readContentLength()
+	} else {
+		m.Data, err = r.readLines(nil, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readLines reads the lines until the next From line or the
+// end of the file. The empty line before the From line is
+// removed.
+//
+// data []byte - lines which are read before.
+// unquote bool - reverse the quoting of Mboxrd format.
+func (r *Reader) readLines(data []byte, unquote bool) ([]byte, error) {
+	for {
+		l, err := r.r.ReadBytes('\n')
+		if bytes.HasPrefix(l, fromPrefix) {
+			r.from = l
+			break
+		}
+		if unquote && len(l) > 0 && l[0] == '>' && isQuotedFrom(l) {
+			l = l[1:]
+		}
+		data = append(data, l...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	data = toLF(data)
+	if bytes.HasSuffix(data, []byte("\n\n")) {
+		data = data[:len(data)-1]
+	}
+	return data, nil
+}
+
+// readContentLength reads the header and the body with the
+// length in Content-Length header.
+func (r *Reader) readContentLength() ([]byte, error) {
+	var header []byte
+	length := -1
+	for {
+		l, err := r.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		header = append(header, l...)
+		l = bytes.TrimRight(l, "\r\n")
+		if len(l) == 0 || err == io.EOF {
+			break
+		}
+		if i := bytes.IndexByte(l, ':'); i > 0 && bytes.EqualFold(l[:i], []byte("Content-Length")) {
+			n, perr := strconv.Atoi(string(bytes.TrimSpace(l[i+1:])))
+			if perr != nil || n < 0 {
+				n = -1
+			}
+			length = n
+		}
+	}
+	if length < 0 {
+		return r.readLines(header, false)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return nil, fmt.Errorf("%w: message is shorter than Content-Length", ErrFormat)
+	}
+	l, err := r.r.ReadBytes('\n')
+	switch {
+	case len(l) == 0 && err == io.EOF:
+	case bytes.HasPrefix(l, fromPrefix):
+		r.from = l
+	case len(bytes.TrimRight(l, "\r\n")) == 0:
+	default:
+		return nil, fmt.Errorf("%w: Content-Length does not end at a message", ErrFormat)
+	}
+	return toLF(append(header, body...)), nil
+}
@@ -0,0 +1,98 @@
+package mbox
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, r *Reader) []*Message {
+	var msgs []*Message
+	for {
+		m, err := r.Next()
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+func TestReader_RoundTrip(t *testing.T) {
+	data := []string{
+		"Subject: one\n\nFrom here\n>From there\n>>From everywhere\n",
+		"Subject: two\n\n\nends with empty lines\n\n",
+		"Subject: three\n\nlast\n",
+	}
+	for _, format := range []Format{Mboxrd, Mboxcl2} {
+		var b bytes.Buffer
+		w := NewWriter(&b, format)
+		for _, d := range data {
+			if err := w.WriteMessage(&Message{From: "a@b.c", Date: testDate, Data: []byte(d)}); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+
+		msgs := readAll(t, NewReader(&b, format))
+		if len(msgs) != len(data) {
+			t.Fatalf("%s: expected %d messages, got: %d", format, len(data), len(msgs))
+		}
+		for i, m := range msgs {
+			expected := data[i]
+			if format == Mboxcl2 {
+				expected = string(withContentLength([]byte(expected)))
+			}
+			if m.From != "a@b.c" || !m.Date.Equal(testDate) {
+				t.Errorf("%s: unexpected envelope: %s %s", format, m.From, m.Date)
+			}
+			if string(m.Data) != expected {
+				t.Errorf("%s: expected: %q, got: %q", format, expected, m.Data)
+			}
+		}
+	}
+}
+
+func TestReader_Mboxcl2UnquotedFrom(t *testing.T) {
+	mbox := "From a@b.c Sun Nov  7 09:05:03 2021\n" +
+		"Subject: Hi\nContent-Length: 15\n\nFrom the body\n\n\n" +
+		"From a@b.c Sun Nov  7 09:05:03 2021\n" +
+		"Subject: Bye\n\nno length\n\n"
+	msgs := readAll(t, NewReader(strings.NewReader(mbox), Mboxcl2))
+	var got []string
+	for _, m := range msgs {
+		got = append(got, string(m.Data))
+	}
+	expected := []string{
+		"Subject: Hi\nContent-Length: 15\n\nFrom the body\n\n",
+		"Subject: Bye\n\nno length\n",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected: %q, got: %q", expected, got)
+	}
+}
+
+func TestReader_Invalid(t *testing.T) {
+	r := NewReader(strings.NewReader("Subject: no From line\n"), Mboxrd)
+	if _, err := r.Next(); !errors.Is(err, ErrFormat) {
+		t.Errorf("expected ErrFormat, got: %v", err)
+	}
+
+	mbox := "From a@b.c Sun Nov  7 09:05:03 2021\nContent-Length: 100\n\nshort\n"
+	r = NewReader(strings.NewReader(mbox), Mboxcl2)
+	if _, err := r.Next(); !errors.Is(err, ErrFormat) {
+		t.Errorf("expected ErrFormat, got: %v", err)
+	}
+}
+
+func TestReader_CRLF(t *testing.T) {
+	mbox := "From a@b.c Sun Nov  7 09:05:03 2021\r\nSubject: Hi\r\n\r\n>From x\r\n\r\n"
+	msgs := readAll(t, NewReader(strings.NewReader(mbox), Mboxrd))
+	if len(msgs) != 1 || string(msgs[0].Data) != "Subject: Hi\n\nFrom x\n" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+}
@@ -0,0 +1,117 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/gozeloglu/gop-3/pop3"
+)
+
+// Writer appends messages to an mbox file.
+type Writer struct {
+	w      *bufio.Writer
+	format Format
+}
+
+// NewWriter returns a writer which writes the messages in the
+// given format. The file should be opened in append mode to
+// add messages to an existing mbox.
+//
+// w io.Writer - mbox file.
+// format Format - Mboxrd or Mboxcl2
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{w: bufio.NewWriter(w), format: format}
+}
+
+// WriteMessage writes the From line and the message followed
+// by an empty line. CRLF line endings are converted to LF.
+//
+// m *Message - message to write.
+func (w *Writer) WriteMessage(m *Message) error {
+	from, date := m.envelope()
+	data := toLF(m.Data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+
+	w.w.WriteString(fromLine(from, date))
+	if w.format == Mboxcl2 {
+		w.w.Write(withContentLength(data))
+	} else {
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n') + 1
+			line := data[:i]
+			if isQuotedFrom(line) {
+				w.w.WriteByte('>')
+			}
+			w.w.Write(line)
+			data = data[i:]
+		}
+	}
+	w.w.WriteByte('\n')
+	return w.w.Flush()
+}
+
+// withContentLength replaces Content-Length headers of the
+// message with the length of the body.
+func withContentLength(data []byte) []byte {
+	var header, body []byte
+	if bytes.HasPrefix(data, []byte("\n")) {
+		body = data[1:]
+	} else if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		header, body = data[:i+1], data[i+2:]
+	} else {
+		header = data
+	}
+
+	var b bytes.Buffer
+	skip := false
+	for len(header) > 0 {
+		i := bytes.IndexByte(header, '\n') + 1
+		line := header[:i]
+		header = header[i:]
+		// Continuation lines belong to the previous header.
+		if line[0] == ' ' || line[0] == '\t' {
+			if !skip {
+				b.Write(line)
+			}
+			continue
+		}
+		skip = bytes.HasPrefix(bytes.ToLower(line), []byte("content-length:"))
+		if !skip {
+			b.Write(line)
+		}
+	}
+	b.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\n\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
+// WriteRetr retrieves the message from the client and writes
+// it. The envelope of From line is taken from the headers of
+// the message.
+//
+// c *pop3.Client - client in TRANSACTION state.
+// msgNum int - message number.
+func (w *Writer) WriteRetr(c *pop3.Client, msgNum int) error {
+	return w.WriteRetrContext(context.Background(), c, msgNum)
+}
+
+// WriteRetrContext is the context-aware version of WriteRetr.
+func (w *Writer) WriteRetrContext(ctx context.Context, c *pop3.Client, msgNum int) error {
+	r, err := c.RetrReaderContext(ctx, msgNum)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return w.WriteMessage(&Message{Data: data})
+}
@@ -0,0 +1,96 @@
+package mbox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+var testDate = time.Date(2021, 11, 7, 9, 5, 3, 0, time.UTC)
+
+func TestWriter_Mboxrd(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b, Mboxrd)
+	err := w.WriteMessage(&Message{
+		From: "john@example.com",
+		Date: testDate,
+		Data: []byte("Subject: Hi\r\n\r\nFrom here\r\n>From there\r\nFromage\r\n"),
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := "From john@example.com Sun Nov  7 09:05:03 2021\n" +
+		"Subject: Hi\n\n>From here\n>>From there\nFromage\n\n"
+	if b.String() != expected {
+		t.Errorf("expected: %q, got: %q", expected, b.String())
+	}
+}
+
+func TestWriter_Mboxcl2(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b, Mboxcl2)
+	err := w.WriteMessage(&Message{
+		From: "john@example.com",
+		Date: testDate,
+		Data: []byte("Subject: Hi\nContent-Length: 999\n  continued\n\nFrom here\n"),
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := "From john@example.com Sun Nov  7 09:05:03 2021\n" +
+		"Subject: Hi\nContent-Length: 10\n\nFrom here\n\n"
+	if b.String() != expected {
+		t.Errorf("expected: %q, got: %q", expected, b.String())
+	}
+}
+
+func TestWriter_Envelope(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b, Mboxrd)
+	err := w.WriteMessage(&Message{
+		Data: []byte("From: Jane <jane@example.com>\nDate: Sun, 07 Nov 2021 09:05:03 +0000\n\nbody"),
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.HasPrefix(b.String(), "From jane@example.com Sun Nov  7 09:05:03 2021\n") {
+		t.Errorf("unexpected From line: %q", b.String())
+	}
+	if !strings.HasSuffix(b.String(), "\nbody\n\n") {
+		t.Errorf("message must end with a newline and an empty line: %q", b.String())
+	}
+}
+
+func TestWriter_WriteRetr(t *testing.T) {
+	srv := pop3test.NewServer()
+	defer srv.Close()
+	srv.AddMailbox("user", "secret", pop3test.Message{
+		Data: "Return-Path: <bounce@example.com>\r\nSubject: Hi\r\n\r\nFrom the client\r\n.dot\r\n",
+	})
+	c, err := pop3.Connect(srv.Addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer c.Quit()
+	c.User("user")
+	if _, err = c.Pass("secret"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	var b bytes.Buffer
+	if err = NewWriter(&b, Mboxrd).WriteRetr(c, 1); err != nil {
+		t.Fatalf(err.Error())
+	}
+	lines := strings.Split(b.String(), "\n")
+	if !strings.HasPrefix(lines[0], "From bounce@example.com ") {
+		t.Errorf("unexpected From line: %q", lines[0])
+	}
+	expected := []string{"Return-Path: <bounce@example.com>", "Subject: Hi", "", ">From the client", ".dot", "", ""}
+	if strings.Join(lines[1:], "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected: %q, got: %q", expected, lines[1:])
+	}
+}
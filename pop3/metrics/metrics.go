@@ -0,0 +1,217 @@
+// Package metrics collects the command events of pop3.Client
+// and exposes them in the Prometheus text exposition format,
+// so the pollers can be scraped by Prometheus without
+// importing its client library. The same Collector can be
+// shared by many clients; the series are labeled with the
+// server address.
+//
+// Example:
+// 		col := metrics.NewCollector()
+// 		http.Handle("/metrics", col)
+// 		d := &pop3.Dialer{Mode: pop3.ModeTLS, Observer: col}
+// 		pop, err := d.Dial("pop.gmail.com:995")
+//
+// The collector exports the following metrics:
+// 		pop3_commands_total{addr,cmd,outcome,code}
+// 		pop3_command_duration_seconds{addr,cmd} (histogram)
+// 		pop3_read_bytes_total{addr,cmd}
+// 		pop3_written_bytes_total{addr,cmd}
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gozeloglu/gop-3/pop3"
+)
+
+// DefaultBuckets are the upper bounds of the duration histogram
+// in seconds. They are the default buckets of Prometheus.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ContentType is the content type of the text exposition
+// format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// commandKey identifies a series of pop3_commands_total.
+type commandKey struct {
+	addr, cmd, outcome, code string
+}
+
+// seriesKey identifies a series of the per command metrics.
+type seriesKey struct {
+	addr, cmd string
+}
+
+// histogram is a cumulative histogram of durations.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Collector implements pop3.Observer and keeps the counters
+// and histograms of the commands. It is safe for concurrent
+// use.
+type Collector struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	commands  map[commandKey]uint64
+	durations map[seriesKey]*histogram
+	read      map[seriesKey]int64
+	written   map[seriesKey]int64
+}
+
+// NewCollector returns a Collector with the default buckets.
+func NewCollector() *Collector {
+	return NewCollectorBuckets(DefaultBuckets)
+}
+
+// NewCollectorBuckets returns a Collector with the given
+// duration buckets.
+//
+// buckets []float64 - upper bounds in seconds, in increasing order.
+func NewCollectorBuckets(buckets []float64) *Collector {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Collector{
+		buckets:   b,
+		commands:  make(map[commandKey]uint64),
+		durations: make(map[seriesKey]*histogram),
+		read:      make(map[seriesKey]int64),
+		written:   make(map[seriesKey]int64),
+	}
+}
+
+// ObserveCommand records the command event.
+func (c *Collector) ObserveCommand(ev pop3.CommandEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commands[commandKey{ev.Addr, ev.Cmd, ev.Outcome.String(), ev.Code}]++
+
+	k := seriesKey{ev.Addr, ev.Cmd}
+	h := c.durations[k]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.durations[k] = h
+	}
+	secs := ev.Duration.Seconds()
+	for i, le := range c.buckets {
+		if secs <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += secs
+
+	c.read[k] += ev.BytesRead
+	c.written[k] += ev.BytesWritten
+}
+
+// WriteTo writes the metrics in the text exposition format.
+// The series are sorted, so the output is stable. They are
+// copied before writing, so a slow writer does not block the
+// clients.
+//
+// w io.Writer - destination, e.g. http.ResponseWriter
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	return c.render().WriteTo(w)
+}
+
+// render formats the metrics while holding the lock.
+func (c *Collector) render() *bytes.Buffer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := &bytes.Buffer{}
+
+	fmt.Fprintf(b, "# HELP pop3_commands_total Number of POP3 commands by outcome and response code.\n")
+	fmt.Fprintf(b, "# TYPE pop3_commands_total counter\n")
+	cmdKeys := make([]commandKey, 0, len(c.commands))
+	for k := range c.commands {
+		cmdKeys = append(cmdKeys, k)
+	}
+	sort.Slice(cmdKeys, func(i, j int) bool {
+		a, b := cmdKeys[i], cmdKeys[j]
+		if a.addr != b.addr {
+			return a.addr < b.addr
+		}
+		if a.cmd != b.cmd {
+			return a.cmd < b.cmd
+		}
+		if a.outcome != b.outcome {
+			return a.outcome < b.outcome
+		}
+		return a.code < b.code
+	})
+	for _, k := range cmdKeys {
+		fmt.Fprintf(b, "pop3_commands_total{addr=%s,cmd=%s,outcome=%s,code=%s} %d\n",
+			quote(k.addr), quote(k.cmd), quote(k.outcome), quote(k.code), c.commands[k])
+	}
+
+	keys := make([]seriesKey, 0, len(c.durations))
+	for k := range c.durations {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].addr != keys[j].addr {
+			return keys[i].addr < keys[j].addr
+		}
+		return keys[i].cmd < keys[j].cmd
+	})
+
+	fmt.Fprintf(b, "# HELP pop3_command_duration_seconds Duration of POP3 commands including the response.\n")
+	fmt.Fprintf(b, "# TYPE pop3_command_duration_seconds histogram\n")
+	for _, k := range keys {
+		h := c.durations[k]
+		labels := "addr=" + quote(k.addr) + ",cmd=" + quote(k.cmd)
+		for i, le := range c.buckets {
+			fmt.Fprintf(b, "pop3_command_duration_seconds_bucket{%s,le=%s} %d\n", labels, quote(formatFloat(le)), h.counts[i])
+		}
+		fmt.Fprintf(b, "pop3_command_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(b, "pop3_command_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.sum))
+		fmt.Fprintf(b, "pop3_command_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	for _, m := range []struct {
+		name, help string
+		values     map[seriesKey]int64
+	}{
+		{"pop3_read_bytes_total", "Octets of the POP3 responses.", c.read},
+		{"pop3_written_bytes_total", "Octets of the POP3 command lines.", c.written},
+	} {
+		fmt.Fprintf(b, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(b, "# TYPE %s counter\n", m.name)
+		for _, k := range keys {
+			fmt.Fprintf(b, "%s{addr=%s,cmd=%s} %d\n", m.name, quote(k.addr), quote(k.cmd), m.values[k])
+		}
+	}
+	return b
+}
+
+// ServeHTTP writes the metrics as the response, so the
+// Collector can be scraped.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	c.WriteTo(w)
+}
+
+// labelEscaper escapes the label values as the text format
+// requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quote returns the escaped label value in double quotes.
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+// formatFloat formats the value in the shortest form.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+func TestCollector_WriteTo(t *testing.T) {
+	col := NewCollectorBuckets([]float64{1, 0.1})
+	col.ObserveCommand(pop3.CommandEvent{
+		Addr: "pop.example.com:995", Cmd: "RETR", Duration: 50 * time.Millisecond,
+		BytesRead: 1000, BytesWritten: 8,
+	})
+	col.ObserveCommand(pop3.CommandEvent{
+		Addr: "pop.example.com:995", Cmd: "RETR", Duration: 2 * time.Second,
+		BytesRead: 20, BytesWritten: 8, Outcome: pop3.OutcomeServerError, Code: "SYS/TEMP",
+		Err: errors.New("RETR: -ERR [SYS/TEMP] busy"),
+	})
+	col.ObserveCommand(pop3.CommandEvent{
+		Addr: `odd"addr`, Cmd: "NOOP", Duration: time.Millisecond, Outcome: pop3.OutcomeError,
+	})
+
+	var sb strings.Builder
+	n, err := col.WriteTo(&sb)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if int(n) != sb.Len() {
+		t.Errorf("expected %d bytes, got: %d", sb.Len(), n)
+	}
+	expected := `# HELP pop3_commands_total Number of POP3 commands by outcome and response code.
+# TYPE pop3_commands_total counter
+pop3_commands_total{addr="odd\"addr",cmd="NOOP",outcome="error",code=""} 1
+pop3_commands_total{addr="pop.example.com:995",cmd="RETR",outcome="ok",code=""} 1
+pop3_commands_total{addr="pop.example.com:995",cmd="RETR",outcome="server_error",code="SYS/TEMP"} 1
+# HELP pop3_command_duration_seconds Duration of POP3 commands including the response.
+# TYPE pop3_command_duration_seconds histogram
+pop3_command_duration_seconds_bucket{addr="odd\"addr",cmd="NOOP",le="0.1"} 1
+pop3_command_duration_seconds_bucket{addr="odd\"addr",cmd="NOOP",le="1"} 1
+pop3_command_duration_seconds_bucket{addr="odd\"addr",cmd="NOOP",le="+Inf"} 1
+pop3_command_duration_seconds_sum{addr="odd\"addr",cmd="NOOP"} 0.001
+pop3_command_duration_seconds_count{addr="odd\"addr",cmd="NOOP"} 1
+pop3_command_duration_seconds_bucket{addr="pop.example.com:995",cmd="RETR",le="0.1"} 1
+pop3_command_duration_seconds_bucket{addr="pop.example.com:995",cmd="RETR",le="1"} 1
+pop3_command_duration_seconds_bucket{addr="pop.example.com:995",cmd="RETR",le="+Inf"} 2
+pop3_command_duration_seconds_sum{addr="pop.example.com:995",cmd="RETR"} 2.05
+pop3_command_duration_seconds_count{addr="pop.example.com:995",cmd="RETR"} 2
+# HELP pop3_read_bytes_total Octets of the POP3 responses.
+# TYPE pop3_read_bytes_total counter
+pop3_read_bytes_total{addr="odd\"addr",cmd="NOOP"} 0
+pop3_read_bytes_total{addr="pop.example.com:995",cmd="RETR"} 1020
+# HELP pop3_written_bytes_total Octets of the POP3 command lines.
+# TYPE pop3_written_bytes_total counter
+pop3_written_bytes_total{addr="odd\"addr",cmd="NOOP"} 0
+pop3_written_bytes_total{addr="pop.example.com:995",cmd="RETR"} 16
+`
+	if got := sb.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestCollector_Client(t *testing.T) {
+	srv := pop3test.NewServer()
+	defer srv.Close()
+	srv.AddMailbox("user", "secret", pop3test.Message{Data: "Subject: Hi\r\n\r\nHello\r\n"})
+	srv.Fail("DELE", pop3test.Failure{Resp: "-ERR [SYS/TEMP] try again later"})
+
+	col := NewCollector()
+	d := &pop3.Dialer{Observer: col}
+	pop, err := d.Dial(srv.Addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pop.User("user")
+	pop.Pass("secret")
+	pop.Retr("1")
+	pop.Dele("1")
+	pop.Quit()
+
+	rec := httptest.NewRecorder()
+	col.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	body := rec.Body.String()
+	for _, s := range []string{
+		`pop3_commands_total{addr="` + srv.Addr + `",cmd="RETR",outcome="ok",code=""} 1`,
+		`pop3_commands_total{addr="` + srv.Addr + `",cmd="DELE",outcome="server_error",code="SYS/TEMP"} 1`,
+		`pop3_commands_total{addr="` + srv.Addr + `",cmd="QUIT",outcome="ok",code=""} 1`,
+		`pop3_written_bytes_total{addr="` + srv.Addr + `",cmd="RETR"} 8`,
+		`pop3_command_duration_seconds_count{addr="` + srv.Addr + `",cmd="PASS"} 1`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("metrics must contain %q:\n%s", s, body)
+		}
+	}
+}
+
+// stalledWriter blocks every write until release is closed.
+type stalledWriter struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	close(w.started)
+	<-w.release
+	return len(p), nil
+}
+
+func TestCollector_WriteToStalled(t *testing.T) {
+	col := NewCollector()
+	col.ObserveCommand(pop3.CommandEvent{Addr: "pop.example.com:995", Cmd: "NOOP"})
+	w := &stalledWriter{started: make(chan struct{}), release: make(chan struct{})}
+	defer close(w.release)
+	go col.WriteTo(w)
+	<-w.started
+
+	done := make(chan struct{})
+	go func() {
+		col.ObserveCommand(pop3.CommandEvent{Addr: "pop.example.com:995", Cmd: "NOOP"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("ObserveCommand must not wait for the writer")
+	}
+}
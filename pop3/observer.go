@@ -0,0 +1,111 @@
+package pop3
+
+import (
+	"errors"
+	"time"
+)
+
+// Outcome is the result of a command.
+type Outcome int
+
+const (
+	// OutcomeOK is a positive response ("+OK").
+	OutcomeOK Outcome = iota
+
+	// OutcomeServerError is a negative response ("-ERR").
+	OutcomeServerError
+
+	// OutcomeError is a failure of the connection, a timeout,
+	// a cancellation or a protocol violation.
+	OutcomeError
+)
+
+// String returns the name of the outcome which can be used as
+// a metric label.
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeOK:
+		return "ok"
+	case OutcomeServerError:
+		return "server_error"
+	}
+	return "error"
+}
+
+// CommandEvent describes a finished command.
+type CommandEvent struct {
+	// Addr is the address of the server.
+	Addr string
+
+	// Cmd is the name of the command, e.g. "RETR".
+	Cmd string
+
+	// Duration is the time from the start of the command
+	// until the whole response is read. For RetrReader, it
+	// ends when the reader is closed.
+	Duration time.Duration
+
+	// BytesRead is the size of the response in octets.
+	BytesRead int64
+
+	// BytesWritten is the size of the command lines in
+	// octets, including the SASL responses.
+	BytesWritten int64
+
+	// Outcome is the result of the command.
+	Outcome Outcome
+
+	// Code is the extended response code of the negative
+	// response, e.g. "SYS/TEMP". It is empty if the server
+	// sends no code.
+	Code string
+
+	// Err is the error of the command, or <nil>.
+	Err error
+}
+
+// Observer receives the events of the commands, e.g. to record
+// metrics. ObserveCommand is called when the command finishes,
+// while the client is still locked, so it must be fast and it
+// must not call the Client. The commands which are refused
+// before sending, e.g. in the wrong state, are not observed.
+type Observer interface {
+	ObserveCommand(ev CommandEvent)
+}
+
+// ObserverFunc is a function which implements Observer.
+type ObserverFunc func(ev CommandEvent)
+
+// ObserveCommand calls f(ev).
+func (f ObserverFunc) ObserveCommand(ev CommandEvent) {
+	f(ev)
+}
+
+// observeCmd sends the event of the finished command to the
+// Observer.
+//
+// err error - error of the command.
+func (c *Client) observeCmd(err error) {
+	if c.Observer == nil || c.cmd == "" {
+		return
+	}
+	ev := CommandEvent{
+		Addr:         c.cmdAddr,
+		Cmd:          c.cmd,
+		Duration:     time.Since(c.cmdStart),
+		BytesRead:    c.respBytes,
+		BytesWritten: c.sentBytes,
+		Err:          err,
+	}
+	var se *ServerError
+	switch {
+	case err == nil:
+		ev.Outcome = OutcomeOK
+	case errors.As(err, &se):
+		ev.Outcome = OutcomeServerError
+		ev.Code = se.Code
+	default:
+		ev.Outcome = OutcomeError
+	}
+	c.Observer.ObserveCommand(ev)
+}
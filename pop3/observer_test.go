@@ -0,0 +1,80 @@
+package pop3_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+func TestClient_Observer(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.Fail("DELE", pop3test.Failure{Resp: "-ERR [SYS/TEMP] try again later"})
+	var events []pop3.CommandEvent
+	d := &pop3.Dialer{Observer: pop3.ObserverFunc(func(ev pop3.CommandEvent) {
+		events = append(events, ev)
+	})}
+	pop, err := d.Dial(srv.Addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pop.Stat()
+	pop.User(testUser)
+	pop.Pass(testPassword)
+	r, err := pop.RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	r.Close()
+	pop.Dele("1")
+	pop.Quit()
+
+	// STAT is refused in AUTHORIZATION state before sending.
+	cmds := []string{"USER", "PASS", "RETR", "DELE", "QUIT"}
+	if len(events) != len(cmds) {
+		t.Fatalf("expected %d events, got: %+v", len(cmds), events)
+	}
+	for i, cmd := range cmds {
+		if events[i].Cmd != cmd || events[i].Addr != srv.Addr {
+			t.Errorf("event %d: unexpected event: %+v", i, events[i])
+		}
+	}
+	retr := events[2]
+	if retr.Outcome != pop3.OutcomeOK || retr.BytesWritten != 8 || retr.BytesRead <= 61 || retr.Duration <= 0 {
+		t.Errorf("unexpected RETR event: %+v", retr)
+	}
+	dele := events[3]
+	if dele.Outcome != pop3.OutcomeServerError || dele.Code != "SYS/TEMP" || !errors.Is(dele.Err, pop3.ErrSysTemp) {
+		t.Errorf("unexpected DELE event: %+v", dele)
+	}
+}
+
+func TestClient_ObserverConnectionError(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.Fail("NOOP", pop3test.Failure{Close: true})
+	var events []pop3.CommandEvent
+	pop, err := pop3.Connect(srv.Addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pop.Observer = pop3.ObserverFunc(func(ev pop3.CommandEvent) {
+		events = append(events, ev)
+	})
+	pop.User(testUser)
+	pop.Pass(testPassword)
+	if _, err = pop.Noop(); err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(events) != 3 || events[2].Outcome != pop3.OutcomeError || events[2].Code != "" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestOutcome_String(t *testing.T) {
+	for o, s := range map[pop3.Outcome]string{pop3.OutcomeOK: "ok", pop3.OutcomeServerError: "server_error", pop3.OutcomeError: "error"} {
+		if o.String() != s {
+			t.Errorf("expected: %s, got: %s", s, o)
+		}
+	}
+}
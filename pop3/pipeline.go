@@ -0,0 +1,380 @@
+package pop3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPipelineWindow is the number of the commands which
+// are sent ahead by the batch commands if PipelineWindow of
+// the Client is zero.
+const DefaultPipelineWindow = 16
+
+// BatchError is returned by the batch commands, such as
+// DeleMany, when the server rejects some of the messages. The
+// other messages are processed. errors.Is and errors.As check
+// every error, e.g. errors.Is(err, ErrSysTemp).
+type BatchError struct {
+	// Errs keeps the errors in the order of the message
+	// numbers. It is <nil> for the accepted messages.
+	Errs []error
+}
+
+// Error returns the number of the failed commands and the
+// first error.
+func (b *BatchError) Error() string {
+	var first error
+	n := 0
+	for _, err := range b.Errs {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			n++
+		}
+	}
+	return fmt.Sprintf("%d of %d commands failed, first: %v", n, len(b.Errs), first)
+}
+
+// Unwrap returns the errors of the failed commands.
+func (b *BatchError) Unwrap() []error {
+	var errs []error
+	for _, err := range b.Errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// handlerError is the error of the RetrMany handler. It stops
+// the batch, unlike the negative responses.
+type handlerError struct {
+	err error
+}
+
+func (h handlerError) Error() string { return h.err.Error() }
+
+// DeleMany marks the messages as deleted. If the server
+// announces PIPELINING capability (RFC 2449), the commands are
+// sent in a window without waiting for each response,
+// otherwise they are sent one by one. The capabilities are
+// fetched with CAPA if Capa has not been called. Like Dele,
+// the messages are deleted when the session quits. If some of
+// the messages are rejected, *BatchError is returned. Each
+// command of the batch is logged and observed by itself.
+// Example:
+// 		C: DELE 1
+// 		C: DELE 2
+// 		C: DELE 3
+// 		S: +OK message 1 deleted
+// 		S: +OK message 2 deleted
+// 		S: -ERR no such message
+//
+// nums []int - message numbers.
+func (c *Client) DeleMany(nums []int) error {
+	return c.DeleManyContext(context.Background(), nums)
+}
+
+// DeleManyContext is the context-aware version of DeleMany.
+func (c *Client) DeleManyContext(ctx context.Context, nums []int) error {
+	if err := c.ensureCapa(ctx); err != nil {
+		return err
+	}
+	end, err := c.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return end(c.deleMany(nums))
+}
+
+// deleMany is the implementation of the DeleMany function.
+func (c *Client) deleMany(nums []int) error {
+	cmds, err := c.batchCmds("DELE", nums, "")
+	if err != nil {
+		return err
+	}
+	return c.pipeline(cmds, false, func(i int) error {
+		resp, err := c.readResp()
+		if err != nil {
+			return err
+		}
+		return respErr("DELE", resp)
+	})
+}
+
+// TopMany returns the headers and the first n lines of the
+// bodies of the messages. The commands are pipelined like
+// DeleMany. The results are in the order of nums, and each of
+// them is in the form of Top. The result of a rejected
+// message is <nil> and its error is in *BatchError.
+//
+// nums []int - message numbers.
+// n int - number of the body lines.
+func (c *Client) TopMany(nums []int, n int) ([][]string, error) {
+	return c.TopManyContext(context.Background(), nums, n)
+}
+
+// TopManyContext is the context-aware version of TopMany.
+func (c *Client) TopManyContext(ctx context.Context, nums []int, n int) ([][]string, error) {
+	if err := c.ensureCapa(ctx); err != nil {
+		return nil, err
+	}
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.topMany(nums, n)
+	return resp, end(err)
+}
+
+// topMany is the implementation of the TopMany function.
+func (c *Client) topMany(nums []int, n int) ([][]string, error) {
+	if n < 0 {
+		return nil, errLineCount
+	}
+	cmds, err := c.batchCmds("TOP", nums, " "+strconv.Itoa(n))
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]string, len(nums))
+	err = c.pipeline(cmds, true, func(i int) error {
+		lines, err := c.readRespMultiLines()
+		if err != nil {
+			return err
+		}
+		if err = respErr("TOP", lines[0]); err != nil {
+			return err
+		}
+		results[i] = lines
+		return nil
+	})
+	return results, err
+}
+
+// RetrMany retrieves the messages and calls the handler with
+// the body of each message, in the order of nums. The body is
+// read like RetrReader; the rest of it is skipped when the
+// handler returns. The commands are pipelined like DeleMany.
+// If the handler returns an error, no more commands are sent,
+// the responses which are on the way are skipped and the
+// error is returned. The rejected messages are not passed to
+// the handler and their errors are in *BatchError. The handler
+// is called while the client is locked, so it must not call
+// the Client; e.g. the messages can be deleted with DeleMany
+// after RetrMany returns.
+//
+// nums []int - message numbers.
+// handler func(int, io.Reader) error - called with the message number and the body.
+func (c *Client) RetrMany(nums []int, handler func(msgNum int, r io.Reader) error) error {
+	return c.RetrManyContext(context.Background(), nums, handler)
+}
+
+// RetrManyContext is the context-aware version of RetrMany.
+func (c *Client) RetrManyContext(ctx context.Context, nums []int, handler func(msgNum int, r io.Reader) error) error {
+	if err := c.ensureCapa(ctx); err != nil {
+		return err
+	}
+	end, err := c.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return end(c.retrMany(nums, handler))
+}
+
+// retrMany is the implementation of the RetrMany function.
+func (c *Client) retrMany(nums []int, handler func(msgNum int, r io.Reader) error) error {
+	cmds, err := c.batchCmds("RETR", nums, "")
+	if err != nil {
+		return err
+	}
+	return c.pipeline(cmds, true, func(i int) error {
+		resp, err := c.readResp()
+		if err != nil {
+			return err
+		}
+		if err = respErr("RETR", resp); err != nil {
+			return err
+		}
+		r := &dotReader{c: c, batch: true}
+		herr := handler(nums[i], r)
+		if err = r.Close(); err != nil {
+			return err
+		}
+		if herr != nil {
+			return handlerError{herr}
+		}
+		return nil
+	})
+}
+
+// batchCmds checks the state and the message numbers, and
+// returns the command lines of the batch.
+//
+// cmd string - command name, e.g. "DELE"
+// nums []int - message numbers.
+// suffix string - rest of the command line after the number.
+func (c *Client) batchCmds(cmd string, nums []int, suffix string) ([]string, error) {
+	if err := c.checkState(cmd, StateTransaction); err != nil {
+		return nil, err
+	}
+	cmds := make([]string, len(nums))
+	for i, num := range nums {
+		if num < 1 {
+			return nil, errMsgNum
+		}
+		cmds[i] = cmd + " " + strconv.Itoa(num) + suffix
+	}
+	return cmds, nil
+}
+
+// ensureCapa fetches the capabilities in TRANSACTION state if
+// they are not cached, so the batch commands know whether the
+// server supports pipelining. If the server rejects CAPA, the
+// empty capabilities are cached and the batch is sequential.
+func (c *Client) ensureCapa(ctx context.Context) error {
+	c.mu.Lock()
+	known := c.caps != nil || c.state != StateTransaction
+	c.mu.Unlock()
+	if known {
+		return nil
+	}
+
+	_, err := c.CapaContext(ctx)
+	var se *ServerError
+	if errors.As(err, &se) {
+		c.mu.Lock()
+		if c.caps == nil {
+			c.caps = &Capabilities{}
+		}
+		c.mu.Unlock()
+		return nil
+	}
+	return err
+}
+
+// pipelineWindow returns the number of the commands which can
+// be sent before reading their responses.
+func (c *Client) pipelineWindow() int {
+	if c.caps == nil || !c.caps.Pipelining {
+		return 1
+	}
+	if c.PipelineWindow > 0 {
+		return c.PipelineWindow
+	}
+	return DefaultPipelineWindow
+}
+
+// pipeline sends the commands in a window and calls read for
+// each response in order. The negative responses are
+// collected in *BatchError and the batch goes on. If read
+// returns handlerError, no more commands are sent and the
+// responses on the way are skipped. Other errors end the batch
+// immediately, because the connection is broken. Every command
+// is logged and observed by itself.
+//
+// cmds []string - command lines.
+// multi bool - whether the responses are multi-line.
+// read func(int) error - reads the response of cmds[i].
+func (c *Client) pipeline(cmds []string, multi bool, read func(i int) error) error {
+	window := c.pipelineWindow()
+	errs := make([]error, len(cmds))
+	sentAt := make([]time.Time, len(cmds))
+	failed := false
+	var stop error
+	sent := 0
+	for i := range cmds {
+		if stop == nil && sent < len(cmds) && sent < i+window {
+			last := i + window
+			if last > len(cmds) {
+				last = len(cmds)
+			}
+			now := time.Now()
+			for j := sent; j < last; j++ {
+				sentAt[j] = now
+			}
+			c.nextCmd(cmds[sent], now)
+			if err := c.writeLines(cmds[sent:last]); err != nil {
+				return err
+			}
+			sent = last
+		}
+		if i >= sent {
+			break
+		}
+		c.nextCmd(cmds[i], sentAt[i])
+
+		if stop != nil {
+			err := c.skipResp(multi)
+			var se *ServerError
+			if err != nil && !errors.As(err, &se) {
+				return err
+			}
+			c.endCmd(err)
+			continue
+		}
+
+		err := read(i)
+		var se *ServerError
+		var he handlerError
+		switch {
+		case err == nil:
+			c.endCmd(nil)
+		case errors.As(err, &he):
+			c.endCmd(nil)
+			stop = he.err
+		case errors.As(err, &se):
+			c.endCmd(err)
+			errs[i] = err
+			failed = true
+		default:
+			return err
+		}
+	}
+	if stop != nil {
+		return stop
+	}
+	if failed {
+		return &BatchError{Errs: errs}
+	}
+	return nil
+}
+
+// skipResp reads the response of the command which is sent
+// before the batch stopped. The body of a multi-line response
+// is discarded while it is read, so it is not kept in memory.
+// It returns the negative response as *ServerError.
+//
+// multi bool - whether the response is multi-line.
+func (c *Client) skipResp(multi bool) error {
+	status, err := c.readResp()
+	if err != nil {
+		return err
+	}
+	if multi && strings.HasPrefix(status, ok) {
+		_, err = io.Copy(io.Discard, &dotReader{c: c, batch: true})
+		if err != nil {
+			return err
+		}
+	}
+	return respErr(c.cmd, status)
+}
+
+// writeLines traces the command lines and sends them with a
+// single write.
+//
+// lines []string - command lines without the line endings.
+func (c *Client) writeLines(lines []string) error {
+	var sb strings.Builder
+	for _, l := range lines {
+		c.trace(DirClient, l, false)
+		sb.WriteString(l + "\r\n")
+	}
+	_, err := c.conn().Write([]byte(sb.String()))
+	return err
+}
@@ -0,0 +1,348 @@
+package pop3_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+// writeCounter counts the writes to the connections which it
+// dials.
+type writeCounter struct {
+	writes int
+}
+
+func (w *writeCounter) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, w: w}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	w *writeCounter
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.w.writes++
+	return c.Conn.Write(p)
+}
+
+// batchMessages are the messages of the pipelining tests.
+var batchMessages = []pop3test.Message{
+	{UID: "a", Data: "Subject: one\r\n\r\nfirst\r\n"},
+	{UID: "b", Data: "Subject: two\r\n\r\nsecond\r\n.dot\r\n"},
+	{UID: "c", Data: "Subject: three\r\n\r\nthird\r\n"},
+}
+
+func TestClient_DeleMany(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	wc := &writeCounter{}
+	pop := srv.Login(t, &pop3.Dialer{NetDialer: wc}, testUser, testPassword)
+	if _, err := pop.Capa(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	writes := wc.writes
+	if err := pop.DeleMany([]int{1, 2, 3}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := wc.writes - writes; n != 1 {
+		t.Errorf("commands must be sent in one write, got: %d writes", n)
+	}
+	if _, err := pop.Quit(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if msgs := srv.Messages(testUser); len(msgs) != 0 {
+		t.Errorf("messages must be deleted: %+v", msgs)
+	}
+}
+
+func TestClient_DeleManyWindow(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	wc := &writeCounter{}
+	pop := srv.Login(t, &pop3.Dialer{NetDialer: wc}, testUser, testPassword)
+	pop.PipelineWindow = 2
+	pop.Capa()
+	writes := wc.writes
+	if err := pop.DeleMany([]int{1, 2, 3}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := wc.writes - writes; n != 2 {
+		t.Errorf("expected 2 writes with window 2, got: %d", n)
+	}
+}
+
+func TestClient_DeleManyRejected(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	pop := srv.Login(t, nil, testUser, testPassword)
+	srv.Fail("DELE", pop3test.Failure{Resp: "-ERR [SYS/TEMP] try again later"})
+	err := pop.DeleMany([]int{1, 2, 3})
+	var be *pop3.BatchError
+	if !errors.As(err, &be) {
+		t.Fatalf("expected BatchError, got: %v", err)
+	}
+	if be.Errs[0] == nil || be.Errs[1] != nil || be.Errs[2] != nil {
+		t.Errorf("unexpected errors: %v", be.Errs)
+	}
+	if !errors.Is(err, pop3.ErrSysTemp) {
+		t.Errorf("expected ErrSysTemp in: %v", err)
+	}
+	pop.Quit()
+	if msgs := srv.Messages(testUser); len(msgs) != 1 || msgs[0].UID != "a" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+}
+
+func TestClient_DeleManySequential(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.Capabilities = []string{"TOP", "UIDL"}
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	wc := &writeCounter{}
+	pop := srv.Login(t, &pop3.Dialer{NetDialer: wc}, testUser, testPassword)
+	writes := wc.writes
+	if err := pop.DeleMany([]int{1, 2, 3}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// CAPA and a write for each command.
+	if n := wc.writes - writes; n != 4 {
+		t.Errorf("expected 4 writes without PIPELINING, got: %d", n)
+	}
+	if cmds := srv.Commands(); cmds[2] != "CAPA" {
+		t.Errorf("capabilities must be fetched: %v", cmds)
+	}
+}
+
+func TestClient_DeleManyCapaRejected(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	wc := &writeCounter{}
+	pop := srv.Login(t, &pop3.Dialer{NetDialer: wc}, testUser, testPassword)
+	srv.Fail("CAPA", pop3test.Failure{Resp: "-ERR unknown command"})
+	writes := wc.writes
+	if err := pop.DeleMany([]int{1, 2}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := pop.DeleMany([]int{3}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := wc.writes - writes; n != 4 {
+		t.Errorf("expected one CAPA and sequential commands, got: %d writes", n)
+	}
+}
+
+func TestClient_DeleManyCapaAfterLogin(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		steps []pop3test.Step
+		login func(*pop3.Client) (string, error)
+	}{
+		{
+			name: "PASS",
+			steps: []pop3test.Step{
+				{Expect: "USER user", Send: "+OK"},
+				{Expect: "PASS secret", Send: "+OK"},
+			},
+			login: func(pop *pop3.Client) (string, error) {
+				pop.User("user")
+				return pop.Pass("secret")
+			},
+		},
+		{
+			name: "APOP",
+			steps: []pop3test.Step{
+				{Expect: "APOP user 7e61eefc7300478173ae7f4bd3ef8eb4", Send: "+OK"},
+			},
+			login: func(pop *pop3.Client) (string, error) {
+				pop.SetGreeting("+OK POP3 server ready <1.2@pop3test>")
+				return pop.Apop("user", "secret")
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			steps := []pop3test.Step{{Expect: "CAPA", Send: "+OK\r\nUSER\r\n."}}
+			steps = append(steps, tt.steps...)
+			steps = append(steps,
+				pop3test.Step{Expect: "CAPA", Send: "+OK\r\nPIPELINING\r\n."},
+				pop3test.Step{Expect: "DELE 1", Send: "+OK"},
+			)
+			pop := pop3test.ScriptClient(t, steps...)
+			if _, err := pop.Capa(); err != nil {
+				t.Fatalf(err.Error())
+			}
+			if _, err := tt.login(pop); err != nil {
+				t.Fatalf(err.Error())
+			}
+			if err := pop.DeleMany([]int{1}); err != nil {
+				t.Fatalf(err.Error())
+			}
+			if !pop.HasCapa("PIPELINING") {
+				t.Errorf("capabilities must be fetched again after the login")
+			}
+		})
+	}
+}
+
+func TestClient_DeleManyInvalid(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	pop := srv.Login(t, nil, testUser, testPassword)
+	if err := pop.DeleMany([]int{1, 0}); !errors.Is(err, pop3.ErrMsgNum) {
+		t.Errorf("expected error for message number 0, got: %v", err)
+	}
+	if _, err := pop.TopMany([]int{1}, -1); !errors.Is(err, pop3.ErrLineCount) {
+		t.Errorf("expected error for negative line count, got: %v", err)
+	}
+	if err := pop.DeleMany(nil); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestClient_TopMany(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	pop := srv.Login(t, nil, testUser, testPassword)
+	res, err := pop.TopMany([]int{3, 9, 1}, 0)
+	var be *pop3.BatchError
+	if !errors.As(err, &be) || be.Errs[1] == nil {
+		t.Fatalf("expected error for message 9, got: %v", err)
+	}
+	if len(res) != 3 || res[1] != nil {
+		t.Fatalf("unexpected results: %q", res)
+	}
+	if res[0][1] != "Subject: three" || res[2][1] != "Subject: one" {
+		t.Errorf("results must be in order: %q", res)
+	}
+	if _, err = pop.Noop(); err != nil {
+		t.Errorf("session must be in sync: %v", err)
+	}
+}
+
+func TestClient_RetrMany(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	pop := srv.Login(t, nil, testUser, testPassword)
+	var got []string
+	err := pop.RetrMany([]int{1, 2, 3}, func(num int, r io.Reader) error {
+		if num == 1 {
+			// The rest of the body is skipped.
+			buf := make([]byte, 4)
+			io.ReadFull(r, buf)
+			got = append(got, string(buf))
+			return nil
+		}
+		b, err := io.ReadAll(r)
+		got = append(got, string(b))
+		return err
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := []string{"Subj", "Subject: two\r\n\r\nsecond\r\n.dot\r\n", "Subject: three\r\n\r\nthird\r\n"}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected: %q, got: %q", expected, got)
+	}
+}
+
+func TestClient_RetrManyHandlerError(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	pop := srv.Login(t, nil, testUser, testPassword)
+	pop.PipelineWindow = 2
+	stop := errors.New("disk full")
+	calls := 0
+	err := pop.RetrMany([]int{1, 2, 3}, func(num int, r io.Reader) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected handler error, got: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got: %d", calls)
+	}
+	if _, err = pop.Noop(); err != nil {
+		t.Errorf("session must be in sync: %v", err)
+	}
+	for _, cmd := range srv.Commands() {
+		if cmd == "RETR 3" {
+			t.Errorf("commands must not be sent after the handler error")
+		}
+	}
+}
+
+func TestClient_RetrManySkipped(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "RETR 1", Send: "+OK\r\nfirst\r\n."},
+		pop3test.Step{Expect: "RETR 2", Send: "+OK\r\n..\r\nsecond\r\n."},
+		pop3test.Step{Expect: "RETR 3", Send: "-ERR no such message"},
+		pop3test.Step{Expect: "NOOP", Send: "+OK"},
+	)
+	pop.SetState(pop3.StateTransaction)
+	pop.SetCaps(&pop3.Capabilities{Pipelining: true})
+
+	stop := errors.New("disk full")
+	err := pop.RetrMany([]int{1, 2, 3}, func(num int, r io.Reader) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected handler error, got: %v", err)
+	}
+	if _, err = pop.Noop(); err != nil {
+		t.Errorf("session must be in sync: %v", err)
+	}
+}
+
+func TestClient_DeleManyObserver(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	pop := srv.Login(t, nil, testUser, testPassword)
+	pop.Capa()
+	srv.Fail("DELE", pop3test.Failure{Resp: "-ERR [SYS/TEMP] try again later"})
+	var events []pop3.CommandEvent
+	pop.Observer = pop3.ObserverFunc(func(ev pop3.CommandEvent) {
+		events = append(events, ev)
+	})
+	pop.DeleMany([]int{1, 2, 3})
+
+	outcomes := []pop3.Outcome{pop3.OutcomeServerError, pop3.OutcomeOK, pop3.OutcomeOK}
+	if len(events) != len(outcomes) {
+		t.Fatalf("expected an event for each command, got: %+v", events)
+	}
+	for i, ev := range events {
+		if ev.Cmd != "DELE" || ev.Outcome != outcomes[i] || ev.BytesWritten != 8 || ev.BytesRead == 0 {
+			t.Errorf("event %d: unexpected event: %+v", i, ev)
+		}
+	}
+	if events[0].Code != "SYS/TEMP" || events[1].Code != "" {
+		t.Errorf("unexpected codes: %+v", events)
+	}
+}
+
+func TestClient_RetrManyObserverStopped(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.AddMailbox(testUser, testPassword, batchMessages...)
+	pop := srv.Login(t, nil, testUser, testPassword)
+	pop.Capa()
+	var events []pop3.CommandEvent
+	pop.Observer = pop3.ObserverFunc(func(ev pop3.CommandEvent) {
+		events = append(events, ev)
+	})
+	pop.RetrMany([]int{1, 2}, func(num int, r io.Reader) error {
+		return errors.New("stop")
+	})
+	// The response of RETR 2 is skipped, but it is observed.
+	if len(events) != 2 || events[0].Outcome != pop3.OutcomeOK || events[1].Outcome != pop3.OutcomeOK || events[1].BytesRead == 0 {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
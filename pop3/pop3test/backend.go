@@ -0,0 +1,148 @@
+package pop3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/server"
+)
+
+// mailbox keeps the password and the messages of a user.
+type mailbox struct {
+	password string
+	messages []Message
+}
+
+// backend authenticates the users of the server's mailboxes.
+// It implements server.APOPBackend.
+type backend struct {
+	s *Server
+}
+
+// Login checks the password of the user.
+func (b backend) Login(username, password string) (server.Mailbox, error) {
+	b.s.mu.Lock()
+	mb, found := b.s.mailboxes[username]
+	valid := found && mb.password == password
+	b.s.mu.Unlock()
+	if !valid {
+		return nil, server.ErrAuthFailed
+	}
+	return b.s.open(username), nil
+}
+
+// LoginAPOP checks the digest of the user.
+func (b backend) LoginAPOP(username, timestamp, digest string) (server.Mailbox, error) {
+	b.s.mu.Lock()
+	mb, found := b.s.mailboxes[username]
+	var expected string
+	if found {
+		sum := md5.Sum([]byte(timestamp + mb.password))
+		expected = hex.EncodeToString(sum[:])
+	}
+	b.s.mu.Unlock()
+	if !found || digest != expected {
+		return nil, server.ErrAuthFailed
+	}
+	return b.s.open(username), nil
+}
+
+// open returns the session's view of the user's mailbox, or
+// <nil> if the user has no mailbox.
+func (s *Server) open(user string) *maildrop {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb, found := s.mailboxes[user]
+	if !found {
+		return nil
+	}
+	return &maildrop{
+		s:    s,
+		user: user,
+		msgs: append([]Message(nil), mb.messages...),
+	}
+}
+
+// maildrop is the mailbox of a user during a session. It
+// keeps the messages at the login, so the numbers do not
+// change.
+type maildrop struct {
+	s    *Server
+	user string
+	msgs []Message
+}
+
+// List returns the sizes of the messages with CRLF line
+// endings.
+func (m *maildrop) List() ([]pop3.MessageInfo, error) {
+	infos := make([]pop3.MessageInfo, len(m.msgs))
+	for i, msg := range m.msgs {
+		infos[i] = pop3.MessageInfo{Num: i + 1, Size: size(msg.Data)}
+	}
+	return infos, nil
+}
+
+// Uidl returns the unique-ids of the messages. The empty ones
+// are generated from the message number.
+func (m *maildrop) Uidl() ([]pop3.UniqueID, error) {
+	ids := make([]pop3.UniqueID, len(m.msgs))
+	for i, msg := range m.msgs {
+		uid := msg.UID
+		if uid == "" {
+			uid = "uid-" + strconv.Itoa(i+1)
+		}
+		ids[i] = pop3.UniqueID{Num: i + 1, UID: uid}
+	}
+	return ids, nil
+}
+
+// Retr returns the data of the message.
+func (m *maildrop) Retr(num int) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(m.msgs[num-1].Data)), nil
+}
+
+// Delete removes the messages from the server's mailbox.
+func (m *maildrop) Delete(nums []int) error {
+	deleted := make(map[int]bool, len(nums))
+	for _, num := range nums {
+		deleted[num] = true
+	}
+	var kept []Message
+	for i, msg := range m.msgs {
+		if !deleted[i+1] {
+			kept = append(kept, msg)
+		}
+	}
+
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	if mb, found := m.s.mailboxes[m.user]; found {
+		mb.messages = kept
+	}
+	return nil
+}
+
+// Close does nothing; the server unlocks the maildrop.
+func (m *maildrop) Close() error {
+	return nil
+}
+
+// size returns the size of the message in octets with CRLF
+// line endings. A missing line ending at the end is counted
+// because the server adds it.
+func size(data string) int {
+	if data == "" {
+		return 0
+	}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.TrimSuffix(data, "\n")
+	n := 0
+	for _, l := range strings.Split(data, "\n") {
+		n += len(l) + 2
+	}
+	return n
+}
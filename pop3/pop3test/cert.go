@@ -0,0 +1,72 @@
+package pop3test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	certOnce sync.Once
+	cert     tls.Certificate
+	certPool *x509.CertPool
+)
+
+// loopbackCert returns the self-signed certificate for the
+// loopback addresses and "localhost". It is generated once.
+func loopbackCert() (tls.Certificate, *x509.CertPool) {
+	certOnce.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic("pop3test: failed to generate key: " + err.Error())
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{Organization: []string{"pop3test"}},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(24 * 365 * time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			DNSNames:              []string{"localhost"},
+			IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			panic("pop3test: failed to create certificate: " + err.Error())
+		}
+		leaf, err := x509.ParseCertificate(der)
+		if err != nil {
+			panic("pop3test: failed to parse certificate: " + err.Error())
+		}
+		cert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+		certPool = x509.NewCertPool()
+		certPool.AddCert(leaf)
+	})
+	return cert, certPool
+}
+
+// tlsConfig returns the TLS configuration of the server.
+func (s *Server) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		return s.TLSConfig
+	}
+	c, _ := loopbackCert()
+	return &tls.Config{Certificates: []tls.Certificate{c}}
+}
+
+// ClientTLSConfig returns the TLS configuration which trusts
+// the self-signed certificate of the server. It is meaningful
+// only if Server.TLSConfig is <nil>.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	_, pool := loopbackCert()
+	return &tls.Config{RootCAs: pool}
+}
@@ -0,0 +1,147 @@
+package pop3test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+)
+
+const (
+	// AnyLine matches every line in Step.Expect.
+	AnyLine = "<any>"
+
+	// NoLine in Step.Expect sends the response without reading
+	// a line, e.g. for a greeting.
+	NoLine = "<none>"
+)
+
+// Step is a step of a scripted conversation.
+type Step struct {
+	// Expect is the line which the client is expected to send,
+	// without CRLF. AnyLine matches every line and NoLine does
+	// not wait for a line.
+	Expect string
+
+	// Send is the response which is written back with CRLF.
+	// Multi-line responses are separated with CRLF.
+	Send string
+
+	// Raw writes Send as it is, without CRLF. It is used for
+	// partial lines.
+	Raw bool
+}
+
+// Script serves the scripted conversation on net.Pipe and
+// returns the client end. It does not send a greeting; it can
+// be the first step's response if needed. The returned channel
+// receives the first mismatch, or <nil> when the script ends.
+// The connection is closed at the end of the script.
+//
+// Example:
+// 		conn, done := pop3test.Script(
+// 			pop3test.Step{Expect: "AUTH PLAIN", Send: "+ "},
+// 			pop3test.Step{Expect: "AHVzZXIAc2VjcmV0", Send: "+OK"},
+// 		)
+func Script(steps ...Step) (net.Conn, <-chan error) {
+	srv, cli := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		defer srv.Close()
+		r := bufio.NewReader(srv)
+		for _, step := range steps {
+			if step.Expect != NoLine {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					done <- fmt.Errorf("expected command: %q, got: %v", step.Expect, err)
+					return
+				}
+				got := strings.TrimRight(line, "\r\n")
+				if step.Expect != AnyLine && got != step.Expect {
+					done <- fmt.Errorf("expected command: %q, got: %q", step.Expect, got)
+					return
+				}
+			}
+			resp := step.Send
+			if !step.Raw {
+				resp += "\r\n"
+			}
+			if _, err := srv.Write([]byte(resp)); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	return scriptConn{cli}, done
+}
+
+// scriptConn is the client end of the script. Unlike TCP
+// connections, net.Pipe fails to set deadlines once the other
+// end is closed. The errors are ignored, so the reads return
+// io.EOF at the end of the script.
+type scriptConn struct {
+	net.Conn
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c scriptConn) SetDeadline(t time.Time) error {
+	c.Conn.SetDeadline(t)
+	return nil
+}
+
+// SetReadDeadline sets the read deadline.
+func (c scriptConn) SetReadDeadline(t time.Time) error {
+	c.Conn.SetReadDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline.
+func (c scriptConn) SetWriteDeadline(t time.Time) error {
+	c.Conn.SetWriteDeadline(t)
+	return nil
+}
+
+// ScriptClient serves the scripted conversation like Script
+// and returns a Client which is dialed on it. DefaultBanner is
+// sent before the steps, so the Client is in AUTHORIZATION
+// state. The test fails if the conversation does not follow
+// the script; it is checked when the test ends.
+//
+// Example:
+// 		pop := pop3test.ScriptClient(t,
+// 			pop3test.Step{Expect: "USER mrose", Send: "+OK"},
+// 			pop3test.Step{Expect: "PASS secret", Send: "+OK"},
+// 		)
+func ScriptClient(t testing.TB, steps ...Step) *pop3.Client {
+	t.Helper()
+	greeting := Step{Expect: NoLine, Send: DefaultBanner}
+	conn, done := Script(append([]Step{greeting}, steps...)...)
+	d := &pop3.Dialer{NetDialer: connDialer{conn}}
+	pop, err := d.Dial("pop3test:110")
+	if err != nil {
+		t.Fatalf("pop3test: dial: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		if err := <-done; err != nil {
+			t.Errorf("pop3test: %v", err)
+		}
+	})
+	return pop
+}
+
+// connDialer returns the connection which is already open.
+type connDialer struct {
+	conn net.Conn
+}
+
+// DialContext returns the connection of the dialer.
+func (d connDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.conn, nil
+}
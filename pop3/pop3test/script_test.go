@@ -0,0 +1,72 @@
+package pop3test
+
+import (
+	"bufio"
+	"io"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	conn, done := Script(
+		Step{Expect: "CAPA", Send: "+OK\r\nUSER\r\n."},
+		Step{Expect: AnyLine, Send: "+OK"},
+	)
+	r := bufio.NewReader(conn)
+	conn.Write([]byte("CAPA\r\n"))
+	for _, exp := range []string{"+OK\r\n", "USER\r\n", ".\r\n"} {
+		if l, _ := r.ReadString('\n'); l != exp {
+			t.Errorf("expected: %q, got: %q", exp, l)
+		}
+	}
+	conn.Write([]byte("NOOP\r\n"))
+	if l, _ := r.ReadString('\n'); l != "+OK\r\n" {
+		t.Errorf("expected: %q, got: %q", "+OK\r\n", l)
+	}
+	if err := <-done; err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestScriptMismatch(t *testing.T) {
+	conn, done := Script(Step{Expect: "STAT", Send: "+OK 0 0"})
+	conn.Write([]byte("NOOP\r\n"))
+	if err := <-done; err == nil {
+		t.Errorf("expected mismatch error")
+	}
+}
+
+func TestScriptNoLineRaw(t *testing.T) {
+	conn, done := Script(
+		Step{Expect: NoLine, Send: "+OK ready"},
+		Step{Expect: NoLine, Send: "+OK 2", Raw: true},
+	)
+	b, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if string(b) != "+OK ready\r\n+OK 2" {
+		t.Errorf("expected: %q, got: %q", "+OK ready\r\n+OK 2", b)
+	}
+	if err = <-done; err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestScriptClient(t *testing.T) {
+	pop := ScriptClient(t,
+		Step{Expect: "USER mrose", Send: "+OK"},
+		Step{Expect: "PASS secret", Send: "+OK maildrop ready"},
+	)
+	if pop.GreetingMsg() != DefaultBanner {
+		t.Errorf("expected: %s, got: %s", DefaultBanner, pop.GreetingMsg())
+	}
+	if _, err := pop.User("mrose"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := pop.Pass("secret"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !pop.IsAuthorized() {
+		t.Errorf("expected TRANSACTION state, got: %v", pop.State())
+	}
+}
@@ -0,0 +1,421 @@
+// Package pop3test provides an in-process POP3 server for
+// testing POP3 clients without network access. It is the
+// pop3/server package with in-memory mailboxes, a canned
+// greeting and failures which can be injected into the next
+// commands. It serves on a loopback listener, optionally with
+// implicit TLS or STLS, or on net.Pipe.
+//
+// Example:
+// 		srv := pop3test.NewServer()
+// 		defer srv.Close()
+// 		srv.AddMailbox("user", "secret", pop3test.Message{Data: "Subject: hi\r\n\r\nhello\r\n"})
+// 		srv.Fail("RETR", pop3test.Failure{Resp: "-ERR [SYS/TEMP] try again"})
+//
+// 		pop, err := pop3.Connect(srv.Addr, nil, false)
+package pop3test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/server"
+)
+
+// DefaultBanner is the greeting message of the server. The
+// APOP timestamp of the session is appended to it.
+const DefaultBanner = "+OK POP3 server ready"
+
+// Message is a message in a mailbox.
+type Message struct {
+	// UID is the unique-id of the message which is returned
+	// by UIDL command. If it is empty, the server generates
+	// one from the message number.
+	UID string
+
+	// Data is the message with headers and body. LF line
+	// endings are sent as CRLF.
+	Data string
+}
+
+// Failure is a failure which is injected into a command.
+// The fields are applied in order: the server waits Delay,
+// closes the connection if Close is true, otherwise sends
+// Resp instead of the normal response, and stops responding
+// if Hang is true.
+type Failure struct {
+	// Resp is the response line, e.g. "-ERR [SYS/TEMP] disk
+	// failure". The command is not executed.
+	Resp string
+
+	// Close closes the connection without responding.
+	Close bool
+
+	// Delay is the time to wait before failing. If Resp is
+	// empty and Close and Hang are false, the command is
+	// executed normally after the delay.
+	Delay time.Duration
+
+	// Hang stops responding: the server reads and discards
+	// the lines of the client until the connection is closed.
+	// With Resp, a partial response can be sent first, e.g.
+	// "+OK\r\nfirst line".
+	Hang bool
+}
+
+// errClosed ends the session of Failure.Close.
+var errClosed = errors.New("pop3test: connection closed by failure")
+
+// HandlerFunc handles a command instead of the server. args
+// is the rest of the command line after the command name. It
+// reads and writes the lines with the Session.
+type HandlerFunc func(s *Session, args string) error
+
+// Server is a fake POP3 server. The fields must be set before
+// the clients connect. The methods are safe for concurrent use.
+type Server struct {
+	// Addr is the address of the listener, e.g.
+	// "127.0.0.1:43210". It is empty for unstarted servers.
+	Addr string
+
+	// Banner is the greeting line which starts with "+OK". If
+	// it is empty, DefaultBanner is sent. The APOP timestamp,
+	// which is unique to every session, is appended to it.
+	Banner string
+
+	// Capabilities is the response of CAPA command. If it is
+	// <nil>, the capabilities of the supported commands are
+	// sent.
+	Capabilities []string
+
+	// STLS enables STLS command on the plaintext connections.
+	STLS bool
+
+	// Backend serves the mailboxes instead of the ones which
+	// are added with AddMailbox, e.g. a maildir.Backend. The
+	// failures, handlers and capabilities still apply.
+	Backend server.Backend
+
+	// TLSConfig is used for implicit TLS and STLS. If it is
+	// <nil>, a self-signed certificate for the loopback
+	// addresses is used. See ClientTLSConfig.
+	TLSConfig *tls.Config
+
+	mu        sync.Mutex
+	srv       *server.Server
+	listener  net.Listener
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+	mailboxes map[string]*mailbox
+	failures  map[string][]Failure
+	handlers  map[string]HandlerFunc
+	commands  []string
+	closed    bool
+}
+
+// NewUnstartedServer returns a server which is not listening
+// yet. Start or StartTLS must be called after it is
+// configured. Pipe can be used without starting.
+func NewUnstartedServer() *Server {
+	return &Server{
+		conns:     make(map[net.Conn]struct{}),
+		mailboxes: make(map[string]*mailbox),
+		failures:  make(map[string][]Failure),
+		handlers:  make(map[string]HandlerFunc),
+	}
+}
+
+// NewServer starts and returns a plaintext server. The caller
+// should call Close when finished.
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewTLSServer starts and returns a server with implicit TLS.
+// Clients should use ClientTLSConfig. The caller should call
+// Close when finished.
+func NewTLSServer() *Server {
+	s := NewUnstartedServer()
+	s.StartTLS()
+	return s
+}
+
+// Start starts serving plaintext connections on a loopback
+// listener.
+func (s *Server) Start() {
+	s.serve(s.listen())
+}
+
+// StartTLS starts serving implicit TLS connections on a
+// loopback listener.
+func (s *Server) StartTLS() {
+	s.serve(tls.NewListener(s.listen(), s.tlsConfig()))
+}
+
+// listen creates the loopback listener.
+func (s *Server) listen() net.Listener {
+	if s.listener != nil {
+		panic("pop3test: server already started")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if l, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+			panic("pop3test: failed to listen: " + err.Error())
+		}
+	}
+	return l
+}
+
+// serve accepts the connections of the listener.
+func (s *Server) serve(l net.Listener) {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	s.Addr = l.Addr().String()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, isTLS := conn.(*tls.Conn)
+			s.handle(conn, isTLS)
+		}
+	}()
+}
+
+// Pipe serves a session on net.Pipe and returns the client
+// end. It works without starting the server.
+func (s *Server) Pipe() net.Conn {
+	srv, cli := net.Pipe()
+	s.handle(srv, false)
+	return cli
+}
+
+// DialContext returns Pipe. So the server can be used as the
+// dialer of the clients which accept a custom dialer.
+func (s *Server) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return s.Pipe(), nil
+}
+
+// Login connects to the server and logs in with USER and PASS
+// commands. It stops the test if any step fails. The unstarted
+// servers are dialed with Pipe, and the clients of TLS servers
+// trust ClientTLSConfig unless d has a TLS configuration. The
+// caller should call Quit when finished.
+//
+// Example:
+// 		pop := srv.Login(t, nil, "user", "secret")
+// 		defer pop.Quit()
+//
+// t testing.TB - test which is stopped on failure.
+// d *pop3.Dialer - dialer of the client. It can be <nil>.
+// user string - username of the mailbox.
+// password string - password of the mailbox.
+func (s *Server) Login(t testing.TB, d *pop3.Dialer, user, password string) *pop3.Client {
+	t.Helper()
+	var dialer pop3.Dialer
+	if d != nil {
+		dialer = *d
+	}
+	addr := s.Addr
+	if addr == "" {
+		addr = "pop3test:110"
+		if dialer.NetDialer == nil {
+			dialer.NetDialer = s
+		}
+	}
+	if dialer.Mode != pop3.ModePlain && dialer.TLSConfig == nil {
+		dialer.TLSConfig = s.ClientTLSConfig()
+	}
+
+	pop, err := dialer.Dial(addr)
+	if err != nil {
+		t.Fatalf("pop3test: dial: %v", err)
+	}
+	if _, err = pop.User(user); err != nil {
+		t.Fatalf("pop3test: USER: %v", err)
+	}
+	if _, err = pop.Pass(password); err != nil {
+		t.Fatalf("pop3test: PASS: %v", err)
+	}
+	return pop
+}
+
+// handle starts the session on the connection. The session
+// relays the commands to a pop3/server session on net.Pipe.
+func (s *Server) handle(conn net.Conn, encrypted bool) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	srv, cli := net.Pipe()
+	go s.server().ServeConn(srv)
+	go func() {
+		defer s.wg.Done()
+		newSession(s, conn, cli, encrypted).serve()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+}
+
+// server returns the POP3 server of the sessions. It is
+// created at the first use, so the fields can be set on
+// unstarted servers.
+func (s *Server) server() *server.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.srv != nil {
+		return s.srv
+	}
+	var b server.Backend = backend{s}
+	if s.Backend != nil {
+		b = s.Backend
+	}
+	s.srv = &server.Server{
+		Backend:           b,
+		AllowInsecureAuth: true,
+		Implementation:    "pop3test",
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	return s.srv
+}
+
+// Close stops the listener, closes the open connections and
+// waits for the sessions to end.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	s.server().Close()
+}
+
+// AddMailbox adds a mailbox with the given credentials and
+// messages. It replaces the existing mailbox of the user.
+//
+// user string - username for USER, APOP and AUTH commands.
+// password string - password. It is the shared secret of APOP.
+// messages ...Message - messages of the mailbox.
+func (s *Server) AddMailbox(user, password string, messages ...Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mailboxes[user] = &mailbox{
+		password: password,
+		messages: append([]Message(nil), messages...),
+	}
+}
+
+// Messages returns the messages of the user's mailbox. The
+// messages which are deleted in a session are removed when
+// the session quits.
+//
+// user string - username.
+func (s *Server) Messages(user string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb, found := s.mailboxes[user]
+	if !found {
+		return nil
+	}
+	return append([]Message(nil), mb.messages...)
+}
+
+// Fail injects the failure into the next command with the
+// given name. Failures of the same command are used in order,
+// once each.
+//
+// cmd string - command name, e.g. "RETR"
+// f Failure - failure of the command.
+func (s *Server) Fail(cmd string, f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd = strings.ToUpper(cmd)
+	s.failures[cmd] = append(s.failures[cmd], f)
+}
+
+// Handle replaces the server's handling of the command. It
+// can be used for the commands which the server does not
+// support or for scripted conversations, e.g. custom SASL
+// exchanges.
+//
+// cmd string - command name, e.g. "AUTH"
+// h HandlerFunc - handler of the command.
+func (s *Server) Handle(cmd string, h HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[strings.ToUpper(cmd)] = h
+}
+
+// Commands returns the command lines which the server has
+// received, in order.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// nextFailure removes and returns the next failure of the
+// command.
+func (s *Server) nextFailure(cmd string) (Failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs := s.failures[cmd]
+	if len(fs) == 0 {
+		return Failure{}, false
+	}
+	s.failures[cmd] = fs[1:]
+	return fs[0], true
+}
+
+// handler returns the handler of the command.
+func (s *Server) handler(cmd string) HandlerFunc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handlers[cmd]
+}
+
+// record appends the command line to the received commands.
+func (s *Server) record(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, line)
+}
+
+// banner returns the greeting message with the APOP timestamp
+// of the pop3/server session's greeting.
+func (s *Server) banner(greeting string) string {
+	banner := s.Banner
+	if banner == "" {
+		banner = DefaultBanner
+	}
+	if i := strings.LastIndexByte(greeting, '<'); i >= 0 {
+		banner += " " + greeting[i:]
+	}
+	return banner
+}
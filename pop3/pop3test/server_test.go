@@ -0,0 +1,336 @@
+package pop3test
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+)
+
+// client is a raw POP3 client of the tests.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newClient reads the greeting message on the connection.
+func newClient(t *testing.T, conn net.Conn) (*client, string) {
+	c := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+	return c, c.readLine()
+}
+
+func (c *client) readLine() string {
+	l, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf(err.Error())
+	}
+	return strings.TrimRight(l, "\r\n")
+}
+
+// cmd sends the command and returns the status line.
+func (c *client) cmd(line string) string {
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		c.t.Fatalf(err.Error())
+	}
+	return c.readLine()
+}
+
+// multi sends the command and returns the status line and
+// the lines of the multi-line response.
+func (c *client) multi(line string) (string, []string) {
+	status := c.cmd(line)
+	if !strings.HasPrefix(status, "+OK") {
+		return status, nil
+	}
+	var lines []string
+	for {
+		l := c.readLine()
+		if l == "." {
+			return status, lines
+		}
+		lines = append(lines, strings.TrimPrefix(l, "."))
+	}
+}
+
+func testServer(t *testing.T) *Server {
+	s := NewServer()
+	t.Cleanup(s.Close)
+	s.AddMailbox("user", "secret",
+		Message{UID: "a1", Data: "Subject: one\n\nfirst\n.dot\n"},
+		Message{Data: "Subject: two\r\n\r\nsecond\r\n"},
+	)
+	return s
+}
+
+func TestServer_Session(t *testing.T) {
+	s := testServer(t)
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, greeting := newClient(t, conn)
+	if !strings.HasPrefix(greeting, DefaultBanner+" <") {
+		t.Errorf("expected: %s <timestamp>, got: %s", DefaultBanner, greeting)
+	}
+
+	if resp := c.cmd("STAT"); !strings.HasPrefix(resp, "-ERR") {
+		t.Errorf("expected -ERR before login, got: %s", resp)
+	}
+	c.cmd("USER user")
+	if resp := c.cmd("PASS wrong"); resp != "-ERR [AUTH] invalid username or password" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	c.cmd("USER user")
+	if resp := c.cmd("PASS secret"); !strings.HasPrefix(resp, "+OK") {
+		t.Fatalf("unexpected response: %s", resp)
+	}
+
+	if resp := c.cmd("STAT"); resp != "+OK 2 53" {
+		t.Errorf("expected: +OK 2 53, got: %s", resp)
+	}
+	_, lines := c.multi("LIST")
+	if !reflect.DeepEqual(lines, []string{"1 29", "2 24"}) {
+		t.Errorf("unexpected LIST: %v", lines)
+	}
+	_, lines = c.multi("RETR 1")
+	if !reflect.DeepEqual(lines, []string{"Subject: one", "", "first", ".dot"}) {
+		t.Errorf("unexpected RETR: %v", lines)
+	}
+	_, lines = c.multi("TOP 2 0")
+	if !reflect.DeepEqual(lines, []string{"Subject: two", ""}) {
+		t.Errorf("unexpected TOP: %v", lines)
+	}
+	_, lines = c.multi("UIDL")
+	if !reflect.DeepEqual(lines, []string{"1 a1", "2 uid-2"}) {
+		t.Errorf("unexpected UIDL: %v", lines)
+	}
+
+	c.cmd("DELE 1")
+	if resp := c.cmd("RETR 1"); resp != "-ERR message 1 already deleted" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	c.cmd("RSET")
+	c.cmd("DELE 2")
+	c.cmd("QUIT")
+
+	msgs := s.Messages("user")
+	if len(msgs) != 1 || msgs[0].UID != "a1" {
+		t.Errorf("expected only the first message, got: %v", msgs)
+	}
+}
+
+func TestServer_MaildropLocked(t *testing.T) {
+	s := testServer(t)
+	c1, _ := newClient(t, s.Pipe())
+	c1.cmd("USER user")
+	c1.cmd("PASS secret")
+
+	c2, _ := newClient(t, s.Pipe())
+	c2.cmd("USER user")
+	if resp := c2.cmd("PASS secret"); resp != "-ERR [IN-USE] maildrop already locked" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+}
+
+func TestServer_Apop(t *testing.T) {
+	s := NewUnstartedServer()
+	defer s.Close()
+	s.Banner = "+OK dewey POP3 server"
+	s.AddMailbox("mrose", "tanstaaf")
+
+	c, greeting := newClient(t, s.Pipe())
+	_, other := newClient(t, s.Pipe())
+	if !strings.HasPrefix(greeting, s.Banner+" <") {
+		t.Fatalf("unexpected greeting: %s", greeting)
+	}
+	timestamp := greeting[strings.IndexByte(greeting, '<'):]
+	if strings.HasSuffix(other, timestamp) {
+		t.Errorf("timestamp must be unique to the session: %s", timestamp)
+	}
+
+	sum := md5.Sum([]byte(timestamp + "tanstaaf"))
+	if resp := c.cmd("APOP mrose " + hex.EncodeToString(sum[:])); !strings.HasPrefix(resp, "+OK") {
+		t.Errorf("unexpected response: %s", resp)
+	}
+}
+
+func TestServer_AuthPlain(t *testing.T) {
+	s := testServer(t)
+	c, _ := newClient(t, s.Pipe())
+	if resp := c.cmd("AUTH PLAIN"); resp != "+ " {
+		t.Fatalf("unexpected response: %q", resp)
+	}
+	// "\x00user\x00secret"
+	if resp := c.cmd("AHVzZXIAc2VjcmV0"); !strings.HasPrefix(resp, "+OK") {
+		t.Errorf("unexpected response: %s", resp)
+	}
+}
+
+func TestServer_Fail(t *testing.T) {
+	s := testServer(t)
+	s.Fail("noop", Failure{Resp: "-ERR [SYS/TEMP] try again"})
+	s.Fail("NOOP", Failure{Close: true, Delay: 10 * time.Millisecond})
+
+	c, _ := newClient(t, s.Pipe())
+	c.cmd("USER user")
+	c.cmd("PASS secret")
+	if resp := c.cmd("NOOP"); resp != "-ERR [SYS/TEMP] try again" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	c.conn.Write([]byte("NOOP\r\n"))
+	if _, err := c.r.ReadString('\n'); err == nil {
+		t.Errorf("expected closed connection")
+	}
+
+	c, _ = newClient(t, s.Pipe())
+	c.cmd("USER user")
+	if resp := c.cmd("PASS secret"); !strings.HasPrefix(resp, "+OK") {
+		t.Errorf("the mailbox must be unlocked, got: %s", resp)
+	}
+	if resp := c.cmd("NOOP"); resp != "+OK" {
+		t.Errorf("failures must be used once, got: %s", resp)
+	}
+}
+
+func TestServer_Handle(t *testing.T) {
+	s := testServer(t)
+	s.Handle("AUTH", func(ses *Session, args string) error {
+		if err := ses.WriteLine("+ "); err != nil {
+			return err
+		}
+		if _, err := ses.ReadLine(); err != nil {
+			return err
+		}
+		ses.Login("user")
+		return ses.WriteLine("+OK welcome")
+	})
+
+	c, _ := newClient(t, s.Pipe())
+	c.cmd("AUTH XOAUTH2")
+	if resp := c.cmd("dG9rZW4="); resp != "+OK welcome" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	if resp := c.cmd("STAT"); resp != "+OK 2 53" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	expected := []string{"AUTH XOAUTH2", "STAT"}
+	if !reflect.DeepEqual(s.Commands(), expected) {
+		t.Errorf("expected: %v, got: %v", expected, s.Commands())
+	}
+}
+
+func TestServer_TLS(t *testing.T) {
+	s := NewTLSServer()
+	defer s.Close()
+
+	conn, err := tls.Dial("tcp", s.Addr, s.ClientTLSConfig())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, greeting := newClient(t, conn)
+	if !strings.HasPrefix(greeting, DefaultBanner+" <") {
+		t.Errorf("expected: %s <timestamp>, got: %s", DefaultBanner, greeting)
+	}
+	_, caps := c.multi("CAPA")
+	for _, l := range caps {
+		if l == "STLS" {
+			t.Errorf("STLS must not be announced on TLS")
+		}
+	}
+}
+
+func TestServer_STLS(t *testing.T) {
+	s := NewUnstartedServer()
+	s.STLS = true
+	s.Start()
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c, _ := newClient(t, conn)
+	if resp := c.cmd("STLS"); !strings.HasPrefix(resp, "+OK") {
+		t.Fatalf("unexpected response: %s", resp)
+	}
+	host, _, _ := net.SplitHostPort(s.Addr)
+	conf := s.ClientTLSConfig()
+	conf.ServerName = host
+	tlsConn := tls.Client(conn, conf)
+	if err = tlsConn.Handshake(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c = &client{t: t, conn: tlsConn, r: bufio.NewReader(tlsConn)}
+	if resp := c.cmd("STLS"); !strings.HasPrefix(resp, "-ERR") {
+		t.Errorf("expected -ERR for second STLS, got: %s", resp)
+	}
+}
+
+func TestServer_Login(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		s    *Server
+		d    *pop3.Dialer
+	}{
+		{"plain", NewServer(), nil},
+		{"pipe", NewUnstartedServer(), nil},
+		{"tls", NewTLSServer(), &pop3.Dialer{Mode: pop3.ModeTLS}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.s.Close()
+			tt.s.AddMailbox("user", "secret", Message{Data: "Subject: hi\r\n\r\nhello\r\n"})
+			pop := tt.s.Login(t, tt.d, "user", "secret")
+			defer pop.Quit()
+			if pop.State() != pop3.StateTransaction {
+				t.Errorf("expected: %v, got: %v", pop3.StateTransaction, pop.State())
+			}
+		})
+	}
+}
+
+func TestServer_Backend(t *testing.T) {
+	other := NewUnstartedServer()
+	other.AddMailbox("user", "secret", Message{Data: "Subject: hi\r\n\r\nhello\r\n"})
+	s := NewUnstartedServer()
+	s.Backend = backend{other}
+	defer s.Close()
+	s.Fail("NOOP", Failure{Resp: "-ERR [SYS/TEMP] try again"})
+
+	pop := s.Login(t, nil, "user", "secret")
+	defer pop.Quit()
+	if st, err := pop.StatInfo(); err != nil || st.Count != 1 {
+		t.Errorf("expected the message of the backend, got: %+v (%v)", st, err)
+	}
+	if _, err := pop.Noop(); !errors.Is(err, pop3.ErrSysTemp) {
+		t.Errorf("expected: %v, got: %v", pop3.ErrSysTemp, err)
+	}
+}
+
+func TestServer_FailHang(t *testing.T) {
+	s := testServer(t)
+	s.Fail("RETR", Failure{Resp: "+OK\r\nfirst line", Hang: true})
+
+	c, _ := newClient(t, s.Pipe())
+	c.cmd("USER user")
+	c.cmd("PASS secret")
+	if resp := c.cmd("RETR 1"); resp != "+OK" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	if l := c.readLine(); l != "first line" {
+		t.Errorf("unexpected line: %s", l)
+	}
+	c.conn.Write([]byte("NOOP\r\n"))
+	c.conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if l, err := c.r.ReadString('\n'); err == nil {
+		t.Errorf("expected no response, got: %q", l)
+	}
+}
@@ -0,0 +1,293 @@
+package pop3test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Session is a client session of the server. It relays the
+// commands of the client to a pop3/server session and its
+// responses back, unless a failure, a handler or the
+// capabilities of the Server replace the response. It is
+// passed to HandlerFunc.
+type Session struct {
+	s         *Server
+	conn      net.Conn
+	r         *bufio.Reader
+	encrypted bool
+
+	// srv is the connection of the pop3/server session.
+	srv net.Conn
+	sr  *bufio.Reader
+
+	// transaction is true after the login.
+	transaction bool
+
+	// user is the username of USER command or the login.
+	user string
+}
+
+// errQuit ends the session after QUIT.
+var errQuit = errors.New("quit")
+
+// newSession creates the session on the client connection
+// and the connection of the pop3/server session.
+func newSession(s *Server, conn, srv net.Conn, encrypted bool) *Session {
+	return &Session{
+		s:         s,
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		encrypted: encrypted,
+		srv:       srv,
+		sr:        bufio.NewReader(srv),
+	}
+}
+
+// ReadLine reads a line from the client without CRLF.
+func (ses *Session) ReadLine() (string, error) {
+	l, err := ses.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(l, "\r\n"), nil
+}
+
+// WriteLine writes the line with CRLF to the client.
+func (ses *Session) WriteLine(line string) error {
+	_, err := ses.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// User returns the username of USER command or the login.
+func (ses *Session) User() string {
+	return ses.user
+}
+
+// Login logs the user in without a password check of the
+// client. It is used by the custom AUTH handlers. The server
+// session logs in with the password of the mailbox, so only
+// the mailboxes of AddMailbox can be used. It returns false if
+// the mailbox does not exist or another session holds it.
+//
+// user string - username.
+func (ses *Session) Login(user string) bool {
+	ses.s.mu.Lock()
+	mb, found := ses.s.mailboxes[user]
+	ses.s.mu.Unlock()
+	if !found {
+		return false
+	}
+	for _, line := range []string{"USER " + user, "PASS " + mb.password} {
+		resp, err := ses.exchange(line)
+		if err != nil || !strings.HasPrefix(resp, "+OK") {
+			return false
+		}
+	}
+	ses.user = user
+	ses.transaction = true
+	return true
+}
+
+// writeMulti writes the multi-line response. The lines are
+// dot-stuffed and the termination line is added.
+func (ses *Session) writeMulti(status string, lines []string) error {
+	var b strings.Builder
+	b.WriteString(status + "\r\n")
+	for _, l := range lines {
+		if strings.HasPrefix(l, ".") {
+			b.WriteString(".")
+		}
+		b.WriteString(l + "\r\n")
+	}
+	b.WriteString(".\r\n")
+	_, err := ses.conn.Write([]byte(b.String()))
+	return err
+}
+
+// serve sends the greeting and handles the commands until
+// QUIT or one of the connections is closed.
+func (ses *Session) serve() {
+	defer func() {
+		ses.srv.Close()
+		ses.conn.Close()
+	}()
+
+	greeting, err := ses.readResp()
+	if err != nil {
+		return
+	}
+	if err = ses.WriteLine(ses.s.banner(greeting)); err != nil {
+		return
+	}
+	for {
+		line, err := ses.ReadLine()
+		if err != nil {
+			return
+		}
+		ses.s.record(line)
+
+		cmd, args := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, args = line[:i], line[i+1:]
+		}
+		cmd = strings.ToUpper(cmd)
+
+		if err = ses.handle(cmd, args, line); err != nil {
+			return
+		}
+	}
+}
+
+// handle applies the injected failure, the handler or the
+// capabilities of the command. Otherwise the command is
+// relayed to the pop3/server session.
+func (ses *Session) handle(cmd, args, line string) error {
+	if f, found := ses.s.nextFailure(cmd); found {
+		time.Sleep(f.Delay)
+		if f.Close {
+			return errClosed
+		}
+		if f.Resp != "" {
+			if err := ses.WriteLine(f.Resp); err != nil || !f.Hang {
+				return err
+			}
+		}
+		if f.Hang {
+			for {
+				if _, err := ses.ReadLine(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if h := ses.s.handler(cmd); h != nil {
+		return h(ses, args)
+	}
+	switch {
+	case cmd == "CAPA" && ses.s.Capabilities != nil:
+		return ses.writeMulti("+OK Capability list follows", ses.s.Capabilities)
+	case cmd == "STLS" && ses.s.STLS && !ses.transaction:
+		return ses.stls()
+	}
+	return ses.relay(cmd, args, line)
+}
+
+// relay sends the command line to the pop3/server session and
+// copies the response to the client. The continuation lines of
+// SASL exchanges are relayed until the final response.
+func (ses *Session) relay(cmd, args, line string) error {
+	if cmd == "USER" {
+		ses.user = args
+	}
+	for {
+		resp, err := ses.exchange(line)
+		if err != nil {
+			return err
+		}
+		if err = ses.WriteLine(resp); err != nil {
+			return err
+		}
+		if resp == "+" || strings.HasPrefix(resp, "+ ") {
+			if line, err = ses.ReadLine(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if cmd == "QUIT" {
+			return errQuit
+		}
+		if !strings.HasPrefix(resp, "+OK") {
+			return nil
+		}
+		switch {
+		case cmd == "APOP":
+			ses.user, _, _ = strings.Cut(args, " ")
+			ses.transaction = true
+		case cmd == "PASS", cmd == "AUTH" && args != "":
+			ses.transaction = true
+		}
+		if multiLine(cmd, args) {
+			return ses.relayBody(cmd)
+		}
+		return nil
+	}
+}
+
+// relayBody copies the lines of the multi-line response until
+// the termination line. STLS is added to the capabilities if
+// the Server upgrades the connection.
+func (ses *Session) relayBody(cmd string) error {
+	for {
+		l, err := ses.sr.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		end := l == ".\r\n"
+		if end && cmd == "CAPA" && ses.s.STLS && !ses.encrypted && !ses.transaction {
+			l = "STLS\r\n" + l
+		}
+		if _, err = ses.conn.Write([]byte(l)); err != nil {
+			return err
+		}
+		if end {
+			return nil
+		}
+	}
+}
+
+// multiLine reports whether the positive response of the
+// command is multi-line.
+func multiLine(cmd, args string) bool {
+	switch cmd {
+	case "CAPA", "RETR", "TOP":
+		return true
+	case "LIST", "UIDL", "AUTH":
+		return args == ""
+	}
+	return false
+}
+
+// exchange sends the line to the pop3/server session and
+// reads the first line of the response.
+func (ses *Session) exchange(line string) (string, error) {
+	if _, err := ses.srv.Write([]byte(line + "\r\n")); err != nil {
+		return "", err
+	}
+	return ses.readResp()
+}
+
+// readResp reads a response line of the pop3/server session
+// without CRLF.
+func (ses *Session) readResp() (string, error) {
+	l, err := ses.sr.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(l, "\r\n"), nil
+}
+
+// stls upgrades the connection of the client to TLS. The
+// pop3/server session stays on the plaintext connection.
+func (ses *Session) stls() error {
+	if ses.encrypted {
+		return ses.WriteLine("-ERR command not permitted")
+	}
+	if err := ses.WriteLine("+OK begin TLS negotiation"); err != nil {
+		return err
+	}
+	conn := tls.Server(ses.conn, ses.s.tlsConfig())
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	ses.conn = conn
+	ses.r = bufio.NewReader(conn)
+	ses.encrypted = true
+	ses.user = ""
+	return nil
+}
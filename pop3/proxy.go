@@ -0,0 +1,316 @@
+package pop3
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// socks5Version is the protocol version of SOCKS5.
+	socks5Version = 0x05
+
+	// socks5NoAuth is the method of no authentication.
+	socks5NoAuth = 0x00
+
+	// socks5UserPass is the method of username/password
+	// authentication (RFC 1929).
+	socks5UserPass = 0x02
+
+	// socks5NoAcceptable is sent by the proxy when none of the
+	// offered methods is acceptable.
+	socks5NoAcceptable = 0xff
+
+	// socks5Connect is the CONNECT command.
+	socks5Connect = 0x01
+
+	// Address types of SOCKS5 requests and replies.
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+)
+
+// socks5Replies keeps the messages of the SOCKS5 reply codes.
+var socks5Replies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// proxyAddr returns the address of the proxy. The default
+// port is added if the URL has none.
+func proxyAddr(proxy *url.URL, defaultPort string) string {
+	port := proxy.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
+
+// proxyHandshake runs fn on the connection to the proxy. The
+// context deadline is set on the connection, and cancelling
+// the context aborts fn. The connection is closed on failure.
+func proxyHandshake(ctx context.Context, conn net.Conn, fn func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(aLongTimeAgo)
+		case <-stop:
+		}
+	}()
+	err := fn()
+	close(stop)
+	<-done
+
+	if cerr := ctxErr(ctx); cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+// dialSOCKS5 connects to addr through the SOCKS5 proxy
+// (RFC 1928). The host name is sent to the proxy, so it is
+// resolved by the proxy.
+//
+// ctx context.Context - context of connecting.
+// nd ContextDialer - dialer of the proxy connection.
+// proxy *url.URL - proxy URL. Default port: 1080
+// addr string - address of the POP3 server.
+func dialSOCKS5(ctx context.Context, nd ContextDialer, proxy *url.URL, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %q", portStr)
+	}
+
+	conn, err := nd.DialContext(ctx, "tcp", proxyAddr(proxy, "1080"))
+	if err != nil {
+		return nil, err
+	}
+	err = proxyHandshake(ctx, conn, func() error {
+		return socks5Handshake(conn, proxy.User, host, uint16(port))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// socks5Handshake negotiates the authentication method,
+// authenticates if the proxy requires and sends CONNECT
+// request.
+// Example:
+// 		C: 05 02 00 02
+// 		S: 05 02
+// 		C: 01 04 user 04 pass
+// 		S: 01 00
+// 		C: 05 01 00 03 0e pop.gmail.com 03 e3
+// 		S: 05 00 00 01 0a 00 00 01 c3 50
+func socks5Handshake(rw io.ReadWriter, user *url.Userinfo, host string, port uint16) error {
+	methods := []byte{socks5NoAuth}
+	if user != nil {
+		methods = append(methods, socks5UserPass)
+	}
+	_, err := rw.Write(append([]byte{socks5Version, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 2)
+	if _, err = io.ReadFull(rw, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5Version {
+		return fmt.Errorf("socks5 proxy: unexpected version %d", buf[0])
+	}
+	switch buf[1] {
+	case socks5NoAuth:
+	case socks5UserPass:
+		if user == nil {
+			return fmt.Errorf("socks5 proxy: authentication is required")
+		}
+		if err = socks5Auth(rw, user); err != nil {
+			return err
+		}
+	case socks5NoAcceptable:
+		return fmt.Errorf("socks5 proxy: no acceptable authentication method")
+	default:
+		return fmt.Errorf("socks5 proxy: unsupported authentication method %d", buf[1])
+	}
+
+	req := []byte{socks5Version, socks5Connect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(req, socks5IPv4)
+			req = append(req, ip4...)
+		} else {
+			req = append(req, socks5IPv6)
+			req = append(req, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5 proxy: host name is too long: %q", host)
+		}
+		req = append(req, socks5Domain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err = rw.Write(req); err != nil {
+		return err
+	}
+
+	buf = make([]byte, 4)
+	if _, err = io.ReadFull(rw, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5Version {
+		return fmt.Errorf("socks5 proxy: unexpected version %d", buf[0])
+	}
+	if buf[1] != 0x00 {
+		msg, found := socks5Replies[buf[1]]
+		if !found {
+			msg = "unknown reply " + strconv.Itoa(int(buf[1]))
+		}
+		return fmt.Errorf("socks5 proxy: %s", msg)
+	}
+
+	// Skip the bound address and port.
+	var n int
+	switch buf[3] {
+	case socks5IPv4:
+		n = net.IPv4len
+	case socks5IPv6:
+		n = net.IPv6len
+	case socks5Domain:
+		if _, err = io.ReadFull(rw, buf[:1]); err != nil {
+			return err
+		}
+		n = int(buf[0])
+	default:
+		return fmt.Errorf("socks5 proxy: unknown address type %d", buf[3])
+	}
+	_, err = io.ReadFull(rw, make([]byte, n+2))
+	return err
+}
+
+// socks5Auth authenticates with username and password
+// (RFC 1929).
+func socks5Auth(rw io.ReadWriter, user *url.Userinfo) error {
+	name := user.Username()
+	pass, _ := user.Password()
+	if len(name) > 255 || len(pass) > 255 {
+		return fmt.Errorf("socks5 proxy: username or password is too long")
+	}
+
+	req := []byte{0x01, byte(len(name))}
+	req = append(req, name...)
+	req = append(req, byte(len(pass)))
+	req = append(req, pass...)
+	if _, err := rw.Write(req); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(rw, buf); err != nil {
+		return err
+	}
+	if buf[1] != 0x00 {
+		return fmt.Errorf("socks5 proxy: authentication failed")
+	}
+	return nil
+}
+
+// dialHTTPConnect connects to addr through the HTTP proxy
+// with CONNECT method. Any 2xx response establishes the
+// tunnel (RFC 9110 section 9.3.6). Otherwise the error has
+// the status line of the proxy.
+//
+// ctx context.Context - context of connecting.
+// nd ContextDialer - dialer of the proxy connection.
+// proxy *url.URL - proxy URL. Default port: 80
+// addr string - address of the POP3 server.
+func dialHTTPConnect(ctx context.Context, nd ContextDialer, proxy *url.URL, addr string) (net.Conn, error) {
+	conn, err := nd.DialContext(ctx, "tcp", proxyAddr(proxy, "80"))
+	if err != nil {
+		return nil, err
+	}
+
+	var br *bufio.Reader
+	err = proxyHandshake(ctx, conn, func() error {
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if proxy.User != nil {
+			pass, _ := proxy.User.Password()
+			cred := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + pass))
+			req.Header.Set("Proxy-Authorization", "Basic "+cred)
+		}
+		err := req.Write(conn)
+		if err != nil {
+			return err
+		}
+
+		br = bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			resp.Body.Close()
+			return fmt.Errorf("http proxy: %s %s", resp.Proto, resp.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The server may send the greeting message together with
+	// the proxy response, so the buffered bytes must be read
+	// first.
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads from the buffered reader which is used
+// during the proxy handshake.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads from the buffered reader.
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
@@ -0,0 +1,242 @@
+package pop3_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+// listenProxy starts a fake proxy which accepts one
+// connection and passes it to handle. It returns the address
+// of the proxy.
+func listenProxy(t *testing.T, handle func(conn net.Conn)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return l.Addr().String()
+}
+
+// relay copies the data between the client and the POP3
+// server until the server closes the connection. r reads the
+// client connection.
+func relay(client net.Conn, r io.Reader, server net.Conn) {
+	go func() {
+		io.Copy(server, r)
+		server.Close()
+	}()
+	io.Copy(client, server)
+}
+
+// socks5Server handles the SOCKS5 handshake on the connection
+// and tunnels it to the POP3 server srv. It sends the
+// requested address to target.
+func socks5Server(conn net.Conn, user, pass string, target chan<- string, srv *pop3test.Server) {
+	r := bufio.NewReader(conn)
+	buf := make([]byte, 2)
+	io.ReadFull(r, buf)
+	io.ReadFull(r, make([]byte, buf[1]))
+
+	if user != "" {
+		conn.Write([]byte{pop3.Socks5Version, pop3.Socks5UserPass})
+		io.ReadFull(r, buf)
+		name := make([]byte, buf[1])
+		io.ReadFull(r, name)
+		io.ReadFull(r, buf[:1])
+		pw := make([]byte, buf[0])
+		io.ReadFull(r, pw)
+		if string(name) != user || string(pw) != pass {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+	} else {
+		conn.Write([]byte{pop3.Socks5Version, pop3.Socks5NoAuth})
+	}
+
+	hdr := make([]byte, 5)
+	io.ReadFull(r, hdr)
+	host := make([]byte, hdr[4])
+	io.ReadFull(r, host)
+	port := make([]byte, 2)
+	io.ReadFull(r, port)
+	target <- net.JoinHostPort(string(host), strconv.Itoa(int(port[0])<<8|int(port[1])))
+
+	conn.Write([]byte{pop3.Socks5Version, 0x00, 0x00, pop3.Socks5IPv4, 127, 0, 0, 1, 0x04, 0x38})
+	relay(conn, r, srv.Pipe())
+}
+
+func TestDialer_SOCKS5Proxy(t *testing.T) {
+	srv := newTestServer(t, false)
+	target := make(chan string, 1)
+	addr := listenProxy(t, func(conn net.Conn) {
+		socks5Server(conn, "user", "secret", target, srv)
+	})
+
+	d := &pop3.Dialer{Proxy: &url.URL{
+		Scheme: "socks5",
+		User:   url.UserPassword("user", "secret"),
+		Host:   addr,
+	}}
+	pop, err := d.Dial("pop.example.com:110")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got := <-target; got != "pop.example.com:110" {
+		t.Errorf("expected: pop.example.com:110, got: %s", got)
+	}
+	if !strings.HasPrefix(pop.GreetingMsg(), pop3test.DefaultBanner) {
+		t.Errorf("expected: %s, got: %s", pop3test.DefaultBanner, pop.GreetingMsg())
+	}
+	if _, err = pop.Quit(); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestDialer_SOCKS5ProxyAuthFailed(t *testing.T) {
+	srv := newTestServer(t, false)
+	target := make(chan string, 1)
+	addr := listenProxy(t, func(conn net.Conn) {
+		socks5Server(conn, "user", "secret", target, srv)
+	})
+
+	d := &pop3.Dialer{Proxy: &url.URL{
+		Scheme: "socks5",
+		User:   url.UserPassword("user", "wrong"),
+		Host:   addr,
+	}}
+	_, err := d.Dial("pop.example.com:110")
+	if err == nil {
+		t.Errorf("expected authentication error")
+	}
+}
+
+func TestSocks5HandshakeReplyError(t *testing.T) {
+	var out bytes.Buffer
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{
+		Reader: bytes.NewReader([]byte{
+			pop3.Socks5Version, pop3.Socks5NoAuth,
+			pop3.Socks5Version, 0x05, 0x00, pop3.Socks5IPv4,
+		}),
+		Writer: &out,
+	}
+
+	err := pop3.Socks5Handshake(rw, nil, "192.0.2.1", 995)
+	if err == nil || err.Error() != "socks5 proxy: connection refused" {
+		t.Errorf("expected connection refused, got: %v", err)
+	}
+
+	expected := []byte{
+		pop3.Socks5Version, 1, pop3.Socks5NoAuth,
+		pop3.Socks5Version, pop3.Socks5Connect, 0x00, pop3.Socks5IPv4, 192, 0, 2, 1, 0x03, 0xe3,
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("expected: %x, got: %x", expected, out.Bytes())
+	}
+}
+
+func TestDialer_HTTPConnectProxy(t *testing.T) {
+	srv := newTestServer(t, false)
+	addr := listenProxy(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		cred := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+		if req.Method != http.MethodConnect || req.Host != "pop.example.com:110" ||
+			req.Header.Get("Proxy-Authorization") != cred {
+			conn.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+			return
+		}
+		// The greeting is sent together with the proxy response.
+		server := srv.Pipe()
+		greeting, _ := bufio.NewReader(server).ReadString('\n')
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n" + greeting))
+		relay(conn, r, server)
+	})
+
+	d := &pop3.Dialer{Proxy: &url.URL{
+		Scheme: "http",
+		User:   url.UserPassword("user", "secret"),
+		Host:   addr,
+	}}
+	pop, err := d.Dial("pop.example.com:110")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.HasPrefix(pop.GreetingMsg(), pop3test.DefaultBanner) {
+		t.Errorf("expected: %s, got: %s", pop3test.DefaultBanner, pop.GreetingMsg())
+	}
+	if _, err = pop.Quit(); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestDialer_HTTPConnectProxyRefused(t *testing.T) {
+	addr := listenProxy(t, func(conn net.Conn) {
+		http.ReadRequest(bufio.NewReader(conn))
+		conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+	})
+
+	d := &pop3.Dialer{Proxy: &url.URL{Scheme: "http", Host: addr}}
+	_, err := d.Dial("pop.example.com:110")
+	if err == nil || err.Error() != "http proxy: HTTP/1.1 407 Proxy Authentication Required" {
+		t.Errorf("expected proxy error, got: %v", err)
+	}
+}
+
+func TestDialer_HTTPConnectProxy2xx(t *testing.T) {
+	srv := newTestServer(t, false)
+	addr := listenProxy(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		if _, err := http.ReadRequest(r); err != nil {
+			return
+		}
+		conn.Write([]byte("HTTP/1.0 204 Tunnel Open\r\n\r\n"))
+		relay(conn, r, srv.Pipe())
+	})
+
+	d := &pop3.Dialer{Proxy: &url.URL{Scheme: "http", Host: addr}}
+	pop, err := d.Dial("pop.example.com:110")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer pop.Quit()
+	if !strings.HasPrefix(pop.GreetingMsg(), pop3test.DefaultBanner) {
+		t.Errorf("unexpected greeting: %s", pop.GreetingMsg())
+	}
+}
+
+func TestProxyAddr(t *testing.T) {
+	u := &url.URL{Scheme: "socks5", Host: "proxy.corp"}
+	if addr := pop3.ProxyAddr(u, "1080"); addr != "proxy.corp:1080" {
+		t.Errorf("expected: proxy.corp:1080, got: %s", addr)
+	}
+	u.Host = "proxy.corp:3128"
+	if addr := pop3.ProxyAddr(u, "1080"); addr != "proxy.corp:3128" {
+		t.Errorf("expected: proxy.corp:3128, got: %s", addr)
+	}
+}
@@ -0,0 +1,224 @@
+package pop3
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// ProtocolError describes a violation of POP3 protocol such
+// as a multi-line response which is not terminated.
+type ProtocolError string
+
+// Error returns the description of the protocol violation.
+func (p ProtocolError) Error() string {
+	return string(p)
+}
+
+// setConn sets the connection of the client and creates
+// a new buffered reader for it. It is called when the
+// connection is established or upgraded to TLS.
+//
+// conn net.Conn - connection to POP3 server.
+func (c *Client) setConn(conn net.Conn) {
+	c.Conn = conn
+	c.dc = &deadlineConn{Conn: conn}
+	c.r = bufio.NewReader(c.dc)
+}
+
+// reader returns the buffered reader of the connection.
+// It is created lazily if Conn is set directly.
+func (c *Client) reader() *bufio.Reader {
+	dc := c.conn()
+	if c.r == nil {
+		c.r = bufio.NewReader(dc)
+	}
+	return c.r
+}
+
+// readLine reads a single line from the connection and
+// traces it as a status line.
+func (c *Client) readLine() (string, error) {
+	line, err := c.readRawLine()
+	if err == nil {
+		c.trace(DirServer, line, false)
+		c.recordStatus(line)
+	}
+	return line, err
+}
+
+// readRawLine reads a single line from the connection and
+// strips the line ending (CRLF or LF). It returns
+// io.ErrUnexpectedEOF if the connection is closed in the
+// middle of a line.
+func (c *Client) readRawLine() (string, error) {
+	line, err := c.reader().ReadString('\n')
+	if err == io.EOF && line != "" {
+		return "", io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	c.respBytes += int64(len(line))
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, nil
+}
+
+// readResp reads the single line response of the
+// command. Line ending is not included.
+func (c *Client) readResp() (string, error) {
+	return c.readLine()
+}
+
+// readRespMultiLines reads the response that has multiple
+// lines. The first element is the status line. If it starts
+// with "+OK", the following lines are read until reaching the
+// termination line ("."). The termination line is not
+// included and the lines starting with ".." are un-stuffed.
+// If the status is negative, only the status line is
+// returned because no more lines follow. If the connection
+// ends before the termination line, ProtocolError is
+// returned. On any read error before the termination line,
+// the rest of the response cannot be told apart from the next
+// one, so the connection is closed and the session is
+// disconnected.
+func (c *Client) readRespMultiLines() ([]string, error) {
+	status, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{status}
+	if !strings.HasPrefix(status, ok) {
+		return lines, nil
+	}
+
+	for {
+		l, err := c.readRawLine()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ProtocolError("connection closed before end of multi-line response")
+		}
+		if err != nil {
+			c.abort()
+			return nil, err
+		}
+		c.trace(DirServer, l, true)
+		if l == "." {
+			return lines, nil
+		}
+		if strings.HasPrefix(l, ".") {
+			l = l[1:]
+		}
+		lines = append(lines, l)
+	}
+}
+
+// dotReader reads the body of a multi-line response. It
+// un-stuffs the lines starting with ".." and returns io.EOF
+// at the termination line. Line endings are kept as they
+// are sent by the server.
+type dotReader struct {
+	c *Client
+
+	// end finishes the command which is started by
+	// Client.begin. It is called once.
+	end func(error) error
+
+	// line keeps the decoded bytes which are not read yet.
+	line []byte
+
+	// err keeps the read error, so it is returned again.
+	err error
+
+	// done is true after the termination line is read.
+	done bool
+
+	// closed is true after Close is called.
+	closed bool
+
+	// batch is true for the readers of RetrMany. The batch
+	// holds the lock of the client until it ends, so finish
+	// does nothing.
+	batch bool
+}
+
+// Read reads the decoded message body.
+func (d *dotReader) Read(p []byte) (int, error) {
+	if d.closed {
+		return 0, errors.New("read from closed message reader")
+	}
+	for len(d.line) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if d.err != nil {
+			return 0, d.err
+		}
+		l, err := d.c.reader().ReadString('\n')
+		if err == io.EOF {
+			err = ProtocolError("connection closed before end of multi-line response")
+		}
+		if err != nil {
+			d.err = d.finish(err)
+			return 0, d.err
+		}
+		d.c.trace(DirServer, strings.TrimRight(l, "\r\n"), true)
+		d.c.respBytes += int64(len(l))
+		if l == ".\r\n" || l == ".\n" {
+			d.done = true
+			d.finish(nil)
+			continue
+		}
+		if strings.HasPrefix(l, ".") {
+			l = l[1:]
+		}
+		d.line = []byte(l)
+	}
+
+	n := copy(p, d.line)
+	d.line = d.line[n:]
+	return n, nil
+}
+
+// Close drains the rest of the response, so the next
+// command can be sent, and releases the client.
+func (d *dotReader) Close() error {
+	if d.closed {
+		return nil
+	}
+	var err error
+	if !d.done {
+		d.line = nil
+		_, err = io.Copy(io.Discard, d)
+	}
+	d.closed = true
+	d.finish(nil)
+	return err
+}
+
+// finish releases the client and ends the command. It
+// returns the error which is returned by the end function.
+// A read error before the termination line leaves the rest of
+// the message on the connection, so the connection is closed
+// and the session is disconnected.
+func (d *dotReader) finish(err error) error {
+	if d.batch {
+		if err != nil {
+			d.c.abort()
+		}
+		return err
+	}
+	d.c.mu.Lock()
+	defer d.c.mu.Unlock()
+	if err != nil {
+		d.c.abort()
+	}
+	d.c.releaseReader()
+	if d.end != nil {
+		err = d.end(err)
+		d.end = nil
+	}
+	return err
+}
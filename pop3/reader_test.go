@@ -0,0 +1,229 @@
+package pop3_test
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+func TestReadResp(t *testing.T) {
+	pop := pop3test.ScriptClient(t, pop3test.Step{Expect: pop3test.NoLine, Send: "+OK 2 320\r\n+OK\n", Raw: true})
+
+	resp, err := pop.ReadResp()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if resp != "+OK 2 320" {
+		t.Errorf("expected: %q, got: %q", "+OK 2 320", resp)
+	}
+
+	resp, err = pop.ReadResp()
+	if err != nil || resp != "+OK" {
+		t.Errorf("expected: %q, got: %q (%v)", "+OK", resp, err)
+	}
+
+	if _, err = pop.ReadResp(); err != io.EOF {
+		t.Errorf("expected: %v, got: %v", io.EOF, err)
+	}
+}
+
+func TestReadRespPartialLine(t *testing.T) {
+	pop := pop3test.ScriptClient(t, pop3test.Step{Expect: pop3test.NoLine, Send: "+OK 2", Raw: true})
+	if _, err := pop.ReadResp(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected: %v, got: %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestReadRespMultiLines(t *testing.T) {
+	pop := pop3test.ScriptClient(t, pop3test.Step{
+		Expect: pop3test.NoLine,
+		Send: "+OK message follows\r\n" +
+			"Subject: test\r\n" +
+			"\r\n" +
+			"..hidden line\r\n" +
+			".\r\n" +
+			"+OK next\r\n",
+		Raw: true,
+	})
+
+	lines, err := pop.ReadRespMultiLines()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	exp := []string{"+OK message follows", "Subject: test", "", ".hidden line"}
+	if !reflect.DeepEqual(lines, exp) {
+		t.Errorf("expected: %q, got: %q", exp, lines)
+	}
+
+	// The next response must not be consumed.
+	resp, err := pop.ReadResp()
+	if err != nil || resp != "+OK next" {
+		t.Errorf("expected: %q, got: %q (%v)", "+OK next", resp, err)
+	}
+}
+
+func TestReadRespMultiLinesLarge(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("+OK\r\n")
+	for i := 0; i < 1000; i++ {
+		b.WriteString(strings.Repeat("x", 70) + "\r\n")
+	}
+	b.WriteString(".\r\n")
+
+	pop := pop3test.ScriptClient(t, pop3test.Step{Expect: pop3test.NoLine, Send: b.String(), Raw: true})
+	lines, err := pop.ReadRespMultiLines()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(lines) != 1001 {
+		t.Errorf("expected: %d, got: %d", 1001, len(lines))
+	}
+}
+
+func TestReadRespMultiLinesErr(t *testing.T) {
+	pop := pop3test.ScriptClient(t, pop3test.Step{
+		Expect: pop3test.NoLine,
+		Send:   "-ERR no such message\r\n+OK\r\n",
+		Raw:    true,
+	})
+	lines, err := pop.ReadRespMultiLines()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !reflect.DeepEqual(lines, []string{"-ERR no such message"}) {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+}
+
+func TestReadRespMultiLinesUnterminated(t *testing.T) {
+	pop := pop3test.ScriptClient(t, pop3test.Step{Expect: pop3test.NoLine, Send: "+OK\r\n1 120\r\n", Raw: true})
+	_, err := pop.ReadRespMultiLines()
+	if _, ok := err.(pop3.ProtocolError); !ok {
+		t.Errorf("expected ProtocolError, got: %v", err)
+	}
+	if pop.State() != pop3.StateDisconnected {
+		t.Errorf("expected: %v, got: %v", pop3.StateDisconnected, pop.State())
+	}
+}
+
+func TestClient_ListBrokenOff(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "LIST", Send: "+OK\r\n1 120", Raw: true},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	if _, err := pop.ListAll(); err == nil {
+		t.Fatalf("expected error for the broken off response")
+	}
+	if pop.State() != pop3.StateDisconnected {
+		t.Errorf("expected: %v, got: %v", pop3.StateDisconnected, pop.State())
+	}
+	if _, err := pop.Noop(); err == nil {
+		t.Errorf("expected error on the closed connection")
+	}
+}
+
+func TestClient_RetrReader(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "RETR 1", Send: "+OK 42 octets\r\nSubject: test\r\n\r\n..hidden\r\nbody\r\n."},
+		pop3test.Step{Expect: "NOOP", Send: "+OK"},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	r, err := pop.RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// The command waits for the reader until its context
+	// ends, and it is not sent.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = pop.NoopContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	exp := "Subject: test\r\n\r\n.hidden\r\nbody\r\n"
+	if string(body) != exp {
+		t.Errorf("expected: %q, got: %q", exp, body)
+	}
+	if err = r.Close(); err != nil {
+		t.Errorf(err.Error())
+	}
+
+	resp, err := pop.Noop()
+	if err != nil || resp != "+OK" {
+		t.Errorf("expected: %q, got: %q (%v)", "+OK", resp, err)
+	}
+}
+
+func TestClient_RetrReaderCloseEarly(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "RETR 1", Send: "+OK\r\nline 1\r\nline 2\r\nline 3\r\n."},
+		pop3test.Step{Expect: "NOOP", Send: "+OK"},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	r, err := pop.RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	buf := make([]byte, 3)
+	if _, err = r.Read(buf); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err = r.Close(); err != nil {
+		t.Errorf(err.Error())
+	}
+
+	resp, err := pop.Noop()
+	if err != nil || resp != "+OK" {
+		t.Errorf("expected: %q, got: %q (%v)", "+OK", resp, err)
+	}
+}
+
+func TestClient_RetrReaderErr(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "RETR 3", Send: "-ERR no such message"},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	r, err := pop.RetrReader(3)
+	if err == nil {
+		t.Errorf("expected error, got reader: %v", r)
+	}
+	if pop.ReaderOpen() {
+		t.Errorf("client must not be locked after negative response")
+	}
+}
+
+func TestClient_RetrReaderUnterminated(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "RETR 1", Send: "+OK\r\nline 1"},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	r, err := pop.RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	_, err = io.ReadAll(r)
+	if _, ok := err.(pop3.ProtocolError); !ok {
+		t.Errorf("expected ProtocolError, got: %v", err)
+	}
+	if pop.State() != pop3.StateDisconnected {
+		t.Errorf("expected: %v, got: %v", pop3.StateDisconnected, pop.State())
+	}
+	if pop.ReaderOpen() {
+		t.Errorf("reader must be released after the error")
+	}
+}
@@ -0,0 +1,39 @@
+package sasl
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+)
+
+// cramMD5Client implements CRAM-MD5 mechanism.
+type cramMD5Client struct {
+	username string
+	secret   string
+}
+
+// NewCramMD5Client returns a client side CRAM-MD5 mechanism which
+// is defined in RFC 2195. The secret is never sent over the network,
+// the client answers the server challenge with keyed MD5 digest.
+//
+// username string - username of the user.
+// secret string - shared secret of the user.
+func NewCramMD5Client(username, secret string) Mechanism {
+	return &cramMD5Client{
+		username: username,
+		secret:   secret,
+	}
+}
+
+// Start returns the mechanism name without initial response.
+func (c *cramMD5Client) Start() (string, []byte, error) {
+	return "CRAM-MD5", nil, nil
+}
+
+// Next answers the challenge with the username and HMAC-MD5
+// digest of the challenge as lowercase hex characters.
+func (c *cramMD5Client) Next(challenge []byte) ([]byte, error) {
+	mac := hmac.New(md5.New, []byte(c.secret))
+	mac.Write(challenge)
+	return []byte(c.username + " " + hex.EncodeToString(mac.Sum(nil))), nil
+}
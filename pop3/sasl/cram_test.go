@@ -0,0 +1,24 @@
+package sasl
+
+import "testing"
+
+func TestCramMD5Client(t *testing.T) {
+	// Example is taken from RFC 2195.
+	m := NewCramMD5Client("tim", "tanstaaftanstaaf")
+	mech, ir, err := m.Start()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if mech != "CRAM-MD5" || ir != nil {
+		t.Errorf("unexpected start: %s %q", mech, ir)
+	}
+
+	resp, err := m.Next([]byte("<1896.697170952@postoffice.reston.mci.net>"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	exp := "tim b913a602c7eda7a495b4e6e7334d3890"
+	if string(resp) != exp {
+		t.Errorf("expected: %s, got: %s", exp, resp)
+	}
+}
@@ -0,0 +1,45 @@
+package sasl
+
+// loginClient implements LOGIN mechanism.
+type loginClient struct {
+	username string
+	password string
+
+	// step keeps the number of answered challenges.
+	step int
+}
+
+// NewLoginClient returns a client side LOGIN mechanism. LOGIN
+// is obsolete, but still widely deployed. The server asks
+// username and password in two challenges, and the client
+// answers them in plaintext, so it should be used only over
+// TLS.
+//
+// username string - username of the user.
+// password string - password of the user.
+func NewLoginClient(username, password string) Mechanism {
+	return &loginClient{
+		username: username,
+		password: password,
+	}
+}
+
+// Start returns the mechanism name without initial response.
+func (l *loginClient) Start() (string, []byte, error) {
+	l.step = 0
+	return "LOGIN", nil, nil
+}
+
+// Next answers the username challenge first and the password
+// challenge second. Challenge texts like "Username:" are not
+// checked because servers word them differently.
+func (l *loginClient) Next(challenge []byte) ([]byte, error) {
+	l.step++
+	switch l.step {
+	case 1:
+		return []byte(l.username), nil
+	case 2:
+		return []byte(l.password), nil
+	}
+	return nil, ErrUnexpectedChallenge
+}
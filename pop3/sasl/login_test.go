@@ -0,0 +1,26 @@
+package sasl
+
+import "testing"
+
+func TestLoginClient(t *testing.T) {
+	m := NewLoginClient("user", "secret")
+	mech, ir, err := m.Start()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if mech != "LOGIN" || ir != nil {
+		t.Errorf("unexpected start: %s %q", mech, ir)
+	}
+
+	resp, err := m.Next([]byte("Username:"))
+	if err != nil || string(resp) != "user" {
+		t.Errorf("expected: %s, got: %q (%v)", "user", resp, err)
+	}
+	resp, err = m.Next([]byte("Password:"))
+	if err != nil || string(resp) != "secret" {
+		t.Errorf("expected: %s, got: %q (%v)", "secret", resp, err)
+	}
+	if _, err = m.Next(nil); err != ErrUnexpectedChallenge {
+		t.Errorf("expected: %v, got: %v", ErrUnexpectedChallenge, err)
+	}
+}
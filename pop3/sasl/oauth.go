@@ -0,0 +1,191 @@
+package sasl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TokenSource provides OAuth 2.0 access tokens. Token is called
+// every time the authentication starts, so refreshed tokens are
+// picked up without creating a new mechanism.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenSourceFunc is an adapter to use ordinary functions as
+// TokenSource.
+type TokenSourceFunc func() (string, error)
+
+// Token calls f.
+func (f TokenSourceFunc) Token() (string, error) {
+	return f()
+}
+
+// StaticToken returns a TokenSource which always returns the
+// given token.
+func StaticToken(token string) TokenSource {
+	return TokenSourceFunc(func() (string, error) {
+		return token, nil
+	})
+}
+
+// Failer is implemented by mechanisms which decode a structured
+// error from the server's last challenge. If the server rejects
+// the authentication, the client returns an error which wraps
+// the error of Failure together with the "-ERR" response.
+type Failer interface {
+	// Failure returns the error which is decoded from the
+	// server challenge or nil.
+	Failure() error
+}
+
+// OAuthError is the error which the server sends as a JSON
+// challenge when OAuth authentication fails (RFC 7628 section
+// 3.2.2).
+type OAuthError struct {
+	// Status is the authorization error code, e.g. "invalid_token"
+	// or "401".
+	Status string `json:"status"`
+
+	// Schemes is the space separated list of supported schemes.
+	Schemes string `json:"schemes,omitempty"`
+
+	// Scope is the space separated list of required scopes.
+	Scope string `json:"scope,omitempty"`
+
+	// OpenIDConfiguration is the URL of the OpenID Connect
+	// discovery document.
+	OpenIDConfiguration string `json:"openid-configuration,omitempty"`
+}
+
+// Error returns the status and scope of the OAuth error.
+func (e *OAuthError) Error() string {
+	msg := "oauth authentication failed: status " + e.Status
+	if e.Scope != "" {
+		msg += ", scope " + e.Scope
+	}
+	return msg
+}
+
+// decodeOAuthError decodes the JSON challenge of the server.
+func decodeOAuthError(challenge []byte) error {
+	oerr := &OAuthError{}
+	err := json.Unmarshal(challenge, oerr)
+	if err != nil {
+		return fmt.Errorf("malformed oauth error challenge: %w", err)
+	}
+	return oerr
+}
+
+// xoauth2Client implements XOAUTH2 mechanism.
+type xoauth2Client struct {
+	username string
+	src      TokenSource
+	failure  error
+}
+
+// NewXOAuth2Client returns a client side XOAUTH2 mechanism which
+// is used by Gmail and Microsoft 365. The access token is taken
+// from src on every login.
+//
+// username string - mail address of the user.
+// src TokenSource - OAuth 2.0 access token provider.
+func NewXOAuth2Client(username string, src TokenSource) Mechanism {
+	return &xoauth2Client{
+		username: username,
+		src:      src,
+	}
+}
+
+// Start fetches the token and returns it in the initial response.
+func (x *xoauth2Client) Start() (string, []byte, error) {
+	x.failure = nil
+	token, err := x.src.Token()
+	if err != nil {
+		return "", nil, err
+	}
+	ir := "user=" + x.username + "\x01auth=Bearer " + token + "\x01\x01"
+	return "XOAUTH2", []byte(ir), nil
+}
+
+// Next decodes the error challenge and answers with an empty
+// response which makes the server finish the exchange.
+func (x *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	x.failure = decodeOAuthError(challenge)
+	return []byte{}, nil
+}
+
+// Failure returns the decoded error challenge.
+func (x *xoauth2Client) Failure() error {
+	return x.failure
+}
+
+// oauthBearerClient implements OAUTHBEARER mechanism.
+type oauthBearerClient struct {
+	username string
+	host     string
+	port     int
+	src      TokenSource
+	failure  error
+}
+
+// NewOAuthBearerClient returns a client side OAUTHBEARER mechanism
+// which is defined in RFC 7628. The access token is taken from src
+// on every login.
+//
+// username string - authorization identity. It can be empty.
+// host string - server host name. It can be empty.
+// port int - server port. It is omitted if it is 0.
+// src TokenSource - OAuth 2.0 access token provider.
+func NewOAuthBearerClient(username, host string, port int, src TokenSource) Mechanism {
+	return &oauthBearerClient{
+		username: username,
+		host:     host,
+		port:     port,
+		src:      src,
+	}
+}
+
+// Start fetches the token and returns it in the initial response.
+func (o *oauthBearerClient) Start() (string, []byte, error) {
+	o.failure = nil
+	token, err := o.src.Token()
+	if err != nil {
+		return "", nil, err
+	}
+
+	ir := "n,"
+	if o.username != "" {
+		ir += "a=" + escapeSaslname(o.username)
+	}
+	ir += ",\x01"
+	if o.host != "" {
+		ir += "host=" + o.host + "\x01"
+	}
+	if o.port != 0 {
+		ir += "port=" + strconv.Itoa(o.port) + "\x01"
+	}
+	ir += "auth=Bearer " + token + "\x01\x01"
+	return "OAUTHBEARER", []byte(ir), nil
+}
+
+// Next decodes the error challenge and answers with the dummy
+// response (a single 0x01 byte) required by RFC 7628.
+func (o *oauthBearerClient) Next(challenge []byte) ([]byte, error) {
+	o.failure = decodeOAuthError(challenge)
+	return []byte{0x01}, nil
+}
+
+// Failure returns the decoded error challenge.
+func (o *oauthBearerClient) Failure() error {
+	return o.failure
+}
+
+// escapeSaslname escapes "=" and "," characters of the
+// username as described in RFC 5801.
+func escapeSaslname(name string) string {
+	name = strings.ReplaceAll(name, "=", "=3D")
+	return strings.ReplaceAll(name, ",", "=2C")
+}
@@ -0,0 +1,94 @@
+package sasl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestXOAuth2Client(t *testing.T) {
+	calls := 0
+	src := TokenSourceFunc(func() (string, error) {
+		calls++
+		return "token" + string(rune('0'+calls)), nil
+	})
+	m := NewXOAuth2Client("user@example.com", src)
+
+	mech, ir, err := m.Start()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if mech != "XOAUTH2" {
+		t.Errorf("expected: %s, got: %s", "XOAUTH2", mech)
+	}
+	exp := "user=user@example.com\x01auth=Bearer token1\x01\x01"
+	if string(ir) != exp {
+		t.Errorf("expected: %q, got: %q", exp, ir)
+	}
+
+	// Token must be fetched again on the next login.
+	_, ir, _ = m.Start()
+	exp = "user=user@example.com\x01auth=Bearer token2\x01\x01"
+	if string(ir) != exp {
+		t.Errorf("expected: %q, got: %q", exp, ir)
+	}
+}
+
+func TestXOAuth2ClientFailure(t *testing.T) {
+	m := NewXOAuth2Client("user@example.com", StaticToken("expired"))
+	m.Start()
+
+	resp, err := m.Next([]byte(`{"status":"401","schemes":"bearer","scope":"https://mail.google.com/"}`))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(resp) != 0 {
+		t.Errorf("expected empty response, got: %q", resp)
+	}
+
+	var oerr *OAuthError
+	if !errors.As(m.(Failer).Failure(), &oerr) {
+		t.Fatalf("expected *OAuthError, got: %v", m.(Failer).Failure())
+	}
+	if oerr.Status != "401" || oerr.Scope != "https://mail.google.com/" {
+		t.Errorf("unexpected error: %+v", oerr)
+	}
+
+	m.Start()
+	if m.(Failer).Failure() != nil {
+		t.Errorf("failure must be reset on start")
+	}
+}
+
+func TestOAuthBearerClient(t *testing.T) {
+	m := NewOAuthBearerClient("user,a=b", "pop.example.com", 995, StaticToken("vF9dft4qmT"))
+	mech, ir, err := m.Start()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if mech != "OAUTHBEARER" {
+		t.Errorf("expected: %s, got: %s", "OAUTHBEARER", mech)
+	}
+	exp := "n,a=user=2Ca=3Db,\x01host=pop.example.com\x01port=995\x01auth=Bearer vF9dft4qmT\x01\x01"
+	if string(ir) != exp {
+		t.Errorf("expected: %q, got: %q", exp, ir)
+	}
+
+	resp, _ := m.Next([]byte(`{"status":"invalid_token"}`))
+	if string(resp) != "\x01" {
+		t.Errorf("expected dummy response, got: %q", resp)
+	}
+	var oerr *OAuthError
+	if !errors.As(m.(Failer).Failure(), &oerr) || oerr.Status != "invalid_token" {
+		t.Errorf("unexpected failure: %v", m.(Failer).Failure())
+	}
+}
+
+func TestOAuthTokenError(t *testing.T) {
+	tokenErr := errors.New("refresh failed")
+	m := NewOAuthBearerClient("", "", 0, TokenSourceFunc(func() (string, error) {
+		return "", tokenErr
+	}))
+	if _, _, err := m.Start(); err != tokenErr {
+		t.Errorf("expected: %v, got: %v", tokenErr, err)
+	}
+}
@@ -0,0 +1,37 @@
+package sasl
+
+// plainClient implements PLAIN mechanism.
+type plainClient struct {
+	identity string
+	username string
+	password string
+}
+
+// NewPlainClient returns a client side PLAIN mechanism which
+// is defined in RFC 4616. The credentials are sent in plaintext,
+// so it should be used only over TLS.
+//
+// identity string - authorization identity. It can be empty
+// to act as the username.
+// username string - authentication identity.
+// password string - password of the user.
+func NewPlainClient(identity, username, password string) Mechanism {
+	return &plainClient{
+		identity: identity,
+		username: username,
+		password: password,
+	}
+}
+
+// Start returns the credentials separated by NUL characters
+// as the initial response.
+func (p *plainClient) Start() (string, []byte, error) {
+	ir := []byte(p.identity + "\x00" + p.username + "\x00" + p.password)
+	return "PLAIN", ir, nil
+}
+
+// Next returns ErrUnexpectedChallenge because PLAIN mechanism
+// completes with the initial response.
+func (p *plainClient) Next(challenge []byte) ([]byte, error) {
+	return nil, ErrUnexpectedChallenge
+}
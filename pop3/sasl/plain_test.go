@@ -0,0 +1,22 @@
+package sasl
+
+import "testing"
+
+func TestPlainClient(t *testing.T) {
+	m := NewPlainClient("admin", "user", "secret")
+	mech, ir, err := m.Start()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if mech != "PLAIN" {
+		t.Errorf("expected: %s, got: %s", "PLAIN", mech)
+	}
+	exp := "admin\x00user\x00secret"
+	if string(ir) != exp {
+		t.Errorf("expected: %q, got: %q", exp, ir)
+	}
+
+	if _, err = m.Next([]byte("more")); err != ErrUnexpectedChallenge {
+		t.Errorf("expected: %v, got: %v", ErrUnexpectedChallenge, err)
+	}
+}
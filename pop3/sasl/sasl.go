@@ -0,0 +1,28 @@
+// Package sasl implements Simple Authentication and Security
+// Layer (SASL) mechanisms which can be used with the AUTH
+// command of POP3 (RFC 5034). Custom mechanisms can be plugged
+// in by implementing Mechanism interface.
+package sasl
+
+import "errors"
+
+// ErrUnexpectedChallenge is returned by mechanisms when the
+// server sends a challenge which the mechanism does not expect.
+var ErrUnexpectedChallenge = errors.New("unexpected server challenge")
+
+// Mechanism is a client side SASL mechanism. The client calls
+// Start once when the AUTH command is sent and Next for every
+// challenge the server sends until the server responds with
+// "+OK" or "-ERR". Challenges and responses are passed in raw
+// form, base64 encoding is handled by the client.
+type Mechanism interface {
+	// Start begins the authentication. It returns the
+	// mechanism name and the initial response. ir is nil
+	// if the mechanism has no initial response.
+	Start() (mech string, ir []byte, err error)
+
+	// Next processes the server challenge and returns the
+	// response. If it returns an error, the client cancels
+	// the authentication.
+	Next(challenge []byte) (response []byte, err error)
+}
@@ -0,0 +1,289 @@
+package sasl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrServerSignature is returned by SCRAM mechanisms when the
+	// server signature does not match. It means that the server
+	// does not know the password of the user.
+	ErrServerSignature = errors.New("scram: server signature mismatch")
+
+	// ErrNoChannelBinding is returned by SCRAM-PLUS mechanisms when
+	// the connection is not encrypted with TLS.
+	ErrNoChannelBinding = errors.New("scram: channel binding requires TLS")
+
+	// errNotVerified is returned when the server finishes the
+	// exchange without sending its signature.
+	errNotVerified = errors.New("scram: server signature is not verified")
+)
+
+// ChannelBinder is implemented by mechanisms which bind the
+// authentication to the TLS connection. The client calls BindTLS
+// before Start if the connection is encrypted with TLS.
+type ChannelBinder interface {
+	BindTLS(cs tls.ConnectionState)
+}
+
+// Completer is implemented by mechanisms which must verify the
+// server before the authentication is accepted. The client calls
+// Complete when the server responds with "+OK". If it returns an
+// error, the authentication fails.
+type Completer interface {
+	Complete() error
+}
+
+// scramClient implements SCRAM-SHA-1, SCRAM-SHA-256 and their
+// -PLUS variants which are defined in RFC 5802 and RFC 7677.
+type scramClient struct {
+	name     string
+	newHash  func() hash.Hash
+	plus     bool
+	username string
+	password string
+
+	// cbType and cbData keep the channel binding. tls is true
+	// if the connection is encrypted with TLS.
+	cbType string
+	cbData []byte
+	tls    bool
+
+	// nonce is the client nonce. It is generated in Start if
+	// it is empty.
+	nonce string
+
+	step            int
+	gs2Header       string
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+	verified        bool
+}
+
+// NewScramSHA1Client returns a client side SCRAM-SHA-1 mechanism.
+//
+// username string - username of the user.
+// password string - password of the user.
+func NewScramSHA1Client(username, password string) Mechanism {
+	return newScramClient("SCRAM-SHA-1", sha1.New, false, username, password)
+}
+
+// NewScramSHA256Client returns a client side SCRAM-SHA-256 mechanism.
+//
+// username string - username of the user.
+// password string - password of the user.
+func NewScramSHA256Client(username, password string) Mechanism {
+	return newScramClient("SCRAM-SHA-256", sha256.New, false, username, password)
+}
+
+// NewScramSHA1PlusClient returns a client side SCRAM-SHA-1-PLUS
+// mechanism which binds the authentication to the TLS connection.
+// It fails with ErrNoChannelBinding on plaintext connections.
+//
+// username string - username of the user.
+// password string - password of the user.
+func NewScramSHA1PlusClient(username, password string) Mechanism {
+	return newScramClient("SCRAM-SHA-1-PLUS", sha1.New, true, username, password)
+}
+
+// NewScramSHA256PlusClient returns a client side SCRAM-SHA-256-PLUS
+// mechanism which binds the authentication to the TLS connection.
+// It fails with ErrNoChannelBinding on plaintext connections.
+//
+// username string - username of the user.
+// password string - password of the user.
+func NewScramSHA256PlusClient(username, password string) Mechanism {
+	return newScramClient("SCRAM-SHA-256-PLUS", sha256.New, true, username, password)
+}
+
+// newScramClient creates a SCRAM mechanism with the given hash.
+func newScramClient(name string, h func() hash.Hash, plus bool, username, password string) *scramClient {
+	return &scramClient{
+		name:     name,
+		newHash:  h,
+		plus:     plus,
+		username: username,
+		password: password,
+	}
+}
+
+// BindTLS keeps the channel binding data of the TLS connection.
+// tls-exporter is used for TLS 1.3 and tls-unique for older
+// versions. Only -PLUS variants use it, the others announce
+// with gs2 flag "y" that they support channel binding but
+// the server does not (RFC 5802 section 6).
+func (s *scramClient) BindTLS(cs tls.ConnectionState) {
+	s.tls = true
+	if cs.Version == tls.VersionTLS13 {
+		data, err := cs.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+		if err != nil {
+			return
+		}
+		s.cbType, s.cbData = "tls-exporter", data
+		return
+	}
+	s.cbType, s.cbData = "tls-unique", cs.TLSUnique
+}
+
+// Start returns client-first-message as the initial response.
+func (s *scramClient) Start() (string, []byte, error) {
+	s.step = 0
+	s.verified = false
+
+	s.gs2Header = "n,,"
+	if s.tls {
+		s.gs2Header = "y,,"
+	}
+	if s.plus {
+		if s.cbType == "" || len(s.cbData) == 0 {
+			return "", nil, ErrNoChannelBinding
+		}
+		s.gs2Header = "p=" + s.cbType + ",,"
+	}
+
+	s.clientNonce = s.nonce
+	if s.clientNonce == "" {
+		buf := make([]byte, 18)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return "", nil, err
+		}
+		s.clientNonce = base64.StdEncoding.EncodeToString(buf)
+	}
+	s.clientFirstBare = "n=" + escapeSaslname(s.username) + ",r=" + s.clientNonce
+	return s.name, []byte(s.gs2Header + s.clientFirstBare), nil
+}
+
+// Next answers server-first-message with client-final-message
+// and verifies the signature in server-final-message.
+func (s *scramClient) Next(challenge []byte) ([]byte, error) {
+	s.step++
+	switch s.step {
+	case 1:
+		return s.clientFinal(string(challenge))
+	case 2:
+		return nil, s.verify(string(challenge))
+	}
+	return nil, ErrUnexpectedChallenge
+}
+
+// Complete returns an error if the server signature has not
+// been verified.
+func (s *scramClient) Complete() error {
+	if !s.verified {
+		return errNotVerified
+	}
+	return nil
+}
+
+// clientFinal computes the client proof for server-first-message.
+func (s *scramClient) clientFinal(serverFirst string) ([]byte, error) {
+	attrs, err := parseScramAttrs(serverFirst)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := attrs["m"]; found {
+		return nil, fmt.Errorf("scram: unsupported mandatory extension")
+	}
+
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, s.clientNonce) || len(nonce) == len(s.clientNonce) {
+		return nil, fmt.Errorf("scram: invalid server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("scram: invalid salt")
+	}
+	iter, err := strconv.Atoi(attrs["i"])
+	if err != nil || iter < 1 {
+		return nil, fmt.Errorf("scram: invalid iteration count")
+	}
+
+	cbind := []byte(s.gs2Header)
+	if s.plus {
+		cbind = append(cbind, s.cbData...)
+	}
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString(cbind) + ",r=" + nonce
+	authMsg := s.clientFirstBare + "," + serverFirst + "," + withoutProof
+
+	salted := pbkdf2(s.newHash, []byte(s.password), salt, iter)
+	clientKey := s.hmac(salted, []byte("Client Key"))
+	h := s.newHash()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+	clientSig := s.hmac(storedKey, []byte(authMsg))
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSig[i]
+	}
+	serverKey := s.hmac(salted, []byte("Server Key"))
+	s.serverSignature = s.hmac(serverKey, []byte(authMsg))
+
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verify checks the signature in server-final-message.
+func (s *scramClient) verify(serverFinal string) error {
+	attrs, err := parseScramAttrs(serverFinal)
+	if err != nil {
+		return err
+	}
+	if msg, found := attrs["e"]; found {
+		return fmt.Errorf("scram: server error: %s", msg)
+	}
+	sig, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(sig, s.serverSignature) {
+		return ErrServerSignature
+	}
+	s.verified = true
+	return nil
+}
+
+// hmac computes HMAC of msg with the mechanism's hash.
+func (s *scramClient) hmac(key, msg []byte) []byte {
+	mac := hmac.New(s.newHash, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// parseScramAttrs parses comma separated "k=v" attributes.
+func parseScramAttrs(msg string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	for _, a := range strings.Split(msg, ",") {
+		if len(a) < 2 || a[1] != '=' {
+			return nil, fmt.Errorf("scram: malformed message: %q", msg)
+		}
+		attrs[a[:1]] = a[2:]
+	}
+	return attrs, nil
+}
+
+// pbkdf2 derives the salted password, which is Hi function in
+// RFC 5802. The output length is the hash size.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iter int) []byte {
+	mac := hmac.New(h, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	out := append([]byte(nil), u...)
+	for i := 1; i < iter; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range out {
+			out[j] ^= u[j]
+		}
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package sasl
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestScramSHA1Client(t *testing.T) {
+	// Example is taken from RFC 5802.
+	m := NewScramSHA1Client("user", "pencil").(*scramClient)
+	m.nonce = "fyko+d2lbbFgONRv9qkxdawL"
+	testScramExchange(t, m,
+		"SCRAM-SHA-1",
+		"n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL",
+		"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+		"c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+		"v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+	)
+}
+
+func TestScramSHA256Client(t *testing.T) {
+	// Example is taken from RFC 7677.
+	m := NewScramSHA256Client("user", "pencil").(*scramClient)
+	m.nonce = "rOprNGfwEbeRWgbNEkqO"
+	testScramExchange(t, m,
+		"SCRAM-SHA-256",
+		"n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+	)
+}
+
+func testScramExchange(t *testing.T, m *scramClient, name, clientFirst, serverFirst, clientFinal, serverFinal string) {
+	mech, ir, err := m.Start()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if mech != name {
+		t.Errorf("expected: %s, got: %s", name, mech)
+	}
+	if string(ir) != clientFirst {
+		t.Errorf("expected: %s, got: %s", clientFirst, ir)
+	}
+
+	resp, err := m.Next([]byte(serverFirst))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if string(resp) != clientFinal {
+		t.Errorf("expected: %s, got: %s", clientFinal, resp)
+	}
+	if m.Complete() == nil {
+		t.Errorf("expected error before server signature is verified")
+	}
+
+	resp, err = m.Next([]byte(serverFinal))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(resp) != 0 {
+		t.Errorf("expected empty response, got: %q", resp)
+	}
+	if err = m.Complete(); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestScramServerSignatureMismatch(t *testing.T) {
+	m := NewScramSHA256Client("user", "pencil").(*scramClient)
+	m.nonce = "rOprNGfwEbeRWgbNEkqO"
+	m.Start()
+	_, err := m.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	_, err = m.Next([]byte("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	if err != ErrServerSignature {
+		t.Errorf("expected: %v, got: %v", ErrServerSignature, err)
+	}
+	if m.Complete() == nil {
+		t.Errorf("expected error for unverified server")
+	}
+}
+
+func TestScramInvalidServerNonce(t *testing.T) {
+	m := NewScramSHA1Client("user", "pencil").(*scramClient)
+	m.nonce = "fyko+d2lbbFgONRv9qkxdawL"
+	m.Start()
+	if _, err := m.Next([]byte("r=somethingElse,s=QSXCR+Q6sek8bf92,i=4096")); err == nil {
+		t.Errorf("expected error for foreign nonce")
+	}
+}
+
+func TestScramPlusRequiresTLS(t *testing.T) {
+	m := NewScramSHA256PlusClient("user", "pencil")
+	if _, _, err := m.Start(); err != ErrNoChannelBinding {
+		t.Errorf("expected: %v, got: %v", ErrNoChannelBinding, err)
+	}
+}
+
+func TestScramPlusChannelBinding(t *testing.T) {
+	m := NewScramSHA1PlusClient("user", "pencil").(*scramClient)
+	m.nonce = "fyko+d2lbbFgONRv9qkxdawL"
+	m.BindTLS(tls.ConnectionState{Version: tls.VersionTLS12, TLSUnique: []byte{1, 2, 3}})
+
+	_, ir, err := m.Start()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	exp := "p=tls-unique,,n=user,r=fyko+d2lbbFgONRv9qkxdawL"
+	if string(ir) != exp {
+		t.Errorf("expected: %s, got: %s", exp, ir)
+	}
+
+	resp, err := m.Next([]byte("r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// base64("p=tls-unique,," + "\x01\x02\x03")
+	expPrefix := "c=cD10bHMtdW5pcXVlLCwBAgM=,"
+	if string(resp[:len(expPrefix)]) != expPrefix {
+		t.Errorf("expected prefix: %s, got: %s", expPrefix, resp)
+	}
+}
+
+func TestScramTLSWithoutPlus(t *testing.T) {
+	m := NewScramSHA1Client("user", "pencil").(*scramClient)
+	m.nonce = "fyko+d2lbbFgONRv9qkxdawL"
+	m.BindTLS(tls.ConnectionState{Version: tls.VersionTLS12, TLSUnique: []byte{1, 2, 3}})
+
+	_, ir, err := m.Start()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	exp := "y,,n=user,r=fyko+d2lbbFgONRv9qkxdawL"
+	if string(ir) != exp {
+		t.Errorf("expected: %s, got: %s", exp, ir)
+	}
+
+	resp, err := m.Next([]byte("r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// base64("y,,")
+	expPrefix := "c=eSws,"
+	if string(resp[:len(expPrefix)]) != expPrefix {
+		t.Errorf("expected prefix: %s, got: %s", expPrefix, resp)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"io"
+
+	"github.com/gozeloglu/gop-3/pop3"
+)
+
+// ErrAuthFailed is returned by Backend when the credentials
+// are wrong. It is sent to the client with [AUTH] response
+// code.
+var ErrAuthFailed = errors.New("invalid username or password")
+
+// Backend authenticates the users and opens their mailboxes.
+// The errors which wrap a pop3.ResponseCode, such as
+// pop3.ErrSysTemp, are sent with that response code.
+type Backend interface {
+	// Login checks the credentials and returns the mailbox of
+	// the user. It returns ErrAuthFailed if the credentials
+	// are wrong.
+	Login(username, password string) (Mailbox, error)
+}
+
+// APOPBackend is implemented by the backends which support
+// APOP command. Such backends must know the shared secret of
+// the users.
+type APOPBackend interface {
+	Backend
+
+	// LoginAPOP checks the digest of the user and returns the
+	// mailbox. The digest is the MD5 of timestamp and the
+	// shared secret in lowercase hex. It returns ErrAuthFailed
+	// if the digest is wrong.
+	LoginAPOP(username, timestamp, digest string) (Mailbox, error)
+}
+
+// Mailbox is the maildrop of a user. The server locks the
+// maildrop of the user while a session uses it, so a Mailbox
+// is not used by more than one session at a time. The
+// messages are numbered from 1 in the order of List, and the
+// numbers do not change during the session.
+type Mailbox interface {
+	// List returns the number and the size of every message.
+	// It is called once after the login. The size is counted
+	// with CRLF line endings.
+	List() ([]pop3.MessageInfo, error)
+
+	// Uidl returns the unique-id of every message.
+	Uidl() ([]pop3.UniqueID, error)
+
+	// Retr opens the message with the given number. Either LF
+	// or CRLF line endings can be used.
+	Retr(num int) (io.ReadCloser, error)
+
+	// Delete removes the messages with the given numbers. It is
+	// called in UPDATE state after QUIT command, only if the
+	// client marked messages as deleted.
+	Delete(nums []int) error
+
+	// Close releases the mailbox. It is called at the end of
+	// the session, even if the client disconnects without
+	// QUIT.
+	Close() error
+}
+
+// ReadOnlyMailbox is implemented by the mailboxes which cannot
+// delete messages. If ReadOnly returns true, DELE command is
+// refused with [SYS/PERM] response code, so the client learns
+// it before QUIT.
+type ReadOnlyMailbox interface {
+	Mailbox
+
+	// ReadOnly reports whether the messages cannot be deleted.
+	ReadOnly() bool
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Login is the result of a successful authentication.
+type Login struct {
+	// Username is the authenticated user. The maildrop of the
+	// user is locked during the session.
+	Username string
+
+	// Mailbox is the maildrop of the user.
+	Mailbox Mailbox
+}
+
+// SASLServer is the server side of a SASL mechanism.
+type SASLServer interface {
+	// Next handles the response of the client. The first call
+	// gets the initial response, which is <nil> if the client
+	// sends none. It returns the next challenge, or the login
+	// when the exchange is done.
+	Next(response []byte) (challenge []byte, login *Login, err error)
+}
+
+// SASLFactory creates the server side of a SASL mechanism
+// for an AUTH command.
+type SASLFactory func(b Backend) SASLServer
+
+// defaultSASL keeps the mechanisms which are used if
+// Server.SASL is <nil>.
+var defaultSASL = map[string]SASLFactory{
+	"PLAIN": NewPlainServer,
+	"LOGIN": NewLoginServer,
+}
+
+// errMalformedResponse is returned for invalid SASL responses.
+var errMalformedResponse = errors.New("malformed SASL response")
+
+// plainServer is the server side of PLAIN mechanism.
+type plainServer struct {
+	b Backend
+}
+
+// NewPlainServer returns the server side of PLAIN mechanism
+// (RFC 4616). The authorization identity must be empty or
+// the same as the username.
+//
+// b Backend - backend which checks the credentials.
+func NewPlainServer(b Backend) SASLServer {
+	return &plainServer{b: b}
+}
+
+// Next checks the credentials in the response.
+func (p *plainServer) Next(response []byte) ([]byte, *Login, error) {
+	if response == nil {
+		return []byte{}, nil, nil
+	}
+	parts := bytes.Split(response, []byte{0})
+	if len(parts) != 3 {
+		return nil, nil, errMalformedResponse
+	}
+	identity, username, password := string(parts[0]), string(parts[1]), string(parts[2])
+	if identity != "" && identity != username {
+		return nil, nil, ErrAuthFailed
+	}
+	mb, err := p.b.Login(username, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, &Login{Username: username, Mailbox: mb}, nil
+}
+
+// loginServer is the server side of LOGIN mechanism.
+type loginServer struct {
+	b        Backend
+	step     int
+	username string
+}
+
+// NewLoginServer returns the server side of LOGIN mechanism.
+// An initial response is used as the username.
+//
+// b Backend - backend which checks the credentials.
+func NewLoginServer(b Backend) SASLServer {
+	return &loginServer{b: b}
+}
+
+// Next asks for the username and the password and checks
+// them.
+func (l *loginServer) Next(response []byte) ([]byte, *Login, error) {
+	switch l.step {
+	case 0:
+		l.step++
+		if response == nil {
+			return []byte("Username:"), nil, nil
+		}
+		fallthrough
+	case 1:
+		l.step = 2
+		l.username = string(response)
+		return []byte("Password:"), nil, nil
+	case 2:
+		l.step++
+		mb, err := l.b.Login(l.username, string(response))
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &Login{Username: l.username, Mailbox: mb}, nil
+	}
+	return nil, nil, errMalformedResponse
+}
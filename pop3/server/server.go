@@ -0,0 +1,280 @@
+// Package server implements a POP3 server (RFC 1939) with
+// CAPA (RFC 2449), UIDL, TOP, STLS (RFC 2595) and SASL AUTH
+// (RFC 5034) commands. The mailboxes are provided by a
+// Backend. It shares the message and response code types
+// with the pop3 client package, so both ends of the protocol
+// speak the same language.
+//
+// Example:
+// 		s := &server.Server{
+// 			Backend:   backend,
+// 			TLSConfig: tlsConfig,
+// 		}
+// 		log.Fatal(s.ListenAndServe(":110"))
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve, ListenAndServe and
+// ListenAndServeTLS after Close is called.
+var ErrServerClosed = errors.New("pop3 server: server closed")
+
+// DefaultIdleTimeout is the autologout timer of RFC 1939.
+const DefaultIdleTimeout = 10 * time.Minute
+
+// Server is a POP3 server. The fields must not be changed
+// after serving is started.
+type Server struct {
+	// Backend authenticates the users and opens their
+	// mailboxes. APOP command is supported if it implements
+	// APOPBackend.
+	Backend Backend
+
+	// TLSConfig is used by ListenAndServeTLS and enables STLS
+	// command on the plaintext connections.
+	TLSConfig *tls.Config
+
+	// AllowInsecureAuth allows USER, PASS and AUTH commands
+	// on the plaintext connections. Otherwise, the clients
+	// must upgrade the connection with STLS first (RFC 2595).
+	// APOP is always allowed because it does not reveal the
+	// password.
+	AllowInsecureAuth bool
+
+	// Hostname is used in the APOP timestamp of the greeting.
+	// If it is empty, the hostname of the machine is used.
+	Hostname string
+
+	// Implementation is announced with IMPLEMENTATION
+	// capability. If it is empty, the capability is not sent.
+	Implementation string
+
+	// SASL keeps the SASL mechanisms of AUTH command by name,
+	// e.g. "PLAIN". If it is <nil>, PLAIN and LOGIN are
+	// supported.
+	SASL map[string]SASLFactory
+
+	// IdleTimeout closes the sessions which send no command
+	// in the given duration. If it is zero,
+	// DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	// WriteTimeout is the timeout of writing a response. Zero
+	// means no timeout.
+	WriteTimeout time.Duration
+
+	// ErrorLog logs the backend and connection errors. If it
+	// is <nil>, the standard logger is used.
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	locks     map[string]struct{}
+	wg        sync.WaitGroup
+	closed    bool
+}
+
+// ListenAndServe listens on the TCP address and serves the
+// plaintext connections.
+//
+// addr string - address to listen, e.g. ":110"
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// ListenAndServeTLS listens on the TCP address and serves the
+// implicit TLS connections with TLSConfig.
+//
+// addr string - address to listen, e.g. ":995"
+func (s *Server) ListenAndServeTLS(addr string) error {
+	if s.TLSConfig == nil {
+		return errors.New("pop3 server: TLSConfig is required")
+	}
+	l, err := tls.Listen("tcp", addr, s.TLSConfig)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts the connections on the listener and serves
+// each of them in a new goroutine. The listener is closed
+// when Serve returns. If the listener returns *tls.Conn, the
+// connections are implicit TLS.
+//
+// l net.Listener - listener of the server.
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	if !s.track(l, nil) {
+		return ErrServerClosed
+	}
+	defer s.untrack(l, nil)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a POP3 session on the connection until the
+// client quits or the connection is closed. The connection is
+// closed when it returns.
+//
+// conn net.Conn - connection of the client.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	if !s.track(nil, conn) {
+		return
+	}
+	defer s.untrack(nil, conn)
+
+	_, encrypted := conn.(*tls.Conn)
+	ses := newSession(s, conn, encrypted)
+	ses.serve()
+}
+
+// Close closes the listeners and the connections, and waits
+// for the sessions to release their mailboxes. The mailboxes
+// are not updated for the sessions which did not quit.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// track adds the listener or the connection to the server.
+// It returns false if the server is closed.
+func (s *Server) track(l net.Listener, conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if l != nil {
+		if s.listeners == nil {
+			s.listeners = make(map[net.Listener]struct{})
+		}
+		s.listeners[l] = struct{}{}
+	}
+	if conn != nil {
+		if s.conns == nil {
+			s.conns = make(map[net.Conn]struct{})
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+	}
+	return true
+}
+
+// untrack removes the listener or the connection.
+func (s *Server) untrack(l net.Listener, conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l != nil {
+		delete(s.listeners, l)
+	}
+	if conn != nil {
+		delete(s.conns, conn)
+		s.wg.Done()
+	}
+}
+
+// isClosed reports whether Close is called.
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// lock locks the maildrop of the user. It returns false if
+// another session holds the lock.
+func (s *Server) lock(username string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, locked := s.locks[username]; locked {
+		return false
+	}
+	if s.locks == nil {
+		s.locks = make(map[string]struct{})
+	}
+	s.locks[username] = struct{}{}
+	return true
+}
+
+// unlock releases the maildrop of the user.
+func (s *Server) unlock(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locks, username)
+}
+
+// logf logs the error.
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// hostname returns the host of the APOP timestamp.
+func (s *Server) hostname() string {
+	if s.Hostname != "" {
+		return s.Hostname
+	}
+	if h, err := os.Hostname(); err == nil {
+		return h
+	}
+	return "localhost"
+}
+
+// idleTimeout returns the autologout timer.
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+// sasl returns the SASL mechanisms.
+func (s *Server) sasl() map[string]SASLFactory {
+	if s.SASL != nil {
+		return s.SASL
+	}
+	return defaultSASL
+}
@@ -0,0 +1,475 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/sasl"
+)
+
+const (
+	testUser     = "user@example.com"
+	testPassword = "secret"
+)
+
+// memBackend keeps the mailboxes in memory.
+type memBackend struct {
+	mu       sync.Mutex
+	password map[string]string
+	messages map[string][]string
+	closed   int
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{
+		password: map[string]string{testUser: testPassword},
+		messages: map[string][]string{testUser: {
+			"Subject: one\n\nfirst\n.dot\n",
+			"Subject: two\r\n\r\nsecond\r\nthird\r\n",
+		}},
+	}
+}
+
+func (b *memBackend) Login(username, password string) (Mailbox, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p, ok := b.password[username]; !ok || p != password {
+		return nil, ErrAuthFailed
+	}
+	return &memMailbox{b: b, user: username, msgs: b.messages[username]}, nil
+}
+
+func (b *memBackend) LoginAPOP(username, timestamp, digest string) (Mailbox, error) {
+	b.mu.Lock()
+	p := b.password[username]
+	b.mu.Unlock()
+	sum := md5.Sum([]byte(timestamp + p))
+	if hex.EncodeToString(sum[:]) != digest {
+		return nil, ErrAuthFailed
+	}
+	return b.Login(username, p)
+}
+
+// memMailbox is the snapshot of the messages at the login.
+type memMailbox struct {
+	b    *memBackend
+	user string
+	msgs []string
+}
+
+func (m *memMailbox) List() ([]pop3.MessageInfo, error) {
+	var infos []pop3.MessageInfo
+	for i, msg := range m.msgs {
+		size := len(strings.ReplaceAll(strings.ReplaceAll(msg, "\r\n", "\n"), "\n", "\r\n"))
+		infos = append(infos, pop3.MessageInfo{Num: i + 1, Size: size})
+	}
+	return infos, nil
+}
+
+func (m *memMailbox) Uidl() ([]pop3.UniqueID, error) {
+	var ids []pop3.UniqueID
+	for i := range m.msgs {
+		ids = append(ids, pop3.UniqueID{Num: i + 1, UID: fmt.Sprintf("uid-%d", i+1)})
+	}
+	return ids, nil
+}
+
+func (m *memMailbox) Retr(num int) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(m.msgs[num-1])), nil
+}
+
+func (m *memMailbox) Delete(nums []int) error {
+	deleted := make(map[int]bool)
+	for _, n := range nums {
+		deleted[n] = true
+	}
+	var kept []string
+	for i, msg := range m.msgs {
+		if !deleted[i+1] {
+			kept = append(kept, msg)
+		}
+	}
+	m.b.mu.Lock()
+	m.b.messages[m.user] = kept
+	m.b.mu.Unlock()
+	return nil
+}
+
+func (m *memMailbox) Close() error {
+	m.b.mu.Lock()
+	m.b.closed++
+	m.b.mu.Unlock()
+	return nil
+}
+
+// testCert returns the server and the client TLS
+// configurations with a self-signed certificate.
+func testCert(t *testing.T) (*tls.Config, *tls.Config) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+// startServer serves s on a loopback address and closes it at
+// the end of the test.
+func startServer(t *testing.T, s *Server) string {
+	if s.ErrorLog == nil {
+		s.ErrorLog = log.New(ioutil.Discard, "", 0)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("expected ErrServerClosed, got: %v", err)
+		}
+	})
+	return l.Addr().String()
+}
+
+func login(t *testing.T, addr string) *pop3.Client {
+	c, err := pop3.Connect(addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = c.User(testUser); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = c.Pass(testPassword); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return c
+}
+
+func TestServer_Transaction(t *testing.T) {
+	b := newMemBackend()
+	addr := startServer(t, &Server{Backend: b, AllowInsecureAuth: true})
+	c := login(t, addr)
+
+	stat, err := c.StatInfo()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if stat.Count != 2 || stat.Size != 60 {
+		t.Errorf("unexpected STAT: %+v", stat)
+	}
+	list, err := c.ListAll()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expList := []pop3.MessageInfo{{Num: 1, Size: 29}, {Num: 2, Size: 31}}
+	if !reflect.DeepEqual(list, expList) {
+		t.Errorf("expected: %v, got: %v", expList, list)
+	}
+	msg, err := c.Retr("1")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if exp := []string{"Subject: one", "", "first", ".dot"}; !reflect.DeepEqual(msg[1:], exp) {
+		t.Errorf("expected: %q, got: %q", exp, msg)
+	}
+	top, err := c.Top(2, 1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if exp := []string{"Subject: two", "", "second"}; !reflect.DeepEqual(top[1:], exp) {
+		t.Errorf("expected: %q, got: %q", exp, top)
+	}
+	ids, err := c.Uidl()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(ids) != 2 || ids[1].UID != "uid-2" {
+		t.Errorf("unexpected UIDL: %v", ids)
+	}
+
+	if _, err = c.Dele("1"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = c.Retr("1"); err == nil {
+		t.Errorf("expected error for deleted message")
+	}
+	if _, err = c.Rset(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = c.Dele("2"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = c.Quit(); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	c = login(t, addr)
+	defer c.Quit()
+	if stat, _ = c.StatInfo(); stat.Count != 1 || stat.Size != 29 {
+		t.Errorf("deletion must be committed on QUIT, got: %+v", stat)
+	}
+}
+
+func TestServer_NoDeletionWithoutQuit(t *testing.T) {
+	b := newMemBackend()
+	s := &Server{Backend: b, AllowInsecureAuth: true}
+	addr := startServer(t, s)
+	c := login(t, addr)
+	if _, err := c.Dele("1"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	s.Close()
+
+	if n := len(b.messages[testUser]); n != 2 {
+		t.Errorf("expected 2 messages, got: %d", n)
+	}
+	if b.closed != 1 {
+		t.Errorf("mailbox must be closed once, got: %d", b.closed)
+	}
+}
+
+func TestServer_MaildropLocked(t *testing.T) {
+	addr := startServer(t, &Server{Backend: newMemBackend(), AllowInsecureAuth: true})
+	c := login(t, addr)
+	defer c.Quit()
+
+	c2, err := pop3.Connect(addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2.User(testUser)
+	if _, err = c2.Pass(testPassword); !errors.Is(err, pop3.ErrInUse) {
+		t.Errorf("expected ErrInUse, got: %v", err)
+	}
+}
+
+func TestServer_WrongPassword(t *testing.T) {
+	addr := startServer(t, &Server{Backend: newMemBackend(), AllowInsecureAuth: true})
+	c, err := pop3.Connect(addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c.User(testUser)
+	if _, err = c.Pass("wrong"); !errors.Is(err, pop3.ErrAuth) {
+		t.Errorf("expected ErrAuth, got: %v", err)
+	}
+}
+
+func TestServer_Auth(t *testing.T) {
+	addr := startServer(t, &Server{Backend: newMemBackend(), AllowInsecureAuth: true})
+	for _, mech := range []sasl.Mechanism{
+		sasl.NewPlainClient("", testUser, testPassword),
+		sasl.NewLoginClient(testUser, testPassword),
+	} {
+		c, err := pop3.Connect(addr, nil, false)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err = c.Capa(); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err = c.Auth(mech); err != nil {
+			t.Errorf(err.Error())
+		}
+		c.Quit()
+	}
+}
+
+func TestServer_Apop(t *testing.T) {
+	addr := startServer(t, &Server{Backend: newMemBackend(), Hostname: "example.com"})
+	c, err := pop3.Connect(addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer c.Quit()
+	if !strings.HasSuffix(c.GreetingMsg(), "@example.com>") {
+		t.Errorf("expected APOP timestamp, got: %s", c.GreetingMsg())
+	}
+	if _, err = c.Apop(testUser, testPassword); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestServer_InsecureAuthRefused(t *testing.T) {
+	addr := startServer(t, &Server{Backend: newMemBackend()})
+	c, err := pop3.Connect(addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	caps, err := c.Capa()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if caps.User || len(caps.SASL) > 0 {
+		t.Errorf("USER and SASL must not be announced: %v", caps.Lines())
+	}
+	if _, err = c.User(testUser); err == nil {
+		t.Errorf("expected error for USER on plaintext connection")
+	}
+}
+
+func TestServer_StartTLS(t *testing.T) {
+	serverConf, clientConf := testCert(t)
+	addr := startServer(t, &Server{Backend: newMemBackend(), TLSConfig: serverConf})
+	c, err := pop3.ConnectStartTLS(addr, clientConf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer c.Quit()
+	if !c.IsEncrypted() {
+		t.Errorf("expected encrypted connection")
+	}
+	caps, err := c.Capa()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if caps.STLS || !caps.User {
+		t.Errorf("unexpected capabilities after STLS: %v", caps.Lines())
+	}
+	if _, err = c.User(testUser); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = c.Pass(testPassword); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestServer_ImplicitTLS(t *testing.T) {
+	serverConf, clientConf := testCert(t)
+	s := &Server{Backend: newMemBackend(), TLSConfig: serverConf, ErrorLog: log.New(ioutil.Discard, "", 0)}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	c, err := pop3.Connect(l.Addr().String(), clientConf, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer c.Quit()
+	if _, err = c.User(testUser); err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	addr := startServer(t, &Server{Backend: newMemBackend(), AllowInsecureAuth: true})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	r.ReadString('\n')
+
+	conn.Write([]byte("USER " + testUser + "\r\nPASS " + testPassword + "\r\nSTAT\r\nDELE 9\r\nQUIT\r\n"))
+	expected := []string{"+OK", "+OK", "+OK 2 60", "-ERR no such message", "+OK"}
+	for _, exp := range expected {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !strings.HasPrefix(l, exp) {
+			t.Errorf("expected: %s, got: %s", exp, l)
+		}
+	}
+}
+
+func TestServer_RetrSize(t *testing.T) {
+	b := newMemBackend()
+	b.messages[testUser] = []string{"Subject: cr\r\r\n\r\nbody\r\r\n"}
+	addr := startServer(t, &Server{Backend: b, AllowInsecureAuth: true})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	r.ReadString('\n')
+
+	conn.Write([]byte("USER " + testUser + "\r\nPASS " + testPassword + "\r\nLIST 1\r\nRETR 1\r\n"))
+	var list string
+	for i := 0; i < 3; i++ {
+		if list, err = r.ReadString('\n'); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	r.ReadString('\n')
+	var msg string
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if l == ".\r\n" {
+			break
+		}
+		msg += l
+	}
+	if exp := fmt.Sprintf("+OK 1 %d\r\n", len(msg)); list != exp {
+		t.Errorf("expected: %q, got: %q for %q", exp, list, msg)
+	}
+}
+
+func TestServer_BackendResponseCode(t *testing.T) {
+	b := backendFunc(func(username, password string) (Mailbox, error) {
+		return nil, fmt.Errorf("%w: mail store is down", pop3.ErrSysTemp)
+	})
+	addr := startServer(t, &Server{Backend: b, AllowInsecureAuth: true})
+	c, err := pop3.Connect(addr, nil, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c.User(testUser)
+	_, err = c.Pass(testPassword)
+	var se *pop3.ServerError
+	if !errors.As(err, &se) || se.Code != "SYS/TEMP" || se.Text != "mail store is down" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// backendFunc is a Backend of a function.
+type backendFunc func(username, password string) (Mailbox, error)
+
+func (f backendFunc) Login(username, password string) (Mailbox, error) {
+	return f(username, password)
+}
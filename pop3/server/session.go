@@ -0,0 +1,653 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+)
+
+// maxLineLength is the maximum length of a command or an AUTH
+// response line. RFC 2449 limits the commands to 255 octets,
+// but the SASL responses may be longer.
+const maxLineLength = 16 * 1024
+
+// errQuit ends the session after QUIT command.
+var errQuit = errors.New("quit")
+
+// errLineTooLong ends the session when the client sends a too
+// long line.
+var errLineTooLong = errors.New("line too long")
+
+// session is a client session of the server.
+type session struct {
+	s         *Server
+	conn      net.Conn
+	r         *bufio.Reader
+	w         *bufio.Writer
+	encrypted bool
+	state     pop3.State
+
+	// user is the argument of USER command.
+	user string
+
+	// timestamp is the APOP timestamp of the greeting.
+	timestamp string
+
+	// login is the authenticated user and the mailbox.
+	login *Login
+
+	// msgs keeps the messages of the maildrop at the login.
+	msgs []pop3.MessageInfo
+
+	// deleted keeps the message numbers which are marked as
+	// deleted.
+	deleted map[int]bool
+}
+
+// newSession creates the session on the connection.
+func newSession(s *Server, conn net.Conn, encrypted bool) *session {
+	return &session{
+		s:         s,
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		w:         bufio.NewWriter(conn),
+		encrypted: encrypted,
+		state:     pop3.StateAuthorization,
+	}
+}
+
+// serve sends the greeting and handles the commands until
+// QUIT or the connection is closed.
+func (ses *session) serve() {
+	defer ses.release()
+
+	greeting := "+OK POP3 server ready"
+	if _, ok := ses.s.Backend.(APOPBackend); ok {
+		ses.timestamp = fmt.Sprintf("<%d.%d@%s>", os.Getpid(), time.Now().UnixNano(), ses.s.hostname())
+		greeting += " " + ses.timestamp
+	}
+	if err := ses.writeLine(greeting); err != nil {
+		return
+	}
+	for {
+		// The responses of the pipelined commands are sent
+		// together (RFC 2449).
+		if ses.r.Buffered() == 0 {
+			if err := ses.flush(); err != nil {
+				return
+			}
+		}
+		line, err := ses.readLine()
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				ses.writeLine("-ERR line too long")
+				ses.flush()
+			}
+			return
+		}
+
+		cmd, args := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, args = line[:i], line[i+1:]
+		}
+		if err = ses.exec(strings.ToUpper(cmd), args); err != nil {
+			if !errors.Is(err, errQuit) && !isClosed(err) {
+				ses.s.logf("pop3 server: %s: %v", ses.conn.RemoteAddr(), err)
+			}
+			ses.flush()
+			return
+		}
+	}
+}
+
+// release closes the mailbox and unlocks the maildrop.
+func (ses *session) release() {
+	if ses.login == nil {
+		return
+	}
+	if err := ses.login.Mailbox.Close(); err != nil {
+		ses.s.logf("pop3 server: closing mailbox of %s: %v", ses.login.Username, err)
+	}
+	ses.s.unlock(ses.login.Username)
+	ses.login = nil
+}
+
+// isClosed reports whether the error is caused by the closed
+// connection.
+func isClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
+// readLine reads a line from the client without CRLF. The
+// idle timer is reset before reading.
+func (ses *session) readLine() (string, error) {
+	ses.conn.SetReadDeadline(time.Now().Add(ses.s.idleTimeout()))
+	var b []byte
+	for {
+		l, isPrefix, err := ses.r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		b = append(b, l...)
+		if len(b) > maxLineLength {
+			return "", errLineTooLong
+		}
+		if !isPrefix {
+			return string(b), nil
+		}
+	}
+}
+
+// writeLine writes the line with CRLF to the buffer.
+func (ses *session) writeLine(line string) error {
+	_, err := ses.w.WriteString(line + "\r\n")
+	return err
+}
+
+// flush sends the buffered responses to the client.
+func (ses *session) flush() error {
+	if ses.s.WriteTimeout > 0 {
+		ses.conn.SetWriteDeadline(time.Now().Add(ses.s.WriteTimeout))
+	}
+	return ses.w.Flush()
+}
+
+// writeMulti writes the multi-line response. The lines are
+// dot-stuffed and the termination line is added.
+func (ses *session) writeMulti(status string, lines []string) error {
+	if err := ses.writeLine(status); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if strings.HasPrefix(l, ".") {
+			l = "." + l
+		}
+		if err := ses.writeLine(l); err != nil {
+			return err
+		}
+	}
+	return ses.writeLine(".")
+}
+
+// writeErr writes the negative response with the response
+// code.
+//
+// code pop3.ResponseCode - response code, or "" for none.
+// text string - human readable text.
+func (ses *session) writeErr(code pop3.ResponseCode, text string) error {
+	if code != "" {
+		text = code.Error() + " " + text
+	}
+	return ses.writeLine("-ERR " + text)
+}
+
+// writeBackendErr writes the negative response for the backend
+// error. ErrAuthFailed is sent with [AUTH] code and the errors
+// which wrap a pop3.ResponseCode are sent with that code. The
+// other errors are logged and sent as [SYS/TEMP] without their
+// text.
+func (ses *session) writeBackendErr(err error) error {
+	if errors.Is(err, ErrAuthFailed) {
+		return ses.writeErr(pop3.ErrAuth, ErrAuthFailed.Error())
+	}
+	var rc pop3.ResponseCode
+	if errors.As(err, &rc) {
+		text := strings.TrimSpace(strings.Replace(err.Error(), rc.Error(), "", 1))
+		text = strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(text, ":"), ":"))
+		if text == "" {
+			text = "command failed"
+		}
+		return ses.writeErr(rc, text)
+	}
+	ses.s.logf("pop3 server: %s: %v", ses.conn.RemoteAddr(), err)
+	return ses.writeErr(pop3.ErrSysTemp, "internal server error")
+}
+
+// exec executes the command in the current state.
+func (ses *session) exec(cmd, args string) error {
+	switch cmd {
+	case "CAPA":
+		return ses.writeMulti("+OK Capability list follows", ses.capabilities())
+	case "QUIT":
+		return ses.quit()
+	}
+
+	if ses.state == pop3.StateAuthorization {
+		switch cmd {
+		case "USER":
+			return ses.userCmd(args)
+		case "PASS":
+			return ses.pass(args)
+		case "APOP":
+			return ses.apop(args)
+		case "AUTH":
+			return ses.auth(args)
+		case "STLS":
+			return ses.stls()
+		case "STAT", "LIST", "RETR", "DELE", "NOOP", "RSET", "TOP", "UIDL":
+			return ses.writeLine("-ERR command not valid in this state")
+		}
+		return ses.writeLine("-ERR unknown command")
+	}
+
+	switch cmd {
+	case "STAT":
+		n, size := ses.stat()
+		return ses.writeLine(fmt.Sprintf("+OK %d %d", n, size))
+	case "LIST":
+		return ses.list(args)
+	case "RETR":
+		return ses.retr(args)
+	case "TOP":
+		return ses.top(args)
+	case "DELE":
+		return ses.dele(args)
+	case "NOOP":
+		return ses.writeLine("+OK")
+	case "RSET":
+		ses.deleted = nil
+		n, size := ses.stat()
+		return ses.writeLine(fmt.Sprintf("+OK maildrop has %d messages (%d octets)", n, size))
+	case "UIDL":
+		return ses.uidl(args)
+	case "USER", "PASS", "APOP", "AUTH", "STLS":
+		return ses.writeLine("-ERR command not valid in this state")
+	}
+	return ses.writeLine("-ERR unknown command")
+}
+
+// authAllowed reports whether the credentials can be sent on
+// the connection.
+func (ses *session) authAllowed() bool {
+	return ses.encrypted || ses.s.AllowInsecureAuth
+}
+
+// capabilities returns the lines of CAPA response.
+func (ses *session) capabilities() []string {
+	caps := pop3.Capabilities{
+		Top:            true,
+		UIDL:           true,
+		Pipelining:     true,
+		RespCodes:      true,
+		AuthRespCode:   true,
+		Implementation: ses.s.Implementation,
+	}
+	if ses.state == pop3.StateAuthorization {
+		if ses.authAllowed() {
+			caps.User = true
+			for name := range ses.s.sasl() {
+				caps.SASL = append(caps.SASL, name)
+			}
+			sort.Strings(caps.SASL)
+		}
+		caps.STLS = ses.s.TLSConfig != nil && !ses.encrypted
+	}
+	return caps.Lines()
+}
+
+// quit ends the session. The deleted messages are removed in
+// UPDATE state if the client is logged in.
+func (ses *session) quit() error {
+	if ses.state != pop3.StateTransaction {
+		ses.writeLine("+OK POP3 server signing off")
+		return errQuit
+	}
+
+	ses.state = pop3.StateUpdate
+	if len(ses.deleted) > 0 {
+		nums := make([]int, 0, len(ses.deleted))
+		for num := range ses.deleted {
+			nums = append(nums, num)
+		}
+		sort.Ints(nums)
+		if err := ses.login.Mailbox.Delete(nums); err != nil {
+			ses.s.logf("pop3 server: deleting messages of %s: %v", ses.login.Username, err)
+			code := pop3.ErrSysTemp
+			errors.As(err, &code)
+			ses.writeErr(code, "some deleted messages not removed")
+			return errQuit
+		}
+	}
+	n, _ := ses.stat()
+	ses.writeLine(fmt.Sprintf("+OK POP3 server signing off (%d messages left)", n))
+	return errQuit
+}
+
+// userCmd keeps the username for PASS command.
+func (ses *session) userCmd(args string) error {
+	if !ses.authAllowed() {
+		return ses.writeLine("-ERR plaintext authentication is disabled, use STLS")
+	}
+	if args == "" {
+		return ses.writeLine("-ERR missing username")
+	}
+	ses.user = args
+	return ses.writeLine("+OK send PASS")
+}
+
+// pass checks the password of the user of USER command.
+func (ses *session) pass(password string) error {
+	if !ses.authAllowed() {
+		return ses.writeLine("-ERR plaintext authentication is disabled, use STLS")
+	}
+	if ses.user == "" {
+		return ses.writeLine("-ERR send USER first")
+	}
+	user := ses.user
+	ses.user = ""
+	mb, err := ses.s.Backend.Login(user, password)
+	if err != nil {
+		return ses.writeBackendErr(err)
+	}
+	return ses.open(&Login{Username: user, Mailbox: mb})
+}
+
+// apop checks the digest of the user.
+func (ses *session) apop(args string) error {
+	b, ok := ses.s.Backend.(APOPBackend)
+	if !ok {
+		return ses.writeLine("-ERR APOP is not supported")
+	}
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return ses.writeLine("-ERR invalid arguments")
+	}
+	mb, err := b.LoginAPOP(fields[0], ses.timestamp, strings.ToLower(fields[1]))
+	if err != nil {
+		return ses.writeBackendErr(err)
+	}
+	return ses.open(&Login{Username: fields[0], Mailbox: mb})
+}
+
+// auth authenticates with a SASL mechanism (RFC 5034). AUTH
+// without arguments lists the mechanisms.
+func (ses *session) auth(args string) error {
+	if !ses.authAllowed() {
+		return ses.writeLine("-ERR plaintext authentication is disabled, use STLS")
+	}
+	mechs := ses.s.sasl()
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		names := make([]string, 0, len(mechs))
+		for name := range mechs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return ses.writeMulti("+OK", names)
+	}
+	if len(fields) > 2 {
+		return ses.writeLine("-ERR invalid arguments")
+	}
+	factory, ok := mechs[strings.ToUpper(fields[0])]
+	if !ok {
+		return ses.writeLine("-ERR unsupported SASL mechanism")
+	}
+
+	var resp []byte
+	if len(fields) == 2 {
+		var err error
+		if resp, err = decodeSASL(fields[1]); err != nil {
+			return ses.writeLine("-ERR invalid base64 response")
+		}
+	}
+	srv := factory(ses.s.Backend)
+	for {
+		challenge, login, err := srv.Next(resp)
+		if err != nil {
+			if errors.Is(err, errMalformedResponse) {
+				return ses.writeLine("-ERR " + err.Error())
+			}
+			return ses.writeBackendErr(err)
+		}
+		if login != nil {
+			return ses.open(login)
+		}
+
+		if err = ses.writeLine("+ " + base64.StdEncoding.EncodeToString(challenge)); err != nil {
+			return err
+		}
+		if err = ses.flush(); err != nil {
+			return err
+		}
+		line, err := ses.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "*" {
+			return ses.writeLine("-ERR authentication cancelled")
+		}
+		if resp, err = base64.StdEncoding.DecodeString(line); err != nil {
+			return ses.writeLine("-ERR invalid base64 response")
+		}
+	}
+}
+
+// decodeSASL decodes the initial response. "=" is the empty
+// response.
+func decodeSASL(ir string) ([]byte, error) {
+	if ir == "=" {
+		return []byte{}, nil
+	}
+	return base64.StdEncoding.DecodeString(ir)
+}
+
+// open locks the maildrop after the successful authentication
+// and enters TRANSACTION state.
+func (ses *session) open(login *Login) error {
+	if !ses.s.lock(login.Username) {
+		login.Mailbox.Close()
+		return ses.writeErr(pop3.ErrInUse, "maildrop already locked")
+	}
+	msgs, err := login.Mailbox.List()
+	if err != nil {
+		login.Mailbox.Close()
+		ses.s.unlock(login.Username)
+		return ses.writeBackendErr(err)
+	}
+	ses.login = login
+	ses.msgs = msgs
+	ses.deleted = nil
+	ses.state = pop3.StateTransaction
+	n, size := ses.stat()
+	return ses.writeLine(fmt.Sprintf("+OK maildrop has %d messages (%d octets)", n, size))
+}
+
+// stls upgrades the connection to TLS (RFC 2595).
+func (ses *session) stls() error {
+	if ses.s.TLSConfig == nil || ses.encrypted {
+		return ses.writeLine("-ERR command not permitted")
+	}
+	if err := ses.writeLine("+OK begin TLS negotiation"); err != nil {
+		return err
+	}
+	if err := ses.flush(); err != nil {
+		return err
+	}
+	tlsConn := tls.Server(ses.conn, ses.s.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	ses.conn = tlsConn
+	ses.r = bufio.NewReader(tlsConn)
+	ses.w = bufio.NewWriter(tlsConn)
+	ses.encrypted = true
+	ses.user = ""
+	return nil
+}
+
+// stat returns the number and the total size of the messages
+// which are not deleted.
+func (ses *session) stat() (int, int) {
+	n, size := 0, 0
+	for _, m := range ses.msgs {
+		if !ses.deleted[m.Num] {
+			n++
+			size += m.Size
+		}
+	}
+	return n, size
+}
+
+// message returns the message with the number in the argument.
+// It writes the negative response and returns false if the
+// message does not exist or is deleted.
+func (ses *session) message(arg string) (pop3.MessageInfo, bool, error) {
+	num, err := strconv.Atoi(arg)
+	if err != nil || num < 1 || num > len(ses.msgs) {
+		return pop3.MessageInfo{}, false, ses.writeLine("-ERR no such message")
+	}
+	if ses.deleted[num] {
+		return pop3.MessageInfo{}, false, ses.writeLine(fmt.Sprintf("-ERR message %d already deleted", num))
+	}
+	return ses.msgs[num-1], true, nil
+}
+
+// list lists the size of the messages.
+func (ses *session) list(args string) error {
+	if args != "" {
+		m, ok, err := ses.message(args)
+		if !ok {
+			return err
+		}
+		return ses.writeLine(fmt.Sprintf("+OK %d %d", m.Num, m.Size))
+	}
+	var lines []string
+	for _, m := range ses.msgs {
+		if !ses.deleted[m.Num] {
+			lines = append(lines, fmt.Sprintf("%d %d", m.Num, m.Size))
+		}
+	}
+	n, size := ses.stat()
+	return ses.writeMulti(fmt.Sprintf("+OK %d messages (%d octets)", n, size), lines)
+}
+
+// uidl lists the unique-id of the messages.
+func (ses *session) uidl(args string) error {
+	var m pop3.MessageInfo
+	if args != "" {
+		var ok bool
+		var err error
+		if m, ok, err = ses.message(args); !ok {
+			return err
+		}
+	}
+	ids, err := ses.login.Mailbox.Uidl()
+	if err != nil {
+		return ses.writeBackendErr(err)
+	}
+	if args != "" {
+		for _, id := range ids {
+			if id.Num == m.Num {
+				return ses.writeLine(fmt.Sprintf("+OK %d %s", id.Num, id.UID))
+			}
+		}
+		return ses.writeLine("-ERR no such message")
+	}
+	var lines []string
+	for _, id := range ids {
+		if !ses.deleted[id.Num] {
+			lines = append(lines, fmt.Sprintf("%d %s", id.Num, id.UID))
+		}
+	}
+	return ses.writeMulti("+OK", lines)
+}
+
+// dele marks the message as deleted.
+func (ses *session) dele(args string) error {
+	m, ok, err := ses.message(args)
+	if !ok {
+		return err
+	}
+	if ro, isRO := ses.login.Mailbox.(ReadOnlyMailbox); isRO && ro.ReadOnly() {
+		return ses.writeErr(pop3.ErrSysPerm, "maildrop is read-only")
+	}
+	if ses.deleted == nil {
+		ses.deleted = make(map[int]bool)
+	}
+	ses.deleted[m.Num] = true
+	return ses.writeLine(fmt.Sprintf("+OK message %d deleted", m.Num))
+}
+
+// retr sends the message.
+func (ses *session) retr(args string) error {
+	m, ok, err := ses.message(args)
+	if !ok {
+		return err
+	}
+	return ses.send(m, fmt.Sprintf("+OK %d octets", m.Size), -1)
+}
+
+// top sends the headers and the first lines of the body.
+func (ses *session) top(args string) error {
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return ses.writeLine("-ERR invalid arguments")
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 0 {
+		return ses.writeLine("-ERR invalid number of lines")
+	}
+	m, ok, err := ses.message(fields[0])
+	if !ok {
+		return err
+	}
+	return ses.send(m, "+OK", n)
+}
+
+// send writes the message as a multi-line response. The lines
+// are sent with CRLF and dot-stuffed. If the message cannot
+// be read after the status line, the session is ended because
+// the response cannot be completed.
+//
+// m pop3.MessageInfo - message to send.
+// status string - positive status line.
+// bodyLines int - number of body lines to send, or -1 for the
+// whole message.
+func (ses *session) send(m pop3.MessageInfo, status string, bodyLines int) error {
+	rc, err := ses.login.Mailbox.Retr(m.Num)
+	if err != nil {
+		return ses.writeBackendErr(err)
+	}
+	defer rc.Close()
+	if err = ses.writeLine(status); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(rc)
+	header := true
+	for bodyLines != 0 || header {
+		l, err := r.ReadString('\n')
+		if l == "" && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("reading message %d: %w", m.Num, err)
+		}
+		// Only the line ending is removed; a CR before it is
+		// the part of the line, so the size does not change.
+		l = strings.TrimSuffix(strings.TrimSuffix(l, "\n"), "\r")
+		if header {
+			header = l != ""
+		} else if bodyLines > 0 {
+			bodyLines--
+		}
+		if strings.HasPrefix(l, ".") {
+			l = "." + l
+		}
+		if err := ses.writeLine(l); err != nil {
+			return err
+		}
+	}
+	return ses.writeLine(".")
+}
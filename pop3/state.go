@@ -0,0 +1,72 @@
+package pop3
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrWrongState is returned when a command is called in a
+// state which does not permit it. The command is not sent
+// to the server.
+var ErrWrongState = errors.New("command is not allowed in current state")
+
+// State is the state of the POP3 session which is defined
+// in RFC 1939.
+type State int
+
+const (
+	// StateDisconnected means that there is no connection
+	// with the server. It is the state of Client before
+	// connecting and after QUIT in AUTHORIZATION state.
+	StateDisconnected State = iota
+
+	// StateAuthorization is the state after the greeting
+	// message. The client must authenticate with USER and
+	// PASS, APOP or AUTH commands.
+	StateAuthorization
+
+	// StateTransaction is the state after a successful login.
+	// The maildrop can be accessed in this state.
+	StateTransaction
+
+	// StateUpdate is the state after QUIT in TRANSACTION state.
+	// The server deletes the marked messages and closes the
+	// connection.
+	StateUpdate
+)
+
+// String returns the name of the state as written in RFC 1939.
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "DISCONNECTED"
+	case StateAuthorization:
+		return "AUTHORIZATION"
+	case StateTransaction:
+		return "TRANSACTION"
+	case StateUpdate:
+		return "UPDATE"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// State returns the current state of the session.
+func (c *Client) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// checkState returns ErrWrongState if the session is not
+// in one of the given states.
+//
+// cmd string - command name, e.g. "STAT"
+// states ...State - states which permit the command.
+func (c *Client) checkState(cmd string, states ...State) error {
+	for _, s := range states {
+		if c.state == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s in %s state", ErrWrongState, cmd, c.state)
+}
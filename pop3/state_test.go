@@ -0,0 +1,94 @@
+package pop3_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+func TestState_String(t *testing.T) {
+	states := map[pop3.State]string{
+		pop3.StateDisconnected:  "DISCONNECTED",
+		pop3.StateAuthorization: "AUTHORIZATION",
+		pop3.StateTransaction:   "TRANSACTION",
+		pop3.StateUpdate:        "UPDATE",
+		pop3.State(42):          "State(42)",
+	}
+	for s, exp := range states {
+		if s.String() != exp {
+			t.Errorf("expected: %s, got: %s", exp, s.String())
+		}
+	}
+}
+
+func TestClient_WrongStateNotSent(t *testing.T) {
+	// The script is empty, so any command sent to the
+	// server would fail with closed pipe.
+	pop := pop3test.ScriptClient(t)
+
+	if _, err := pop.Stat(); !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
+	}
+	if _, err := pop.Dele("1"); !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
+	}
+	if _, err := pop.RetrReader(1); !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
+	}
+
+	pop.SetState(pop3.StateTransaction)
+	if _, err := pop.User("user"); !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
+	}
+	if err := pop.StartTLS(nil); !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
+	}
+}
+
+func TestClient_StateTransitions(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "USER mrose", Send: "+OK mrose is a real hoopy frood"},
+		pop3test.Step{Expect: "PASS secret", Send: "+OK mrose's maildrop has 2 messages (320 octets)"},
+		pop3test.Step{Expect: "QUIT", Send: "+OK dewey POP3 server signing off (maildrop empty)"},
+	)
+
+	if pop.State() != pop3.StateAuthorization || pop.IsAuthorized() {
+		t.Errorf("expected AUTHORIZATION state, got: %v", pop.State())
+	}
+	if _, err := pop.User("mrose"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pop.IsAuthorized() {
+		t.Errorf("USER must not authorize the client")
+	}
+	if _, err := pop.Pass("secret"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pop.State() != pop3.StateTransaction || !pop.IsAuthorized() {
+		t.Errorf("expected TRANSACTION state, got: %v", pop.State())
+	}
+	if _, err := pop.Quit(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pop.State() != pop3.StateUpdate || pop.IsAuthorized() {
+		t.Errorf("expected UPDATE state, got: %v", pop.State())
+	}
+	if _, err := pop.Noop(); !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
+	}
+}
+
+func TestClient_QuitInAuthorization(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "QUIT", Send: "+OK bye"},
+	)
+
+	if _, err := pop.Quit(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pop.State() != pop3.StateDisconnected {
+		t.Errorf("expected DISCONNECTED state, got: %v", pop.State())
+	}
+}
@@ -0,0 +1,231 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Record is the sync state of a message.
+type Record struct {
+	// UID is the unique-id of the message.
+	UID string `json:"uid"`
+
+	// Fetched is the time when the message is stored locally.
+	// It is zero while the delivery is pending.
+	Fetched time.Time `json:"fetched,omitempty"`
+
+	// Pending is true from the start of the delivery until it
+	// is checkpointed. A pending record after a crash means
+	// that the delivery may or may not be done.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// Store keeps the sync state of a mailbox. Put and Delete must
+// be durable when they return, because every checkpoint of
+// Syncer is a Put. A Store is used by one Syncer at a time.
+type Store interface {
+	// Get returns the record of the unique-id. It returns false
+	// if the unique-id is not seen.
+	Get(uid string) (Record, bool, error)
+
+	// Put saves the record.
+	Put(rec Record) error
+
+	// Delete forgets the unique-id.
+	Delete(uid string) error
+
+	// UIDs returns every unique-id in the store.
+	UIDs() ([]string, error)
+}
+
+// FileStore keeps the records in a JSON file. Every change
+// rewrites the file atomically, so the file is never partially
+// written. It fits the mailboxes up to several thousands of
+// messages.
+type FileStore struct {
+	path    string
+	records map[string]Record
+}
+
+// OpenFileStore reads the JSON file. A missing file is an
+// empty store, and it is created on the first change.
+//
+// path string - path of the JSON file.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, records: make(map[string]Record)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err = json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		s.records[rec.UID] = rec
+	}
+	return s, nil
+}
+
+// Get returns the record of the unique-id.
+func (s *FileStore) Get(uid string) (Record, bool, error) {
+	rec, ok := s.records[uid]
+	return rec, ok, nil
+}
+
+// Put saves the record and rewrites the file.
+func (s *FileStore) Put(rec Record) error {
+	old, existed := s.records[rec.UID]
+	s.records[rec.UID] = rec
+	if err := s.save(); err != nil {
+		if existed {
+			s.records[rec.UID] = old
+		} else {
+			delete(s.records, rec.UID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete forgets the unique-id and rewrites the file.
+func (s *FileStore) Delete(uid string) error {
+	old, existed := s.records[uid]
+	if !existed {
+		return nil
+	}
+	delete(s.records, uid)
+	if err := s.save(); err != nil {
+		s.records[uid] = old
+		return err
+	}
+	return nil
+}
+
+// UIDs returns the unique-ids in the store.
+func (s *FileStore) UIDs() ([]string, error) {
+	uids := make([]string, 0, len(s.records))
+	for uid := range s.records {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+	return uids, nil
+}
+
+// save writes the records into a temporary file, syncs it and
+// renames it over the store file.
+func (s *FileStore) save() error {
+	records := make([]Record, 0, len(s.records))
+	for _, rec := range s.records {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].UID < records[j].UID
+	})
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	f, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// KV is a key-value bucket, such as a BoltDB bucket. Every
+// method must be durable when it returns, e.g. it runs in its
+// own transaction. Get returns <nil> for a missing key.
+//
+// Example:
+// 		type boltKV struct{ db *bolt.DB }
+//
+// 		func (b boltKV) Put(k, v []byte) error {
+// 			return b.db.Update(func(tx *bolt.Tx) error {
+// 				return tx.Bucket([]byte("pop3")).Put(k, v)
+// 			})
+// 		}
+type KV interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(key, value []byte) error) error
+}
+
+// KVStore keeps the records in a KV bucket. The keys are the
+// unique-ids and the values are the records in JSON.
+type KVStore struct {
+	kv KV
+}
+
+// NewKVStore returns the store on the bucket.
+//
+// kv KV - bucket of the mailbox.
+func NewKVStore(kv KV) *KVStore {
+	return &KVStore{kv: kv}
+}
+
+// Get returns the record of the unique-id.
+func (s *KVStore) Get(uid string) (Record, bool, error) {
+	v, err := s.kv.Get([]byte(uid))
+	if err != nil || v == nil {
+		return Record{}, false, err
+	}
+	var rec Record
+	if err = json.Unmarshal(v, &rec); err != nil {
+		return Record{}, false, err
+	}
+	return rec, true, nil
+}
+
+// Put saves the record.
+func (s *KVStore) Put(rec Record) error {
+	v, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put([]byte(rec.UID), v)
+}
+
+// Delete forgets the unique-id.
+func (s *KVStore) Delete(uid string) error {
+	return s.kv.Delete([]byte(uid))
+}
+
+// UIDs returns the unique-ids in the bucket.
+func (s *KVStore) UIDs() ([]string, error) {
+	var uids []string
+	err := s.kv.ForEach(func(k, v []byte) error {
+		uids = append(uids, string(k))
+		return nil
+	})
+	return uids, err
+}
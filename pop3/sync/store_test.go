@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// mapKV is an in-memory KV.
+type mapKV map[string][]byte
+
+func (m mapKV) Get(key []byte) ([]byte, error) { return m[string(key)], nil }
+
+func (m mapKV) Put(key, value []byte) error {
+	m[string(key)] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m mapKV) Delete(key []byte) error {
+	delete(m, string(key))
+	return nil
+}
+
+func (m mapKV) ForEach(fn func(key, value []byte) error) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testStore checks the basic operations of the store.
+func testStore(t *testing.T, s Store) {
+	fetched := time.Date(2021, 11, 7, 9, 0, 0, 0, time.UTC)
+	if _, found, err := s.Get("a"); found || err != nil {
+		t.Errorf("unexpected record: %v %v", found, err)
+	}
+	if err := s.Put(Record{UID: "b", Pending: true}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := s.Put(Record{UID: "a", Fetched: fetched}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	rec, found, err := s.Get("a")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !found || rec.Pending || !rec.Fetched.Equal(fetched) {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	if rec, _, _ = s.Get("b"); !rec.Pending {
+		t.Errorf("record must be pending: %+v", rec)
+	}
+	if err = s.Delete("b"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	uids, err := s.UIDs()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(uids) != 1 || uids[0] != "a" {
+		t.Errorf("unexpected uids: %v", uids)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	testStore(t, s)
+
+	s, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if rec, found, _ := s.Get("a"); !found || rec.Fetched.IsZero() {
+		t.Errorf("record must be persisted: %+v", rec)
+	}
+	if _, found, _ := s.Get("b"); found {
+		t.Errorf("deleted record must not be persisted")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files must be removed, got: %d files", len(entries))
+	}
+}
+
+func TestFileStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(path, []byte("[{"), 0600)
+	if _, err := OpenFileStore(path); err == nil {
+		t.Errorf("expected error for corrupt file")
+	}
+}
+
+func TestKVStore(t *testing.T) {
+	kv := make(mapKV)
+	testStore(t, NewKVStore(kv))
+	if string(kv["a"]) != `{"uid":"a","fetched":"2021-11-07T09:00:00Z"}` {
+		t.Errorf("unexpected value: %s", kv["a"])
+	}
+}
@@ -0,0 +1,234 @@
+// Package sync fetches the new messages of a mailbox and
+// leaves them on the server, like fetchmail and the "leave a
+// copy on server" option of the mail clients. The unique-ids
+// of the fetched messages are kept in a Store, so only the
+// messages which are not seen before are retrieved.
+//
+// Every delivery is checkpointed in the Store before and after
+// it, and the Sink can tell whether an interrupted delivery is
+// done, so a crashed or cancelled run never loses or
+// duplicates a message. The messages are deleted only when
+// they are stored locally, and the deletions are committed by
+// QUIT.
+//
+// Example:
+// 		store, err := sync.OpenFileStore("inbox.json")
+// 		if err != nil {
+// 			log.Fatal(err)
+// 		}
+// 		s := &sync.Syncer{
+// 			Store:   store,
+// 			Sink:    &sync.MaildirSink{Dir: maildir.Dir("Mail/inbox")},
+// 			KeepFor: 7 * 24 * time.Hour,
+// 		}
+// 		res, err := s.Run(pop)
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/maildir"
+)
+
+// Sink stores the fetched messages locally.
+type Sink interface {
+	// Deliver stores the message. It must not return until
+	// the message is durable.
+	Deliver(uid string, r io.Reader) error
+
+	// Delivered reports whether the message with the
+	// unique-id is stored. It is called only for the
+	// deliveries which are interrupted.
+	Delivered(uid string) (bool, error)
+}
+
+// MaildirSink delivers the messages into a Maildir. The hash of
+// the unique-id is kept in the key of the message, so an
+// interrupted delivery can be detected.
+type MaildirSink struct {
+	// Dir is the Maildir. It must be initialized.
+	Dir maildir.Dir
+}
+
+// Deliver delivers the message into new/ directory.
+func (s *MaildirSink) Deliver(uid string, r io.Reader) error {
+	_, err := s.Dir.DeliverID(uid, r)
+	return err
+}
+
+// Delivered reports whether the message is in the Maildir.
+func (s *MaildirSink) Delivered(uid string) (bool, error) {
+	return s.Dir.HasID(uid)
+}
+
+// Syncer fetches the messages which are not in the Store into
+// the Sink. A Syncer must not be used concurrently with the
+// same Store.
+type Syncer struct {
+	// Store keeps the unique-ids of the fetched messages.
+	Store Store
+
+	// Sink stores the fetched messages.
+	Sink Sink
+
+	// DeleteAfterFetch deletes the messages from the server
+	// as soon as they are stored locally.
+	DeleteAfterFetch bool
+
+	// KeepFor deletes the messages from the server when they
+	// are fetched KeepFor ago. If it is zero, the messages are
+	// kept on the server, unless DeleteAfterFetch is set.
+	KeepFor time.Duration
+
+	// Now returns the current time. If it is <nil>, time.Now
+	// is used.
+	Now func() time.Time
+}
+
+// Result is the summary of a run.
+type Result struct {
+	// Fetched is the number of the messages which are stored
+	// in the Sink.
+	Fetched int
+
+	// Deleted is the number of the messages which are deleted
+	// from the server.
+	Deleted int
+
+	// Skipped is the number of the messages which are fetched
+	// before.
+	Skipped int
+}
+
+// Run fetches the new messages and quits the session. The
+// client must be in the TRANSACTION state and the server must
+// support UIDL command. If Run fails, the session is left
+// open. It is safe to quit it, because only the messages which
+// are stored locally are marked as deleted.
+//
+// c *pop3.Client - logged in client.
+func (s *Syncer) Run(c *pop3.Client) (Result, error) {
+	return s.RunContext(context.Background(), c)
+}
+
+// RunContext is the context-aware version of Run.
+func (s *Syncer) RunContext(ctx context.Context, c *pop3.Client) (Result, error) {
+	var res Result
+	ids, err := c.UidlContext(ctx)
+	if err != nil {
+		return res, fmt.Errorf("sync: uidl: %w", err)
+	}
+
+	listed := make(map[string]bool, len(ids))
+	var deleted []string
+	for _, id := range ids {
+		listed[id.UID] = true
+		rec, fetched, err := s.fetch(ctx, c, id)
+		if err != nil {
+			return res, err
+		}
+		if fetched {
+			res.Fetched++
+		} else {
+			res.Skipped++
+		}
+
+		if !s.expired(rec) {
+			continue
+		}
+		if _, err = c.DeleContext(ctx, strconv.Itoa(id.Num)); err != nil {
+			return res, fmt.Errorf("sync: dele %d: %w", id.Num, err)
+		}
+		deleted = append(deleted, id.UID)
+	}
+
+	if _, err = c.QuitContext(ctx); err != nil {
+		return res, fmt.Errorf("sync: quit: %w", err)
+	}
+	res.Deleted = len(deleted)
+
+	// The deleted messages and the messages which are removed
+	// by other clients are not on the server anymore.
+	for _, uid := range deleted {
+		delete(listed, uid)
+	}
+	uids, err := s.Store.UIDs()
+	if err != nil {
+		return res, err
+	}
+	for _, uid := range uids {
+		if !listed[uid] {
+			if err = s.Store.Delete(uid); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// fetch stores the message if it is not fetched before. A
+// pending record is checked with the Sink, so the message is
+// not delivered twice. It returns the record of the message
+// and whether it is fetched in this run.
+func (s *Syncer) fetch(ctx context.Context, c *pop3.Client, id pop3.UniqueID) (Record, bool, error) {
+	rec, found, err := s.Store.Get(id.UID)
+	if err != nil {
+		return Record{}, false, err
+	}
+	if found && !rec.Pending {
+		return rec, false, nil
+	}
+
+	if found {
+		done, err := s.Sink.Delivered(id.UID)
+		if err != nil {
+			return Record{}, false, err
+		}
+		if done {
+			rec = Record{UID: id.UID, Fetched: s.now()}
+			return rec, true, s.Store.Put(rec)
+		}
+	} else if err = s.Store.Put(Record{UID: id.UID, Pending: true}); err != nil {
+		return Record{}, false, err
+	}
+
+	r, err := c.RetrReaderContext(ctx, id.Num)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("sync: retr %d: %w", id.Num, err)
+	}
+	err = s.Sink.Deliver(id.UID, r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("sync: deliver %d: %w", id.Num, err)
+	}
+
+	rec = Record{UID: id.UID, Fetched: s.now()}
+	return rec, true, s.Store.Put(rec)
+}
+
+// expired reports whether the fetched message must be deleted
+// from the server.
+func (s *Syncer) expired(rec Record) bool {
+	if rec.Pending {
+		return false
+	}
+	if s.DeleteAfterFetch {
+		return true
+	}
+	return s.KeepFor > 0 && s.now().Sub(rec.Fetched) >= s.KeepFor
+}
+
+// now returns the current time.
+func (s *Syncer) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,203 @@
+package sync
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3/maildir"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+)
+
+var (
+	msgA = pop3test.Message{UID: "uid-a", Data: "Subject: a\n\nfirst\n"}
+	msgB = pop3test.Message{UID: "uid-b", Data: "Subject: b\n\nsecond\n"}
+	msgC = pop3test.Message{UID: "uid-c", Data: "Subject: c\n\nthird\n"}
+)
+
+func testSink(t *testing.T) *MaildirSink {
+	d := maildir.Dir(filepath.Join(t.TempDir(), "inbox"))
+	if err := d.Init(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return &MaildirSink{Dir: d}
+}
+
+// countRetr returns the number of RETR commands which the
+// server has received.
+func countRetr(srv *pop3test.Server) int {
+	n := 0
+	for _, cmd := range srv.Commands() {
+		if strings.HasPrefix(cmd, "RETR ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSyncer_Run(t *testing.T) {
+	srv := pop3test.NewServer()
+	defer srv.Close()
+	srv.AddMailbox("user", "secret", msgA, msgB)
+	sink := testSink(t)
+	s := &Syncer{Store: NewKVStore(make(mapKV)), Sink: sink}
+
+	res, err := s.Run(srv.Login(t, nil, "user", "secret"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if res != (Result{Fetched: 2}) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	srv.AddMailbox("user", "secret", msgA, msgB, msgC)
+	res, err = s.Run(srv.Login(t, nil, "user", "secret"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if res != (Result{Fetched: 1, Skipped: 2}) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if n := countRetr(srv); n != 3 {
+		t.Errorf("expected 3 RETR commands, got: %d", n)
+	}
+	if len(srv.Messages("user")) != 3 {
+		t.Errorf("messages must be left on the server")
+	}
+
+	msgs, _ := sink.Dir.List()
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages, got: %d", len(msgs))
+	}
+	f, err := sink.Dir.Open(msgs[0].Key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer f.Close()
+	buf := make([]byte, 64)
+	n, _ := f.Read(buf)
+	if got := string(buf[:n]); got != msgA.Data {
+		t.Errorf("expected: %q, got: %q", msgA.Data, got)
+	}
+}
+
+func TestSyncer_RunInterrupted(t *testing.T) {
+	srv := pop3test.NewServer()
+	defer srv.Close()
+	srv.AddMailbox("user", "secret", msgA, msgB)
+	sink := testSink(t)
+	s := &Syncer{Store: NewKVStore(make(mapKV)), Sink: sink}
+
+	srv.Fail("RETR", pop3test.Failure{})
+	srv.Fail("RETR", pop3test.Failure{Resp: "-ERR [SYS/TEMP] try again later"})
+	c := srv.Login(t, nil, "user", "secret")
+	if _, err := s.Run(c); err == nil {
+		t.Fatalf("expected RETR error")
+	}
+	c.Quit()
+	if rec, _, _ := s.Store.Get("uid-b"); !rec.Pending {
+		t.Errorf("interrupted delivery must be pending: %+v", rec)
+	}
+
+	res, err := s.Run(srv.Login(t, nil, "user", "secret"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if res != (Result{Fetched: 1, Skipped: 1}) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if msgs, _ := sink.Dir.List(); len(msgs) != 2 {
+		t.Errorf("expected 2 messages, got: %d", len(msgs))
+	}
+}
+
+func TestSyncer_RunPendingDelivered(t *testing.T) {
+	srv := pop3test.NewServer()
+	defer srv.Close()
+	srv.AddMailbox("user", "secret", msgA)
+	sink := testSink(t)
+	// The run crashed after the delivery, before the
+	// checkpoint.
+	if err := sink.Deliver("uid-a", strings.NewReader(msgA.Data)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	store := NewKVStore(make(mapKV))
+	store.Put(Record{UID: "uid-a", Pending: true})
+	s := &Syncer{Store: store, Sink: sink}
+
+	res, err := s.Run(srv.Login(t, nil, "user", "secret"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if res != (Result{Fetched: 1}) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if n := countRetr(srv); n != 0 {
+		t.Errorf("delivered message must not be retrieved again, got: %d RETR", n)
+	}
+	if msgs, _ := sink.Dir.List(); len(msgs) != 1 {
+		t.Errorf("message must not be duplicated, got: %d", len(msgs))
+	}
+	if rec, _, _ := store.Get("uid-a"); rec.Pending || rec.Fetched.IsZero() {
+		t.Errorf("record must be checkpointed: %+v", rec)
+	}
+}
+
+func TestSyncer_RunKeepFor(t *testing.T) {
+	srv := pop3test.NewServer()
+	defer srv.Close()
+	srv.AddMailbox("user", "secret", msgA, msgB)
+	now := time.Date(2021, 11, 7, 9, 0, 0, 0, time.UTC)
+	s := &Syncer{
+		Store:   NewKVStore(make(mapKV)),
+		Sink:    testSink(t),
+		KeepFor: 7 * 24 * time.Hour,
+		Now:     func() time.Time { return now },
+	}
+
+	if _, err := s.Run(srv.Login(t, nil, "user", "secret")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	srv.AddMailbox("user", "secret", msgA, msgB, msgC)
+	now = now.Add(7 * 24 * time.Hour)
+	res, err := s.Run(srv.Login(t, nil, "user", "secret"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if res != (Result{Fetched: 1, Deleted: 2, Skipped: 2}) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if msgs := srv.Messages("user"); len(msgs) != 1 || msgs[0].UID != "uid-c" {
+		t.Errorf("unexpected messages on the server: %+v", msgs)
+	}
+	if uids, _ := s.Store.UIDs(); len(uids) != 1 || uids[0] != "uid-c" {
+		t.Errorf("deleted messages must be pruned: %v", uids)
+	}
+}
+
+func TestSyncer_RunDeleteAfterFetch(t *testing.T) {
+	srv := pop3test.NewServer()
+	defer srv.Close()
+	srv.AddMailbox("user", "secret", msgA, msgB)
+	s := &Syncer{Store: NewKVStore(make(mapKV)), Sink: testSink(t), DeleteAfterFetch: true}
+
+	srv.Fail("QUIT", pop3test.Failure{Close: true})
+	if _, err := s.Run(srv.Login(t, nil, "user", "secret")); err == nil {
+		t.Fatalf("expected QUIT error")
+	}
+	if len(srv.Messages("user")) != 2 {
+		t.Fatalf("deletions must not be committed without QUIT")
+	}
+
+	res, err := s.Run(srv.Login(t, nil, "user", "secret"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if res != (Result{Deleted: 2, Skipped: 2}) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if len(srv.Messages("user")) != 0 {
+		t.Errorf("messages must be deleted")
+	}
+}
@@ -0,0 +1,165 @@
+package pop3
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction tells which side of the connection sent a line.
+type Direction int
+
+const (
+	// DirClient is a line which is sent by the client.
+	DirClient Direction = iota
+
+	// DirServer is a line which is sent by the server.
+	DirServer
+)
+
+// String returns "C" for the client and "S" for the server,
+// as in the examples of RFC 1939.
+func (d Direction) String() string {
+	if d == DirClient {
+		return "C"
+	}
+	return "S"
+}
+
+// redacted replaces the secrets in the traced lines.
+const redacted = "[redacted]"
+
+// TraceEvent is a protocol line which is sent or received.
+type TraceEvent struct {
+	// Time is the time when the line is sent or received.
+	Time time.Time
+
+	// Dir is the sender of the line.
+	Dir Direction
+
+	// Line is the line without the line ending. The passwords,
+	// APOP digests and SASL payloads are redacted.
+	Line string
+
+	// Body is true for the lines of a multi-line response
+	// after the status line. The termination line (".") is a
+	// body line too.
+	Body bool
+
+	// BodyLine is the number of the body line in its response,
+	// starting from 1. The termination line has the number
+	// after the last line of the body. It is zero for the
+	// other lines.
+	BodyLine int
+}
+
+// Tracer records the protocol lines of a Client. Trace is
+// called while the command is in progress, so it must not
+// call the Client.
+type Tracer interface {
+	Trace(ev TraceEvent)
+}
+
+// TracerFunc is a function which implements Tracer.
+type TracerFunc func(ev TraceEvent)
+
+// Trace calls f(ev).
+func (f TracerFunc) Trace(ev TraceEvent) {
+	f(ev)
+}
+
+// TraceWriter writes the protocol lines into W with their
+// time and direction. It is safe to share by several clients;
+// the body lines are counted by each client, see BodyLine of
+// TraceEvent.
+//
+// Example:
+// 		2021-11-07T09:00:00.000Z C: PASS [redacted]
+// 		2021-11-07T09:00:00.004Z S: +OK maildrop locked and ready
+type TraceWriter struct {
+	// W is the destination of the trace.
+	W io.Writer
+
+	// MaxBodyLines limits the number of the traced lines of
+	// each multi-line response. The skipped lines are counted
+	// before the termination line. Zero means no limit.
+	MaxBodyLines int
+
+	mu sync.Mutex
+}
+
+// NewTraceWriter returns a TraceWriter.
+//
+// w io.Writer - destination, e.g. os.Stderr
+// maxBodyLines int - limit of the body lines, zero for no limit.
+func NewTraceWriter(w io.Writer, maxBodyLines int) *TraceWriter {
+	return &TraceWriter{W: w, MaxBodyLines: maxBodyLines}
+}
+
+// Trace writes the line. The errors of W are ignored.
+func (t *TraceWriter) Trace(ev TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stamp := ev.Time.Format("2006-01-02T15:04:05.000Z07:00")
+	if ev.Body && t.MaxBodyLines > 0 {
+		if ev.Line == "." {
+			if skipped := ev.BodyLine - 1 - t.MaxBodyLines; skipped > 0 {
+				fmt.Fprintf(t.W, "%s %v: [%d lines truncated]\n", stamp, ev.Dir, skipped)
+			}
+		} else if ev.BodyLine > t.MaxBodyLines {
+			return
+		}
+	}
+	fmt.Fprintf(t.W, "%s %v: %s\n", stamp, ev.Dir, ev.Line)
+}
+
+// trace sends the line to the Tracer of the client after
+// redacting it.
+//
+// dir Direction - sender of the line.
+// line string - line without the line ending.
+// body bool - whether the line is in a multi-line body.
+func (c *Client) trace(dir Direction, line string, body bool) {
+	if c.Trace == nil {
+		return
+	}
+	if body {
+		c.traceBody++
+	} else {
+		c.traceBody = 0
+	}
+	if dir == DirClient {
+		line = c.redactCmd(line)
+	} else if c.inAuth && strings.HasPrefix(line, "+ ") && len(line) > 2 {
+		line = "+ " + redacted
+	}
+	ev := TraceEvent{Time: time.Now(), Dir: dir, Line: line, Body: body}
+	if body {
+		ev.BodyLine = c.traceBody
+	}
+	c.Trace.Trace(ev)
+}
+
+// redactCmd hides the password of PASS command, the digest of
+// APOP command and the SASL responses.
+func (c *Client) redactCmd(line string) string {
+	fields := strings.SplitN(line, " ", 3)
+	switch strings.ToUpper(fields[0]) {
+	case "PASS":
+		if len(fields) > 1 {
+			return fields[0] + " " + redacted
+		}
+		return line
+	case "APOP", "AUTH":
+		if len(fields) == 3 {
+			return fields[0] + " " + fields[1] + " " + redacted
+		}
+		return line
+	}
+	if c.inAuth && line != "*" && line != "" {
+		return redacted
+	}
+	return line
+}
@@ -0,0 +1,194 @@
+package pop3_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
+	"github.com/gozeloglu/gop-3/pop3/sasl"
+)
+
+// traceLines returns the directions and the lines of the
+// trace events as "C: line".
+func traceLines(events []pop3.TraceEvent) []string {
+	var lines []string
+	for _, ev := range events {
+		lines = append(lines, ev.Dir.String()+": "+ev.Line)
+	}
+	return lines
+}
+
+func TestClient_Trace(t *testing.T) {
+	srv := newTestServer(t, false)
+	var events []pop3.TraceEvent
+	d := &pop3.Dialer{Trace: pop3.TracerFunc(func(ev pop3.TraceEvent) {
+		events = append(events, ev)
+	})}
+	pop, err := d.Dial(srv.Addr)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pop.User(testUser)
+	if _, err = pop.Pass(testPassword); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err = pop.Top(2, 0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	r, err := pop.RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	r.Close()
+	pop.Quit()
+
+	lines := traceLines(events)
+	expected := []string{
+		"S: " + pop3test.DefaultBanner,
+		"C: USER " + testUser,
+		"S: +OK",
+		"C: PASS [redacted]",
+		"S: +OK",
+		"C: TOP 2 0",
+		"S: +OK",
+		"S: From: jane@example.com",
+		"S: Subject: Report",
+		"S: ",
+		"S: .",
+		"C: RETR 1",
+		"S: +OK",
+	}
+	if len(lines) < len(expected) {
+		t.Fatalf("unexpected trace: %q", lines)
+	}
+	for i, l := range expected {
+		if !strings.HasPrefix(lines[i], l) {
+			t.Errorf("line %d: expected: %q, got: %q", i, l, lines[i])
+		}
+	}
+	if !events[7].Body || events[6].Body || events[0].Time.IsZero() {
+		t.Errorf("unexpected body flags: %+v", events[6:8])
+	}
+	if last := lines[len(lines)-2]; last != "C: QUIT" {
+		t.Errorf("expected QUIT, got: %q", last)
+	}
+	for _, l := range lines {
+		if strings.Contains(l, testPassword) {
+			t.Errorf("password must be redacted: %q", l)
+		}
+	}
+}
+
+func TestClient_TraceRedactAuth(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "AUTH LOGIN", Send: "+ VXNlcm5hbWU6"},
+		pop3test.Step{Expect: "dXNlcg==", Send: "+ UGFzc3dvcmQ6"},
+		pop3test.Step{Expect: "c2VjcmV0", Send: "+OK Maildrop locked and ready"},
+	)
+	var events []pop3.TraceEvent
+	pop.Trace = pop3.TracerFunc(func(ev pop3.TraceEvent) {
+		events = append(events, ev)
+	})
+	if _, err := pop.Auth(sasl.NewLoginClient("user", "secret")); err != nil {
+		t.Fatalf(err.Error())
+	}
+	pop.WriteLine("APOP user c4c9334bac560ecc979e58001b3e22fb")
+
+	expected := []string{
+		"C: AUTH LOGIN",
+		"S: + [redacted]",
+		"C: [redacted]",
+		"S: + [redacted]",
+		"C: [redacted]",
+		"S: +OK Maildrop locked and ready",
+		"C: APOP user [redacted]",
+	}
+	lines := traceLines(events)
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected: %q, got: %q", expected, lines)
+	}
+}
+
+func TestRedactCmd(t *testing.T) {
+	c := &pop3.Client{}
+	tests := map[string]string{
+		"USER john":                   "USER john",
+		"PASS secret":                 "PASS [redacted]",
+		"pass secret with spaces":     "pass [redacted]",
+		"AUTH PLAIN AHVzZXIAc2VjcmV0": "AUTH PLAIN [redacted]",
+		"AUTH PLAIN":                  "AUTH PLAIN",
+		"RETR 1":                      "RETR 1",
+	}
+	for line, expected := range tests {
+		if got := c.RedactCmd(line); got != expected {
+			t.Errorf("%q: expected: %q, got: %q", line, expected, got)
+		}
+	}
+	c.SetInAuth(true)
+	if got := c.RedactCmd("*"); got != "*" {
+		t.Errorf("cancellation must not be redacted: %q", got)
+	}
+}
+
+func TestTraceWriter(t *testing.T) {
+	var buf bytes.Buffer
+	tw := pop3.NewTraceWriter(&buf, 2)
+	at := time.Date(2021, 11, 7, 9, 0, 0, 0, time.UTC)
+	tw.Trace(pop3.TraceEvent{Time: at, Dir: pop3.DirClient, Line: "RETR 1"})
+	tw.Trace(pop3.TraceEvent{Time: at, Dir: pop3.DirServer, Line: "+OK"})
+	for i, l := range []string{"a", "b", "c", "d", "."} {
+		tw.Trace(pop3.TraceEvent{Time: at, Dir: pop3.DirServer, Line: l, Body: true, BodyLine: i + 1})
+	}
+	tw.Trace(pop3.TraceEvent{Time: at, Dir: pop3.DirServer, Line: "x", Body: true, BodyLine: 1})
+
+	expected := "2021-11-07T09:00:00.000Z C: RETR 1\n" +
+		"2021-11-07T09:00:00.000Z S: +OK\n" +
+		"2021-11-07T09:00:00.000Z S: a\n" +
+		"2021-11-07T09:00:00.000Z S: b\n" +
+		"2021-11-07T09:00:00.000Z S: [2 lines truncated]\n" +
+		"2021-11-07T09:00:00.000Z S: .\n" +
+		"2021-11-07T09:00:00.000Z S: x\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("expected: %q, got: %q", expected, got)
+	}
+}
+
+func TestTraceWriter_Shared(t *testing.T) {
+	srv := newTestServer(t, false)
+	var buf bytes.Buffer
+	srv.AddMailbox("other", testPassword, srv.Messages(testUser)...)
+	tw := pop3.NewTraceWriter(&buf, 1)
+	clients := make([]*pop3.Client, 2)
+	for i, user := range []string{testUser, "other"} {
+		pop, err := (&pop3.Dialer{Trace: tw}).Dial(srv.Addr)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		pop.User(user)
+		if _, err = pop.Pass(testPassword); err != nil {
+			t.Fatalf(err.Error())
+		}
+		clients[i] = pop
+	}
+	// The bodies of the clients are interleaved.
+	r0, err := clients[0].RetrReader(1)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	line := make([]byte, 1)
+	r0.Read(line)
+	if _, err = clients[1].Top(2, 0); err != nil {
+		t.Fatalf(err.Error())
+	}
+	r0.Close()
+
+	if n := strings.Count(buf.String(), "lines truncated]"); n != 2 {
+		t.Errorf("expected a truncation for each response, got: %d\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "S: [2 lines truncated]") {
+		t.Errorf("TOP body must be counted by its client:\n%s", buf.String())
+	}
+}
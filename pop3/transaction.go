@@ -1,22 +1,27 @@
 package pop3
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
 )
 
+// The errors of the invalid arguments. They are detected before
+// sending the command, so they are not *ServerError.
+var (
+	errMsgNum    = errors.New("message number must be greater than 0")
+	errLineCount = errors.New("line count cannot be negative")
+)
+
 // sendCmd is the function that send command
 // without any argument. It ends with CRLF
 // (\r\n). It returns if something goes wrong
 // while sending cmd.
 func (c *Client) sendCmd(cmd string) error {
-	buf := []byte(cmd + "\r\n")
-	_, err := c.Conn.Write(buf)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.writeLine(cmd)
 }
 
 // sendCmdWithArg function sends the POP3 command with
@@ -25,46 +30,19 @@ func (c *Client) sendCmd(cmd string) error {
 //
 // cmd string - command that send will send
 // arg string - argument which command takes
-func (c Client) sendCmdWithArg(cmd string, arg string) error {
-	buf := []byte(cmd + " " + arg + "\r\n")
-	_, err := c.Conn.Write(buf[:])
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// readResp reads the command's response.
-// It allocates a byte array with size of 512 byte.
-// Read and store the response into buf array.
-// Finally, the byte array converts to string and
-// return.
-func (c *Client) readResp() (string, error) {
-	var buf [512]byte
-	r, err := c.Conn.Read(buf[:])
-	if err != nil {
-		return "", err
-	}
-
-	resp := string(buf[:r])
-	return resp, nil
+func (c *Client) sendCmdWithArg(cmd string, arg string) error {
+	return c.writeLine(cmd + " " + arg)
 }
 
-// readRespMultiLines reads the response that has multiple
-// lines until reaching ".\r\n" character set. Each
-// line is added to listResp array.
-func (c Client) readRespMultiLines() ([]string, error) {
-	var buf [512]byte
-	var listResp []string
-
-	r, err := c.Conn.Read(buf[:])
-	if err != nil {
-		return nil, err
-	}
-	resp := string(buf[:r])
-	listResp = append(listResp, strings.Split(resp, "\r\n")...)
-
-	return listResp, nil
+// writeLine traces the line and sends it with CRLF.
+//
+// line string - command line without the line ending.
+func (c *Client) writeLine(line string) error {
+	c.trace(DirClient, line, false)
+	c.recordSent(line)
+	n, err := c.conn().Write([]byte(line + "\r\n"))
+	c.sentBytes += int64(n)
+	return err
 }
 
 // Stat is a TRANSACTION state command. It
@@ -79,7 +57,17 @@ func (c Client) readRespMultiLines() ([]string, error) {
 // Example:
 // 		+OK 2 320
 func (c *Client) Stat() (string, error) {
-	return c.stat()
+	return c.StatContext(context.Background())
+}
+
+// StatContext is the context-aware version of Stat.
+func (c *Client) StatContext(ctx context.Context) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.stat()
+	return resp, end(err)
 }
 
 // stat is implementation of the Stat function.
@@ -88,7 +76,12 @@ func (c *Client) Stat() (string, error) {
 // the command and error is the unexpected
 // situations.
 func (c *Client) stat() (string, error) {
-	err := c.sendCmd("STAT")
+	err := c.checkState("STAT", StateTransaction)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.sendCmd("STAT")
 	if err != nil {
 		return "", err
 	}
@@ -98,7 +91,164 @@ func (c *Client) stat() (string, error) {
 		return "", err
 	}
 
-	return resp, nil
+	return resp, respErr("STAT", resp)
+}
+
+// StatResult keeps the parsed response of STAT command.
+type StatResult struct {
+	// Count is the number of messages in the maildrop.
+	Count int
+
+	// Size is the size of the maildrop in octets.
+	Size int
+}
+
+// StatInfo is the typed version of the Stat function. It
+// sends STAT command and parses the number of messages and
+// the size of the maildrop. Negative response is returned
+// as error.
+// Example:
+// 		C: STAT
+// 		S: +OK 2 320
+func (c *Client) StatInfo() (StatResult, error) {
+	return c.StatInfoContext(context.Background())
+}
+
+// StatInfoContext is the context-aware version of StatInfo.
+func (c *Client) StatInfoContext(ctx context.Context) (StatResult, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return StatResult{}, err
+	}
+	resp, err := c.statInfo()
+	return resp, end(err)
+}
+
+// statInfo is the implementation of the StatInfo function.
+func (c *Client) statInfo() (StatResult, error) {
+	resp, err := c.stat()
+	if err != nil {
+		return StatResult{}, err
+	}
+
+	count, size, err := parseNumPair(strings.TrimPrefix(resp, ok))
+	if err != nil {
+		return StatResult{}, fmt.Errorf("malformed STAT response: %q", resp)
+	}
+	return StatResult{Count: count, Size: size}, nil
+}
+
+// MessageInfo keeps the scan listing of a message which is
+// returned by LIST command.
+type MessageInfo struct {
+	// Num is the message number.
+	Num int
+
+	// Size is the size of the message in octets.
+	Size int
+}
+
+// ListAll is the typed version of the List function without
+// argument. It returns the scan listing of all messages in
+// the maildrop. Negative response is returned as error.
+// Example:
+// 		C: LIST
+// 		S: +OK 2 messages (320 octets)
+// 		S: 1 120
+// 		S: 2 200
+// 		S: .
+func (c *Client) ListAll() ([]MessageInfo, error) {
+	return c.ListAllContext(context.Background())
+}
+
+// ListAllContext is the context-aware version of ListAll.
+func (c *Client) ListAllContext(ctx context.Context) ([]MessageInfo, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.listAll()
+	return resp, end(err)
+}
+
+// listAll is the implementation of the ListAll function.
+func (c *Client) listAll() ([]MessageInfo, error) {
+	lines, err := c.list(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []MessageInfo
+	for _, l := range lines[1:] {
+		msg, err := parseMessageInfo(l)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// ListOne is the typed version of the List function with
+// argument. It returns the scan listing of the given message.
+// Negative response is returned as error.
+// Example:
+// 		C: LIST 2
+// 		S: +OK 2 200
+//
+// msgNum int - message number.
+func (c *Client) ListOne(msgNum int) (MessageInfo, error) {
+	return c.ListOneContext(context.Background(), msgNum)
+}
+
+// ListOneContext is the context-aware version of ListOne.
+func (c *Client) ListOneContext(ctx context.Context, msgNum int) (MessageInfo, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return MessageInfo{}, err
+	}
+	resp, err := c.listOne(msgNum)
+	return resp, end(err)
+}
+
+// listOne is the implementation of the ListOne function.
+func (c *Client) listOne(msgNum int) (MessageInfo, error) {
+	lines, err := c.list([]int{msgNum})
+	if err != nil {
+		return MessageInfo{}, err
+	}
+	return parseMessageInfo(strings.TrimPrefix(lines[0], ok))
+}
+
+// parseMessageInfo parses a scan listing which consists of
+// message number and size separated by a single space.
+//
+// line string - scan listing, e.g. "1 120"
+func parseMessageInfo(line string) (MessageInfo, error) {
+	num, size, err := parseNumPair(line)
+	if err != nil {
+		return MessageInfo{}, fmt.Errorf("malformed scan listing: %q", line)
+	}
+	return MessageInfo{Num: num, Size: size}, nil
+}
+
+// parseNumPair parses the first two space separated numbers
+// of the line. The rest of the line is ignored, because the
+// servers may append extra information.
+func parseNumPair(line string) (int, int, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("expected two numbers: %q", line)
+	}
+	first, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	second, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return first, second, nil
 }
 
 // List returns the mail information. It can take argument
@@ -124,8 +274,17 @@ func (c *Client) stat() (string, error) {
 // msgNum ...int - variadic parameter. It indicates mail
 // number that we get.
 func (c *Client) List(mainNum ...int) ([]string, error) {
-	// TODO Check the client is whether in TRANSACTION state
-	return c.list(mainNum)
+	return c.ListContext(context.Background(), mainNum...)
+}
+
+// ListContext is the context-aware version of List.
+func (c *Client) ListContext(ctx context.Context, mainNum ...int) ([]string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.list(mainNum)
+	return resp, end(err)
 }
 
 // list is the implementation of the List function.
@@ -135,10 +294,14 @@ func (c *Client) List(mainNum ...int) ([]string, error) {
 //
 // mailNum []int - mail numbers.
 func (c *Client) list(mailNum []int) ([]string, error) {
-	var err error
 	var msg string
 	var msgList []string
 
+	err := c.checkState("LIST", StateTransaction)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(mailNum) > 0 {
 		err = c.sendCmdWithArg("LIST", strconv.Itoa(mailNum[0]))
 	} else {
@@ -154,7 +317,10 @@ func (c *Client) list(mailNum []int) ([]string, error) {
 		msg, err = c.readResp()
 		msgList = append(msgList, msg)
 	}
-	return msgList, err
+	if err != nil {
+		return msgList, err
+	}
+	return msgList, respErr("LIST", msgList[0])
 }
 
 // Retr retrieves the mails from the inbox. It indicates
@@ -168,12 +334,23 @@ func (c *Client) list(mailNum []int) ([]string, error) {
 // returns "-ERR". The line starts with "-ERR". The function
 // returns string array and error. Error is returned for
 // unexpected situations like sending command or reading
-// response fails. The string array contains the multiple
-// line responses.
+// response fails. The string array contains the status
+// line followed by the message lines. The termination
+// line is removed and dot-stuffed lines are restored.
 //
 // mailNum string - mail-number.
 func (c *Client) Retr(mailNum string) ([]string, error) {
-	return c.retr(mailNum)
+	return c.RetrContext(context.Background(), mailNum)
+}
+
+// RetrContext is the context-aware version of Retr.
+func (c *Client) RetrContext(ctx context.Context, mailNum string) ([]string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.retr(mailNum)
+	return resp, end(err)
 }
 
 // retr function is implementation of the Retr function.
@@ -182,8 +359,13 @@ func (c *Client) Retr(mailNum string) ([]string, error) {
 //
 // mailNum string - mail-number.
 func (c *Client) retr(mailNum string) ([]string, error) {
+	err := c.checkState("RETR", StateTransaction)
+	if err != nil {
+		return nil, err
+	}
+
 	// Send the RETR command
-	err := c.sendCmdWithArg("RETR", mailNum)
+	err = c.sendCmdWithArg("RETR", mailNum)
 	if err != nil {
 		return nil, err
 	}
@@ -193,18 +375,91 @@ func (c *Client) retr(mailNum string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return retrResp, nil
+	return retrResp, respErr("RETR", retrResp[0])
+}
+
+// RetrReader retrieves the message like Retr, but it does
+// not keep the entire message in memory. The returned reader
+// streams the message body directly from the connection.
+// Dot-stuffed lines are restored and the termination line
+// is not included. Line endings are kept as they are sent
+// by the server, which is CRLF in POP3. The client stays
+// locked until the reader is drained or closed; the commands
+// of the other goroutines wait until then. The reader must
+// be closed before sending another command from the same
+// goroutine, otherwise the command waits forever unless its
+// context ends. Closing the reader early discards the rest of
+// the message. If the server responds with "-ERR", it is
+// returned as error.
+//
+// msgNum int - message number.
+func (c *Client) RetrReader(msgNum int) (io.ReadCloser, error) {
+	return c.RetrReaderContext(context.Background(), msgNum)
+}
+
+// RetrReaderContext is the context-aware version of RetrReader.
+// The context bounds reading the message too, so it must not
+// be cancelled until the reader is closed.
+func (c *Client) RetrReaderContext(ctx context.Context, msgNum int) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end, err := c.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.retrReader(msgNum)
+	if err != nil {
+		return nil, end(err)
+	}
+	r.end = end
+	return r, nil
+}
+
+// retrReader is the implementation of the RetrReader function.
+func (c *Client) retrReader(msgNum int) (*dotReader, error) {
+	err := c.checkState("RETR", StateTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.sendCmdWithArg("RETR", strconv.Itoa(msgNum))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.readResp()
+	if err != nil {
+		return nil, err
+	}
+	if err = respErr("RETR", resp); err != nil {
+		return nil, err
+	}
+
+	c.activeReader = true
+	c.readerDone = make(chan struct{})
+	return &dotReader{c: c}, nil
 }
 
 // Dele function deletes mail that is given as parameter.
 // DELE command takes mail number and returns 2 possible
 // message which are starts with "+OK" or "-ERR". POP3
 // server does not actually delete the mail until POP3
-// session enters the UPDATE state.
+// session enters the UPDATE state. Negative response is
+// returned together with *ServerError.
 //
 // mailNum string - mail number that will be deleted.
 func (c *Client) Dele(mailNum string) (string, error) {
-	return c.dele(mailNum)
+	return c.DeleContext(context.Background(), mailNum)
+}
+
+// DeleContext is the context-aware version of Dele.
+func (c *Client) DeleContext(ctx context.Context, mailNum string) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.dele(mailNum)
+	return resp, end(err)
 }
 
 // dele function is the implementation of the Dele function.
@@ -217,7 +472,11 @@ func (c *Client) Dele(mailNum string) (string, error) {
 func (c *Client) dele(mailNum string) (string, error) {
 	// Send the DELE command.
 	cmd := "DELE"
-	err := c.sendCmdWithArg(cmd, mailNum)
+	err := c.checkState(cmd, StateTransaction)
+	if err != nil {
+		return "", err
+	}
+	err = c.sendCmdWithArg(cmd, mailNum)
 	if err != nil {
 		return "", err
 	}
@@ -227,7 +486,7 @@ func (c *Client) dele(mailNum string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return deleResp, nil
+	return deleResp, respErr(cmd, deleResp)
 }
 
 // Noop is a command which does nothing. The POP3
@@ -237,12 +496,26 @@ func (c *Client) dele(mailNum string) (string, error) {
 // 		S: +OK
 // It takes no argument.
 func (c *Client) Noop() (string, error) {
-	return c.noop()
+	return c.NoopContext(context.Background())
+}
+
+// NoopContext is the context-aware version of Noop.
+func (c *Client) NoopContext(ctx context.Context) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.noop()
+	return resp, end(err)
 }
 
 // noop is implementation of the Noop function.
 func (c *Client) noop() (string, error) {
-	err := c.sendCmd("NOOP")
+	err := c.checkState("NOOP", StateTransaction)
+	if err != nil {
+		return "", err
+	}
+	err = c.sendCmd("NOOP")
 	if err != nil {
 		return "", err
 	}
@@ -250,7 +523,7 @@ func (c *Client) noop() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return noop, nil
+	return noop, respErr("NOOP", noop)
 }
 
 // Rset is a command which unmark if any message
@@ -260,7 +533,17 @@ func (c *Client) noop() (string, error) {
 //		C: RSET
 // 		S: +OK maildrop has 2 messages.
 func (c *Client) Rset() (string, error) {
-	return c.rset()
+	return c.RsetContext(context.Background())
+}
+
+// RsetContext is the context-aware version of Rset.
+func (c *Client) RsetContext(ctx context.Context) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.rset()
+	return resp, end(err)
 }
 
 // rset is the implementation of the Rset function.
@@ -269,8 +552,13 @@ func (c *Client) Rset() (string, error) {
 // message comes from the server and error is
 // returned if something goes wrong while sending
 // command or reading response.
-func (c Client) rset() (string, error) {
-	err := c.sendCmd("RSET")
+func (c *Client) rset() (string, error) {
+	err := c.checkState("RSET", StateTransaction)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.sendCmd("RSET")
 	if err != nil {
 		return "", err
 	}
@@ -280,7 +568,7 @@ func (c Client) rset() (string, error) {
 		return "", err
 	}
 
-	return resp, nil
+	return resp, respErr("RSET", resp)
 }
 
 // User is the function that  authenticates the user.
@@ -296,7 +584,8 @@ func (c Client) rset() (string, error) {
 // even though no such mailbox exits. Also, the server
 // may return a negative status indicator even if the
 // username is exists because the mail server does not
-// permit plaintext password authentication.
+// permit plaintext password authentication. Negative
+// response is returned together with *ServerError.
 // Example:
 //		C: USER testUser
 //		S: -ERR no such mailbox
@@ -306,7 +595,17 @@ func (c Client) rset() (string, error) {
 //
 // name string - username of the mailbox
 func (c *Client) User(name string) (string, error) {
-	return c.user(name)
+	return c.UserContext(context.Background(), name)
+}
+
+// UserContext is the context-aware version of User.
+func (c *Client) UserContext(ctx context.Context, name string) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.user(name)
+	return resp, end(err)
 }
 
 // user is the implementation of the User function.
@@ -320,7 +619,12 @@ func (c *Client) User(name string) (string, error) {
 func (c *Client) user(name string) (string, error) {
 	// Send USER command
 	cmd := "USER"
-	err := c.sendCmdWithArg(cmd, name)
+	err := c.checkState(cmd, StateAuthorization)
+	if err != nil {
+		return "", err
+	}
+	c.username = name
+	err = c.sendCmdWithArg(cmd, name)
 	if err != nil {
 		return "", err
 	}
@@ -328,10 +632,10 @@ func (c *Client) user(name string) (string, error) {
 	// Read server response
 	userResp, err := c.readResp()
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
-	return userResp, nil
+	return userResp, respErr(cmd, userResp)
 }
 
 // Pass is the function that sends password to POP3
@@ -369,7 +673,18 @@ func (c *Client) user(name string) (string, error) {
 // secure apps. If not, give permission for less secure
 // apps.
 func (c *Client) Pass(password string) (string, error) {
-	return c.pass(password)
+	return c.PassContext(context.Background(), password)
+}
+
+// PassContext is the context-aware version of Pass.
+func (c *Client) PassContext(ctx context.Context, password string) (string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.pass(password)
+	c.logAuth("PASS", "", err)
+	return resp, end(err)
 }
 
 // pass is implementation of the Pass function. It takes
@@ -383,7 +698,11 @@ func (c *Client) Pass(password string) (string, error) {
 func (c *Client) pass(password string) (string, error) {
 	// Send PASS command
 	cmd := "PASS"
-	err := c.sendCmdWithArg(cmd, password)
+	err := c.checkState(cmd, StateAuthorization)
+	if err != nil {
+		return "", err
+	}
+	err = c.sendCmdWithArg(cmd, password)
 	if err != nil {
 		return "", err
 	}
@@ -394,7 +713,11 @@ func (c *Client) pass(password string) (string, error) {
 		return "", err
 	}
 
-	return passResp, nil
+	if strings.HasPrefix(passResp, ok) {
+		c.state = StateTransaction
+		c.caps = nil
+	}
+	return passResp, respErr(cmd, passResp)
 }
 
 // Top is a command which fetches message (msgNum) with n lines. To get messages
@@ -418,23 +741,173 @@ func (c *Client) pass(password string) (string, error) {
 //
 // msgNum indicates message id starts from 1 and n is line of the message's body.
 func (c *Client) Top(msgNum, n int) ([]string, error) {
-	return c.top(msgNum, n)
+	return c.TopContext(context.Background(), msgNum, n)
+}
+
+// TopContext is the context-aware version of Top.
+func (c *Client) TopContext(ctx context.Context, msgNum, n int) ([]string, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.top(msgNum, n)
+	return resp, end(err)
 }
 
 // top is the implementation function of the Top function.
 func (c *Client) top(msgNum, n int) ([]string, error) {
 	if msgNum < 1 {
-		return nil, fmt.Errorf("%s message number should be greater than 0", e)
+		return nil, errMsgNum
 	}
 	if n < 0 {
-		return nil, fmt.Errorf("%s line count cannot be negative", e)
+		return nil, errLineCount
 	}
 	cmd := "TOP"
+	err := c.checkState(cmd, StateTransaction)
+	if err != nil {
+		return nil, err
+	}
 	arg := fmt.Sprintf("%d %d", msgNum, n)
-	err := c.sendCmdWithArg(cmd, arg)
+	err = c.sendCmdWithArg(cmd, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := c.readRespMultiLines()
+	if err != nil {
+		return nil, err
+	}
+	return lines, respErr(cmd, lines[0])
+}
+
+// UniqueID keeps the unique-id listing of a message. Num
+// is the message number and UID is the server-assigned
+// unique-id of the message which does not change between
+// sessions.
+type UniqueID struct {
+	// Num is the message number.
+	Num int
+
+	// UID is the unique-id of the message.
+	UID string
+}
+
+// Uidl returns the unique-id listing of all messages in
+// the maildrop. It indicates UIDL command in POP-3 protocol.
+// Unlike the message numbers, unique-ids persist across
+// sessions, so they can be used to find out which messages
+// are already retrieved.
+// Example:
+// 		C: UIDL
+// 		S: +OK
+// 		S: 1 whqtswO00WBw418f9t5JxYwZ
+// 		S: 2 QhdPYR:00WBw1Ph7x7
+// 		S: .
+func (c *Client) Uidl() ([]UniqueID, error) {
+	return c.UidlContext(context.Background())
+}
+
+// UidlContext is the context-aware version of Uidl.
+func (c *Client) UidlContext(ctx context.Context) ([]UniqueID, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.uidl()
+	return resp, end(err)
+}
+
+// uidl is the implementation of the Uidl function. It sends
+// the UIDL command, reads the multi-line response and parses
+// each line into UniqueID.
+func (c *Client) uidl() ([]UniqueID, error) {
+	err := c.checkState("UIDL", StateTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.sendCmd("UIDL")
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := c.readRespMultiLines()
 	if err != nil {
 		return nil, err
 	}
+	if err = respErr("UIDL", lines[0]); err != nil {
+		return nil, err
+	}
+
+	var ids []UniqueID
+	for _, l := range lines[1:] {
+		id, err := parseUniqueID(l)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// UidlOne returns the unique-id listing of the given message.
+// The server responds in a single line.
+// Example:
+// 		C: UIDL 2
+// 		S: +OK 2 QhdPYR:00WBw1Ph7x7
+// 		C: UIDL 3
+// 		S: -ERR no such message, only 2 messages in maildrop
+//
+// msgNum int - message number.
+func (c *Client) UidlOne(msgNum int) (UniqueID, error) {
+	return c.UidlOneContext(context.Background(), msgNum)
+}
+
+// UidlOneContext is the context-aware version of UidlOne.
+func (c *Client) UidlOneContext(ctx context.Context, msgNum int) (UniqueID, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return UniqueID{}, err
+	}
+	resp, err := c.uidlOne(msgNum)
+	return resp, end(err)
+}
 
-	return c.readRespMultiLines()
+// uidlOne is the implementation of the UidlOne function.
+func (c *Client) uidlOne(msgNum int) (UniqueID, error) {
+	err := c.checkState("UIDL", StateTransaction)
+	if err != nil {
+		return UniqueID{}, err
+	}
+
+	err = c.sendCmdWithArg("UIDL", strconv.Itoa(msgNum))
+	if err != nil {
+		return UniqueID{}, err
+	}
+
+	resp, err := c.readResp()
+	if err != nil {
+		return UniqueID{}, err
+	}
+	if err = respErr("UIDL", resp); err != nil {
+		return UniqueID{}, err
+	}
+	return parseUniqueID(strings.TrimPrefix(resp, ok))
+}
+
+// parseUniqueID parses a unique-id listing line which
+// consists of message number and unique-id separated
+// by a single space.
+//
+// line string - unique-id listing, e.g. "1 whqtswO00WBw418f9t5JxYwZ"
+func parseUniqueID(line string) (UniqueID, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return UniqueID{}, fmt.Errorf("malformed unique-id listing: %q", line)
+	}
+	num, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return UniqueID{}, fmt.Errorf("malformed message number: %q", line)
+	}
+	return UniqueID{Num: num, UID: fields[1]}, nil
 }
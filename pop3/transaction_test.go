@@ -1,26 +1,59 @@
-package pop3
+package pop3_test
 
 import (
+	"errors"
 	"log"
 	"math"
-	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/gozeloglu/gop-3/pop3"
+	"github.com/gozeloglu/gop-3/pop3/pop3test"
 )
 
 const (
-	btAddr       = "mail.btopenworld.com:110"
-	btTLSAddr    = "mail.btopenworld.com:995"
-	gmailTLSAddr = "pop.gmail.com:995"
-	userKey      = "POP3_USER"
-	passwordKey  = "POP3_PASSWORD"
+	testUser     = "user@example.com"
+	testPassword = "secret"
 )
 
+// Status indicators of the responses.
+const (
+	ok = "+OK"
+	e  = "-ERR"
+)
+
+// newTestServer starts a fake POP3 server with a mailbox of
+// two messages for testUser. The server is closed at the end
+// of the test. Clients of TLS server should use
+// ClientTLSConfig of the server.
+func newTestServer(t *testing.T, isTLS bool) *pop3test.Server {
+	srv := pop3test.NewUnstartedServer()
+	if isTLS {
+		srv.StartTLS()
+	} else {
+		srv.Start()
+	}
+	t.Cleanup(srv.Close)
+	srv.AddMailbox(testUser, testPassword,
+		pop3test.Message{
+			UID:  "whqtswO00WBw418f9t5JxYwZ",
+			Data: "From: john@example.com\r\nSubject: Hello\r\n\r\nHi,\r\nHow are you?\r\n",
+		},
+		pop3test.Message{
+			UID:  "QhdPYR:00WBw1Ph7x7",
+			Data: "From: jane@example.com\r\nSubject: Report\r\n\r\n.signature\r\n",
+		},
+	)
+	return srv
+}
+
 func TestUserCmd(t *testing.T) {
-	pop, err := Connect(btAddr, nil, false)
+	srv := newTestServer(t, false)
+	pop, err := pop3.Connect(srv.Addr, nil, false)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
 	u, err := pop.User("testUser")
@@ -34,9 +67,10 @@ func TestUserCmd(t *testing.T) {
 }
 
 func TestUserCmdWithTLS(t *testing.T) {
-	pop, err := Connect(btTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
 	u, err := pop.User("testUser")
@@ -50,9 +84,10 @@ func TestUserCmdWithTLS(t *testing.T) {
 }
 
 func TestUserGMail(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
 	u, err := pop.User("testUser")
@@ -65,22 +100,14 @@ func TestUserGMail(t *testing.T) {
 	}
 }
 
-// You need to save GMail username and password
-// as environment variables. Environment variable
-// names should be "POP3_USER" and "POP3_PASSWORD".
-// NOTE: If you are working with GMail, you need to
-// change security level and give permission to
-// less secure apps. You can go to the following
-// link and give permission to less secure apps.
-// https://myaccount.google.com/lesssecureapps
 func TestPassCmd(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	// read username from env variable
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -90,8 +117,7 @@ func TestPassCmd(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	// read password from env variable
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -103,12 +129,13 @@ func TestPassCmd(t *testing.T) {
 }
 
 func TestStat(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -118,7 +145,7 @@ func TestStat(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -139,44 +166,39 @@ func TestStat(t *testing.T) {
 }
 
 func TestStatUnauthorized(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	s, err := pop.Stat()
-	if err != nil {
-		t.Errorf(err.Error())
-	}
-
-	if !strings.HasPrefix(s, e) {
-		t.Errorf("expected: %s, got: %s", s, e)
+	_, err = pop.Stat()
+	if !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
 	}
 }
 
 func TestStatErr(t *testing.T) {
-	pop, err := Connect(btAddr, nil, false)
-	if err != nil {
-		t.Errorf(err.Error())
-	}
-
-	s, err := pop.Stat()
+	srv := newTestServer(t, false)
+	pop, err := pop3.Connect(srv.Addr, nil, false)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	if !strings.HasPrefix(s, e) {
-		t.Errorf("expected: %s, got: %s", e, s)
+	_, err = pop.Stat()
+	if !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
 	}
 }
 
 func TestList(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -186,7 +208,7 @@ func TestList(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -207,28 +229,29 @@ func TestList(t *testing.T) {
 }
 
 func TestListUnauthorized(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
 	l, err := pop.List()
-	if err != nil {
-		t.Errorf(err.Error())
+	if !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
 	}
-
-	if !strings.HasPrefix(l[0], e) {
-		t.Errorf("expected:%s, got: %s", l, e)
+	if l != nil {
+		t.Errorf("expected: <nil>, got: %v", l)
 	}
 }
 
 func TestListWithArg(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -238,7 +261,7 @@ func TestListWithArg(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -263,24 +286,32 @@ func TestListWithArg(t *testing.T) {
 }
 
 func TestListWithArgUnauthorized(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
 	l, err := pop.List(1)
-	if err != nil {
-		t.Errorf(err.Error())
+	if !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
 	}
-
-	if !strings.HasPrefix(l[0], e) {
-		t.Errorf("expected: %s, got: %s", e, l[0])
+	if l != nil {
+		t.Errorf("expected: <nil>, got: %v", l)
 	}
 }
 
 func TestNoop(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	if _, err = pop.User(testUser); err != nil {
+		t.Errorf(err.Error())
+	}
+	if _, err = pop.Pass(testPassword); err != nil {
 		t.Errorf(err.Error())
 	}
 
@@ -295,12 +326,13 @@ func TestNoop(t *testing.T) {
 }
 
 func TestRetr(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -310,7 +342,7 @@ func TestRetr(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -337,12 +369,13 @@ func TestRetr(t *testing.T) {
 }
 
 func TestRetrFail(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -352,7 +385,7 @@ func TestRetrFail(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -368,8 +401,9 @@ func TestRetrFail(t *testing.T) {
 	}
 
 	r, err := pop.Retr(strconv.Itoa(math.MaxInt64 - 1))
-	if err != nil {
-		t.Errorf(err.Error())
+	var se *pop3.ServerError
+	if !errors.As(err, &se) {
+		t.Errorf("expected *ServerError, got: %v", err)
 	}
 
 	if !strings.HasPrefix(r[0], e) {
@@ -378,12 +412,13 @@ func TestRetrFail(t *testing.T) {
 }
 
 func TestDele(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -393,7 +428,7 @@ func TestDele(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -414,12 +449,13 @@ func TestDele(t *testing.T) {
 }
 
 func TestDeleFail(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -429,7 +465,7 @@ func TestDeleFail(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -440,8 +476,9 @@ func TestDeleFail(t *testing.T) {
 	}
 
 	d, err := pop.Dele(strconv.Itoa(math.MaxInt64 - 1))
-	if err != nil {
-		t.Errorf(err.Error())
+	var se *pop3.ServerError
+	if !errors.As(err, &se) {
+		t.Errorf("expected *ServerError, got: %v", err)
 	}
 
 	if !strings.HasPrefix(d, e) {
@@ -450,12 +487,13 @@ func TestDeleFail(t *testing.T) {
 }
 
 func TestRset(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -465,7 +503,7 @@ func TestRset(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -495,10 +533,10 @@ func TestRset(t *testing.T) {
 }
 
 func TestTopNegativeMsgNum(t *testing.T) {
-	exp := "-ERR message number should be greater than 0"
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 	log.Println("Connection established")
 
@@ -507,8 +545,9 @@ func TestTopNegativeMsgNum(t *testing.T) {
 	if top != nil {
 		t.Errorf("need to be nil")
 	}
-	if !strings.HasPrefix(err.Error(), exp) {
-		t.Errorf(err.Error())
+	var se *pop3.ServerError
+	if !errors.Is(err, pop3.ErrMsgNum) || errors.As(err, &se) {
+		t.Errorf("expected local error, got: %v", err)
 	}
 	log.Println(err.Error())
 
@@ -523,10 +562,10 @@ func TestTopNegativeMsgNum(t *testing.T) {
 }
 
 func TestTopNegativeN(t *testing.T) {
-	exp := "-ERR line count cannot be negative"
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 	log.Println("Connection established")
 
@@ -535,8 +574,9 @@ func TestTopNegativeN(t *testing.T) {
 	if top != nil {
 		t.Errorf("need to be nil")
 	}
-	if !strings.HasPrefix(err.Error(), exp) {
-		t.Errorf(err.Error())
+	var se *pop3.ServerError
+	if !errors.Is(err, pop3.ErrLineCount) || errors.As(err, &se) {
+		t.Errorf("expected local error, got: %v", err)
 	}
 	log.Println(err.Error())
 
@@ -551,31 +591,32 @@ func TestTopNegativeN(t *testing.T) {
 }
 
 func TestTopNotLoggedIn(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 	log.Println("Connection established")
 
 	top, err := pop.Top(1, 20)
-	if err != nil {
-		t.Errorf("err need to be <nil>")
+	if !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
 	}
-	if !strings.HasPrefix(top[0], e) {
-		t.Errorf(top[0])
+	if top != nil {
+		t.Errorf("need to be nil")
 	}
-	log.Println(top[0])
 	log.Println(err)
 }
 
 func TestTopPass(t *testing.T) {
-	pop, err := Connect(gmailTLSAddr, nil, true)
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatalf(err.Error())
 	}
 	log.Println("Connection established")
 
-	username := os.Getenv(userKey)
+	username := testUser
 	u, err := pop.User(username)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -584,7 +625,7 @@ func TestTopPass(t *testing.T) {
 		t.Errorf("expected: %s, got: %s", ok, u)
 	}
 
-	password := os.Getenv(passwordKey)
+	password := testPassword
 	p, err := pop.Pass(password)
 	if err != nil {
 		t.Errorf(err.Error())
@@ -609,3 +650,214 @@ func TestTopPass(t *testing.T) {
 	log.Println(quit)
 	log.Println("Connection closed")
 }
+
+func TestUidl(t *testing.T) {
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	username := testUser
+	u, err := pop.User(username)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if !strings.HasPrefix(u, ok) {
+		t.Errorf("expected: %s, got: %s", ok, u)
+	}
+
+	password := testPassword
+	p, err := pop.Pass(password)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if !strings.HasPrefix(p, ok) {
+		t.Errorf("expected: %s, got: %s", ok, p)
+	}
+
+	ids, err := pop.Uidl()
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	for i, id := range ids {
+		if id.Num != i+1 {
+			t.Errorf("expected message number: %d, got: %d", i+1, id.Num)
+		}
+		if id.UID == "" {
+			t.Errorf("unique-id of message %d is empty", id.Num)
+		}
+	}
+
+	if len(ids) > 0 {
+		id, err := pop.UidlOne(1)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if id != ids[0] {
+			t.Errorf("expected: %v, got: %v", ids[0], id)
+		}
+	}
+}
+
+func TestUidlUnauthorized(t *testing.T) {
+	srv := newTestServer(t, true)
+	pop, err := pop3.Connect(srv.Addr, srv.ClientTLSConfig(), true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	_, err = pop.Uidl()
+	if !errors.Is(err, pop3.ErrWrongState) {
+		t.Errorf("expected ErrWrongState, got: %v", err)
+	}
+}
+
+func TestParseUniqueID(t *testing.T) {
+	id, err := pop3.ParseUniqueID("2 QhdPYR:00WBw1Ph7x7")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	exp := pop3.UniqueID{Num: 2, UID: "QhdPYR:00WBw1Ph7x7"}
+	if id != exp {
+		t.Errorf("expected: %v, got: %v", exp, id)
+	}
+
+	for _, l := range []string{"", "1", "x abc", "1 abc def"} {
+		if _, err := pop3.ParseUniqueID(l); err == nil {
+			t.Errorf("expected error for %q", l)
+		}
+	}
+}
+
+func TestClient_StatInfo(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "STAT", Send: "+OK 2 320"},
+		pop3test.Step{Expect: "STAT", Send: "-ERR unknown command"},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	s, err := pop.StatInfo()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	exp := pop3.StatResult{Count: 2, Size: 320}
+	if s != exp {
+		t.Errorf("expected: %v, got: %v", exp, s)
+	}
+
+	if _, err = pop.StatInfo(); err == nil {
+		t.Errorf("expected error for negative response")
+	}
+}
+
+func TestClient_ListAll(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "LIST", Send: "+OK 2 messages (320 octets)\r\n1 120\r\n2 200\r\n."},
+		pop3test.Step{Expect: "LIST", Send: "-ERR not logged in"},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	msgs, err := pop.ListAll()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	exp := []pop3.MessageInfo{{Num: 1, Size: 120}, {Num: 2, Size: 200}}
+	if !reflect.DeepEqual(msgs, exp) {
+		t.Errorf("expected: %v, got: %v", exp, msgs)
+	}
+
+	if _, err = pop.ListAll(); err == nil {
+		t.Errorf("expected error for negative response")
+	}
+}
+
+func TestClient_ListOne(t *testing.T) {
+	pop := pop3test.ScriptClient(t,
+		pop3test.Step{Expect: "LIST 2", Send: "+OK 2 200"},
+		pop3test.Step{Expect: "LIST 3", Send: "-ERR no such message, only 2 messages in maildrop"},
+	)
+	pop.SetState(pop3.StateTransaction)
+
+	msg, err := pop.ListOne(2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	exp := pop3.MessageInfo{Num: 2, Size: 200}
+	if msg != exp {
+		t.Errorf("expected: %v, got: %v", exp, msg)
+	}
+
+	if _, err = pop.ListOne(3); err == nil {
+		t.Errorf("expected error for negative response")
+	}
+}
+
+func TestParseMessageInfo(t *testing.T) {
+	for _, l := range []string{"", "1", "a 1", "1 b"} {
+		if _, err := pop3.ParseMessageInfo(l); err == nil {
+			t.Errorf("expected error for %q", l)
+		}
+	}
+}
+
+func TestStatServerFailure(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.Fail("STAT", pop3test.Failure{Resp: "-ERR [SYS/TEMP] mailbox is busy"})
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	_, err := pop.StatInfo()
+	if !errors.Is(err, pop3.ErrSysTemp) {
+		t.Errorf("expected: %v, got: %v", pop3.ErrSysTemp, err)
+	}
+	st, err := pop.StatInfo()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if st.Count != 2 {
+		t.Errorf("expected: %d, got: %d", 2, st.Count)
+	}
+}
+
+func TestRetrConnectionClosed(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.Fail("RETR", pop3test.Failure{Close: true})
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	_, err := pop.Retr("1")
+	if err == nil {
+		t.Errorf("expected error for closed connection")
+	}
+}
+
+func TestRetrDotStuffed(t *testing.T) {
+	srv := newTestServer(t, false)
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	msg, err := pop.Retr("2")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if last := msg[len(msg)-1]; last != ".signature" {
+		t.Errorf("expected: %s, got: %s", ".signature", last)
+	}
+}
+
+func TestDeleCommittedOnQuit(t *testing.T) {
+	srv := newTestServer(t, false)
+	pop := srv.Login(t, nil, testUser, testPassword)
+
+	if _, err := pop.Dele("1"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := pop.Quit(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if pop.State() != pop3.StateUpdate {
+		t.Errorf("expected: %v, got: %v", pop3.StateUpdate, pop.State())
+	}
+	msgs := srv.Messages(testUser)
+	if len(msgs) != 1 || msgs[0].UID != "QhdPYR:00WBw1Ph7x7" {
+		t.Errorf("expected only the second message, got: %v", msgs)
+	}
+}